@@ -0,0 +1,55 @@
+// Command rotate-keys re-encrypts every stored provider key under the active
+// master key (ENCRYPTION_KEY_ID) and seals keys still stored in plaintext.
+//
+// Rotation runs without downtime:
+//
+//  1. Add the new key to ENCRYPTION_KEYS, point ENCRYPTION_KEY_ID at it and
+//     redeploy. Servers seal new keys with it and can still open old ones.
+//  2. Run this command until it reports no failures.
+//  3. Remove the old key from ENCRYPTION_KEYS and redeploy.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"server/database"
+	"server/utils"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "report what would be re-encrypted without writing")
+	flag.Parse()
+
+	ring, err := utils.LoadKeyring()
+	if err != nil {
+		log.Fatalf("Failed to load encryption keys: %v", err)
+	}
+
+	if err := database.Init(); err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Disconnect()
+
+	db, err := database.Connect()
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	stats, err := utils.RotateUserSecrets(context.Background(), db, ring, *dryRun)
+	if err != nil {
+		log.Fatalf("Rotation stopped after %d users: %v", stats.Users, err)
+	}
+
+	verb := "Re-encrypted"
+	if *dryRun {
+		verb = "Would re-encrypt"
+	}
+	log.Printf("%s %d keys under %q across %d users (%d already current, %d changed during the run, %d failed)",
+		verb, stats.Resealed, ring.ActiveID, stats.Users, stats.Current, stats.Conflict, stats.Failed)
+
+	if stats.Failed > 0 {
+		database.Disconnect()
+		log.Fatalf("%d keys could not be re-encrypted; check that every master key they use is in ENCRYPTION_KEYS", stats.Failed)
+	}
+}
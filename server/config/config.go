@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -14,3 +15,19 @@ func Config(key string) string {
 	}
 	return os.Getenv(key)
 }
+
+// Duration reads key as a Go duration such as "90s" or "5m", falling back to
+// def when it is unset or malformed.
+func Duration(key string, def time.Duration) time.Duration {
+	value := Config(key)
+	if value == "" {
+		return def
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		fmt.Printf("Invalid duration for %s: %q, using %s\n", key, value, def)
+		return def
+	}
+	return duration
+}
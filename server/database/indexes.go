@@ -0,0 +1,147 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// indexes lists the indexes each collection needs, by collection name.
+// Creating an index that already exists is a no-op, so the list is applied
+// on every start.
+var indexes = map[string][]mongo.IndexModel{
+	"notes": {
+		{
+			// GET /notes, pinned notes first. Each of these indexes serves its
+			// order's default direction; the opposite direction sorts in memory.
+			Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "pinned", Value: -1}, {Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}},
+			Options: options.Index().SetName("userId_pinned_createdAt"),
+		},
+		{
+			// GET /notes?sort=updated.
+			Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "pinned", Value: -1}, {Key: "updatedAt", Value: -1}, {Key: "_id", Value: -1}},
+			Options: options.Index().SetName("userId_pinned_updatedAt"),
+		},
+		{
+			// GET /notes?sort=title. The collation must match the one the
+			// listing sorts with, utils.titleCollation.
+			Keys: bson.D{{Key: "userId", Value: 1}, {Key: "pinned", Value: -1}, {Key: "title", Value: 1}, {Key: "_id", Value: 1}},
+			Options: options.Index().SetName("userId_pinned_title").
+				SetCollation(&options.Collation{Locale: "en", Strength: 2}),
+		},
+		{
+			// GET /notes?tag= and the tag listing.
+			Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "tags", Value: 1}, {Key: "createdAt", Value: -1}},
+			Options: options.Index().SetName("userId_tags_createdAt"),
+		},
+		{
+			// GET /notes?notebook= and notebook note counts.
+			Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "notebookId", Value: 1}, {Key: "createdAt", Value: -1}},
+			Options: options.Index().SetName("userId_notebookId_createdAt"),
+		},
+		{
+			// GET /search. Titles weigh more than content.
+			Keys: bson.D{{Key: "userId", Value: 1}, {Key: "title", Value: "text"}, {Key: "content", Value: "text"}},
+			Options: options.Index().SetName("userId_text").
+				SetWeights(bson.M{"title": 3, "content": 1}),
+		},
+		trashIndex,
+	},
+	"note_chunks": {
+		{
+			// GET /search/semantic loads every chunk of a user's notes
+			// embedded with their current model.
+			Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "model", Value: 1}},
+			Options: options.Index().SetName("userId_model"),
+		},
+		{
+			Keys:    bson.D{{Key: "noteId", Value: 1}},
+			Options: options.Index().SetName("noteId"),
+		},
+	},
+	"note_revisions": {
+		{
+			// Revision history and lookups by number. Unique so that two
+			// writes to a note cannot record the same revision number.
+			Keys:    bson.D{{Key: "noteId", Value: 1}, {Key: "number", Value: -1}},
+			Options: options.Index().SetName("noteId_number").SetUnique(true),
+		},
+	},
+	"chat_messages": {
+		{
+			// GET /search.
+			Keys:    bson.D{{Key: "clerkId", Value: 1}, {Key: "content", Value: "text"}},
+			Options: options.Index().SetName("clerkId_text"),
+		},
+	},
+	"chat_sessions": {
+		trashIndex,
+	},
+	"notebooks": {
+		{
+			Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "parentId", Value: 1}},
+			Options: options.Index().SetName("userId_parentId"),
+		},
+	},
+}
+
+// retiredIndexes lists indexes that an earlier version created and that
+// nothing uses any more, by collection name. They are dropped on start.
+var retiredIndexes = map[string][]string{
+	// Replaced by the userId_pinned_* indexes when pinning was added.
+	"notes": {"userId_createdAt", "userId_updatedAt", "userId_title"},
+}
+
+// trashIndex covers only the documents in the trash, for the trash purge.
+var trashIndex = mongo.IndexModel{
+	Keys: bson.D{{Key: "deletedAt", Value: 1}},
+	Options: options.Index().SetName("deletedAt").
+		SetPartialFilterExpression(bson.M{"deletedAt": bson.M{"$exists": true}}),
+}
+
+// EnsureIndexes creates any missing indexes from the list above and drops
+// the retired ones that still exist.
+func EnsureIndexes(ctx context.Context) error {
+	db, err := Connect()
+	if err != nil {
+		return err
+	}
+
+	for collection, models := range indexes {
+		if _, err := db.Collection(collection).Indexes().CreateMany(ctx, models); err != nil {
+			return fmt.Errorf("failed to create %s indexes: %w", collection, err)
+		}
+	}
+
+	for collection, names := range retiredIndexes {
+		if err := dropIndexes(ctx, db.Collection(collection), names); err != nil {
+			return fmt.Errorf("failed to drop retired %s indexes: %w", collection, err)
+		}
+	}
+	return nil
+}
+
+// dropIndexes drops those of the named indexes that collection has.
+func dropIndexes(ctx context.Context, collection *mongo.Collection, names []string) error {
+	specs, err := collection.Indexes().ListSpecifications(ctx)
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		existing[spec.Name] = true
+	}
+	for _, name := range names {
+		if !existing[name] {
+			continue
+		}
+		if _, err := collection.Indexes().DropOne(ctx, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"math"
+	"server/services"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// aiErrorPayload describes a failed AI call for the client. Classified
+// provider failures carry their own status, a machine-readable code and, when
+// known, how many seconds to wait before trying again.
+func aiErrorPayload(message string, err error) (int, fiber.Map) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fiber.StatusGatewayTimeout, fiber.Map{
+			"message": message,
+			"error":   "the request took too long to complete",
+			"code":    "timeout",
+		}
+	}
+
+	providerErr, ok := services.AsProviderError(err)
+	if !ok {
+		return fiber.StatusInternalServerError, fiber.Map{
+			"message": message,
+			"error":   err.Error(),
+		}
+	}
+
+	payload := fiber.Map{
+		"message":  message,
+		"error":    providerErr.Error(),
+		"code":     providerErr.Code(),
+		"provider": providerErr.Provider,
+	}
+	if providerErr.RetryAfter > 0 {
+		payload["retryAfter"] = int(math.Ceil(providerErr.RetryAfter.Seconds()))
+	}
+	return providerErr.HTTPStatus(), payload
+}
+
+func respondAIError(c *fiber.Ctx, message string, err error) error {
+	status, payload := aiErrorPayload(message, err)
+	if retryAfter, ok := payload["retryAfter"].(int); ok {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+	}
+	return c.Status(status).JSON(payload)
+}
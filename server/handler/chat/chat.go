@@ -2,12 +2,14 @@ package chat
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"server/database"
 	"server/middleware"
 	"server/models"
 	"server/services"
+	"server/utils"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -34,9 +36,15 @@ func StartChat(c *fiber.Ctx) error {
 		})
 	}
 
-	if chatReq.Model != "openai" && chatReq.Model != "gemini" {
+	if !services.IsSupportedProvider(chatReq.Model) {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Model must be 'openai' or 'gemini'",
+			"message": "Model must be " + services.SupportedProvidersMessage(),
+		})
+	}
+
+	if chatReq.Mode != models.ChatModeDefault && chatReq.Mode != models.ChatModeNotes {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Mode must be empty or notes",
 		})
 	}
 
@@ -46,60 +54,37 @@ func StartChat(c *fiber.Ctx) error {
 		return c.Status(500).JSON(fiber.Map{"message": "Database connection failed"})
 	}
 
-	userCollection := db.Collection("users")
-	var user models.User
-	err = userCollection.FindOne(context.Background(), bson.M{"clerkId": clerkUserID}).Decode(&user)
+	user, err := middleware.CurrentUser(c)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"message": "User profile not found. Please create your profile first.",
-			})
-		}
-		return c.Status(500).JSON(fiber.Map{"message": "Failed to find user"})
+		return err
 	}
 
-	var apiKey string
-	switch chatReq.Model {
-	case "openai":
-		apiKey = user.OpenAIKey
-	case "gemini":
-		apiKey = user.GeminiKey
+	creds, modelID, err := resolveCredentials(user, chatReq.Model, chatReq.ModelID, chatReq.EndpointID)
+	if err != nil {
+		return err
 	}
 
-	if apiKey == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": fmt.Sprintf("No %s API key found. Please add your API key in profile settings.", chatReq.Model),
-		})
+	if err := validateModelSelection(c.UserContext(), chatReq.Model, chatReq.ModelID, creds); err != nil {
+		return err
 	}
 
-	if chatReq.SessionID == "" {
-		chatReq.SessionID = uuid.New().String()
+	budgetWarnings, err := enforceBudgets(c, user, chatReq.Model)
+	if err != nil {
+		return err
 	}
 
-	sessionCollection := db.Collection("chat_sessions")
-	session := models.ChatSession{
-		SessionID:    chatReq.SessionID,
-		UserID:       user.ID,
-		ClerkID:      clerkUserID,
-		Title:        generateSessionTitle(chatReq.Message),
-		Model:        chatReq.Model,
-		MessageCount: 1,
-		LastActivity: time.Now(),
-		CreatedAt:    time.Now(),
-		UpdatedAt:    time.Now(),
+	citations, err := noteCitations(c, db, user, chatReq.Mode, chatReq.Message)
+	if err != nil {
+		return err
 	}
 
-	var existingSession models.ChatSession
-	err = sessionCollection.FindOne(context.Background(), bson.M{"sessionId": chatReq.SessionID}).Decode(&existingSession)
-	if err == nil {
-		existingSession.MessageCount++
-		existingSession.LastActivity = time.Now()
-		existingSession.UpdatedAt = time.Now()
-		sessionCollection.ReplaceOne(context.Background(), bson.M{"sessionId": chatReq.SessionID}, existingSession)
-	} else {
-		sessionCollection.InsertOne(context.Background(), session)
+	if chatReq.SessionID == "" {
+		chatReq.SessionID = uuid.New().String()
 	}
 
+	history := loadSessionHistory(c.UserContext(), db, clerkUserID, chatReq.SessionID)
+	touchChatSession(c.UserContext(), db, user, clerkUserID, chatReq.SessionID, chatReq.Message, chatReq.Model)
+
 	messageCollection := db.Collection("chat_messages")
 	userMessage := models.ChatMessage{
 		SessionID: chatReq.SessionID,
@@ -110,23 +95,21 @@ func StartChat(c *fiber.Ctx) error {
 		Model:     chatReq.Model,
 		CreatedAt: time.Now(),
 	}
-	messageCollection.InsertOne(context.Background(), userMessage)
+	messageCollection.InsertOne(c.UserContext(), userMessage)
 
 	response, err := aiService.ChatWithAI(
+		c.UserContext(),
 		user.ID.Hex(),
 		clerkUserID,
 		chatReq.SessionID,
 		chatReq.Message,
-		getDefaultModelID(chatReq.Model),
-		chatReq.Model,
-		apiKey,
+		chatTargets(c, user, chatReq.Model, modelID, creds),
+		history,
+		citations,
 	)
 	if err != nil {
 		log.Printf("AI service error: %v", err)
-		return c.Status(500).JSON(fiber.Map{
-			"message": "Failed to get AI response",
-			"error":   err.Error(),
-		})
+		return respondAIError(c, "Failed to get AI response", err)
 	}
 
 	aiMessage := models.ChatMessage{
@@ -135,10 +118,15 @@ func StartChat(c *fiber.Ctx) error {
 		ClerkID:   clerkUserID,
 		Role:      "assistant",
 		Content:   response.Message,
-		Model:     chatReq.Model,
+		Model:     response.Model,
+		ModelID:   response.ModelID,
+		Usage:     response.Usage,
+		Citations: response.Citations,
 		CreatedAt: time.Now(),
 	}
-	messageCollection.InsertOne(context.Background(), aiMessage)
+	messageCollection.InsertOne(c.UserContext(), aiMessage)
+	recordChatUsage(c.UserContext(), user, clerkUserID, chatReq.SessionID, "chat", response.Model, response.ModelID, response.Usage)
+	response.BudgetWarnings = budgetWarnings
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "Chat response generated successfully",
@@ -146,6 +134,51 @@ func StartChat(c *fiber.Ctx) error {
 	})
 }
 
+// noteCitations returns the note excerpts a chat in mode answers from: nil
+// for an ordinary chat, the user's notes most relevant to message in
+// models.ChatModeNotes.
+func noteCitations(c *fiber.Ctx, db *mongo.Database, user models.User, mode, message string) ([]models.Citation, error) {
+	if mode != models.ChatModeNotes {
+		return nil, nil
+	}
+
+	citations, err := services.RetrieveNoteCitations(c.UserContext(), db, user, message)
+	if err != nil {
+		log.Printf("Failed to search notes: %v", err)
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to search notes")
+	}
+	return citations, nil
+}
+
+// touchChatSession creates the session on its first message and bumps its
+// activity counters on every message after that.
+func touchChatSession(ctx context.Context, db *mongo.Database, user models.User, clerkUserID, sessionID, message, model string) {
+	sessionCollection := db.Collection("chat_sessions")
+	session := models.ChatSession{
+		SessionID:    sessionID,
+		UserID:       user.ID,
+		ClerkID:      clerkUserID,
+		Title:        generateSessionTitle(message),
+		Model:        model,
+		MessageCount: 1,
+		LastActivity: time.Now(),
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+
+	var existingSession models.ChatSession
+	filter := bson.M{"sessionId": sessionID, "clerkId": clerkUserID}
+	err := sessionCollection.FindOne(ctx, filter).Decode(&existingSession)
+	if err == nil {
+		existingSession.MessageCount++
+		existingSession.LastActivity = time.Now()
+		existingSession.UpdatedAt = time.Now()
+		sessionCollection.ReplaceOne(ctx, filter, existingSession)
+	} else {
+		sessionCollection.InsertOne(ctx, session)
+	}
+}
+
 func generateSessionTitle(message string) string {
 	if len(message) > 50 {
 		return message[:47] + "..."
@@ -153,13 +186,159 @@ func generateSessionTitle(message string) string {
 	return message
 }
 
-func getDefaultModelID(model string) string {
-	switch model {
-	case "openai":
-		return "gpt-3.5-turbo"
-	case "gemini":
-		return "gemini-1.5-flash"
-	default:
+// recordChatUsage stores the token usage of one provider call. Failures are
+// logged rather than surfaced so that accounting never fails a chat. Usage is
+// recorded even when ctx has been cancelled: the provider has billed for it.
+func recordChatUsage(ctx context.Context, user models.User, clerkUserID, sessionID, source, provider, modelID string, usage *models.TokenUsage) {
+	if usage == nil {
+		return
+	}
+
+	db, err := database.Connect()
+	if err != nil {
+		log.Printf("Database connection error: %v", err)
+		return
+	}
+
+	err = utils.RecordUsage(context.WithoutCancel(ctx), db, models.UsageEvent{
+		UserID:           user.ID,
+		ClerkID:          clerkUserID,
+		SessionID:        sessionID,
+		Source:           source,
+		Provider:         provider,
+		Model:            modelID,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      usage.TotalTokens,
+		Cost:             usage.Cost,
+		CreatedAt:        time.Now(),
+	})
+	if err != nil {
+		log.Printf("Failed to record usage: %v", err)
+	}
+}
+
+// resolveCredentials returns the credentials and model ID used to call
+// provider on behalf of user. Self-hosted endpoints carry their own base URL,
+// optional key and model; built-in providers use the user's stored key.
+func resolveCredentials(user models.User, provider, modelID, endpointID string) (services.Credentials, string, error) {
+	if provider == services.CustomProviderName {
+		if endpointID == "" {
+			return services.Credentials{}, "", fiber.NewError(fiber.StatusBadRequest, "endpointId is required for the custom provider")
+		}
+
+		endpoint, ok := user.FindCustomEndpoint(endpointID)
+		if !ok {
+			return services.Credentials{}, "", fiber.NewError(fiber.StatusNotFound, "Custom endpoint not found")
+		}
+
+		if modelID == "" {
+			modelID = endpoint.Model
+		}
+		return services.Credentials{APIKey: endpoint.APIKey, BaseURL: endpoint.BaseURL}, modelID, nil
+	}
+
+	apiKey := user.APIKey(provider)
+	if apiKey == "" {
+		return services.Credentials{}, "", fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("No %s API key found. Please add your API key in profile settings.", provider))
+	}
+
+	if modelID == "" {
+		modelID = getDefaultModelID(provider)
+	}
+	return services.Credentials{APIKey: apiKey}, modelID, nil
+}
+
+// validateModelSelection rejects a model the caller asked for explicitly
+// that is not in the provider's catalog. An empty modelID means the provider
+// or endpoint default and is always accepted.
+func validateModelSelection(ctx context.Context, provider, modelID string, creds services.Credentials) error {
+	if modelID == "" {
+		return nil
+	}
+
+	if err := services.ValidateModel(ctx, provider, modelID, creds); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Unknown model %q for provider %s. See GET /api/v1/models for available models.", modelID, provider))
+	}
+	return nil
+}
+
+// enforceBudgets rejects the request with a *utils.BudgetExceededError when
+// user has used up a budget covering provider. Budgets that are close to their
+// limit are returned and flagged in the X-Budget-Warning header.
+func enforceBudgets(c *fiber.Ctx, user models.User, provider string) ([]models.BudgetStatus, error) {
+	if len(user.Budgets) == 0 {
+		return []models.BudgetStatus{}, nil
+	}
+
+	db, err := database.Connect()
+	if err != nil {
+		log.Printf("Database connection error: %v", err)
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Database connection failed")
+	}
+
+	warnings, err := utils.CheckBudgets(c.UserContext(), db, user, provider, time.Now())
+	if err != nil {
+		var budgetErr *utils.BudgetExceededError
+		if !errors.As(err, &budgetErr) {
+			log.Printf("Failed to check spending budgets: %v", err)
+			return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to check spending budgets")
+		}
+		return nil, err
+	}
+
+	for _, warning := range warnings {
+		c.Append("X-Budget-Warning", fmt.Sprintf("%s %s budget %.0f%% used",
+			warning.Budget.Period, warning.Budget.Provider, warning.FractionUse*100))
+	}
+	return warnings, nil
+}
+
+// chatTargets returns the provider the request asked for followed by the
+// user's fallback chain. Fallback entries that cannot be used right now
+// (no key, unknown endpoint or a used-up budget) are skipped.
+func chatTargets(c *fiber.Ctx, user models.User, provider, modelID string, creds services.Credentials) []services.ChatTarget {
+	targets := []services.ChatTarget{{Provider: provider, ModelID: modelID, Creds: creds}}
+	if len(user.FallbackChain) == 0 {
+		return targets
+	}
+
+	db, err := database.Connect()
+	if err != nil {
+		log.Printf("Database connection error: %v", err)
+		return targets
+	}
+
+	for _, fallback := range user.FallbackChain {
+		fallbackCreds, fallbackModelID, err := resolveCredentials(user, fallback.Provider, fallback.Model, fallback.EndpointID)
+		if err != nil {
+			continue
+		}
+
+		duplicate := false
+		for _, target := range targets {
+			if target.Provider == fallback.Provider && target.ModelID == fallbackModelID && target.Creds == fallbackCreds {
+				duplicate = true
+				break
+			}
+		}
+		if duplicate {
+			continue
+		}
+
+		if _, err := utils.CheckBudgets(c.UserContext(), db, user, fallback.Provider, time.Now()); err != nil {
+			continue
+		}
+
+		targets = append(targets, services.ChatTarget{Provider: fallback.Provider, ModelID: fallbackModelID, Creds: fallbackCreds})
+	}
+	return targets
+}
+
+func getDefaultModelID(providerName string) string {
+	provider, err := services.GetProvider(providerName)
+	if err != nil {
 		return ""
 	}
+	return provider.DefaultModel()
 }
@@ -6,6 +6,7 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"server/database"
 	"server/middleware"
@@ -13,17 +14,13 @@ import (
 )
 
 func GetChatHistory(c *fiber.Ctx) error {
-	clerkUserID, err := middleware.GetClerkUserIDFromContext(c)
-	if err != nil {
-		return err
-	}
-
-	sessionID := c.Params("sessionId")
-	if sessionID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Session ID is required",
+	session, ok := middleware.CurrentChatSession(c)
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "Chat session not found",
 		})
 	}
+	sessionID, clerkUserID := session.SessionID, session.ClerkID
 
 	db, err := database.Connect()
 	if err != nil {
@@ -34,7 +31,7 @@ func GetChatHistory(c *fiber.Ctx) error {
 	messageCollection := db.Collection("chat_messages")
 	findOptions := options.Find().SetSort(bson.M{"createdAt": 1})
 	cursor, err := messageCollection.Find(
-		context.Background(),
+		c.UserContext(),
 		bson.M{
 			"sessionId": sessionID,
 			"clerkId":   clerkUserID,
@@ -44,10 +41,10 @@ func GetChatHistory(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"message": "Failed to retrieve chat history"})
 	}
-	defer cursor.Close(context.Background())
+	defer cursor.Close(c.UserContext())
 
 	var messages []models.ChatMessage
-	if err = cursor.All(context.Background(), &messages); err != nil {
+	if err = cursor.All(c.UserContext(), &messages); err != nil {
 		return c.Status(500).JSON(fiber.Map{"message": "Failed to decode chat messages"})
 	}
 
@@ -58,3 +55,39 @@ func GetChatHistory(c *fiber.Ctx) error {
 		"count":     len(messages),
 	})
 }
+
+// maxHistoryMessages caps how many stored turns are loaded as conversation
+// context; the AI service trims further to fit the model's context window.
+const maxHistoryMessages = 100
+
+// loadSessionHistory returns the most recent turns of a session, oldest first.
+func loadSessionHistory(ctx context.Context, db *mongo.Database, clerkUserID, sessionID string) []models.ChatMessage {
+	messageCollection := db.Collection("chat_messages")
+	findOptions := options.Find().
+		SetSort(bson.M{"createdAt": -1}).
+		SetLimit(maxHistoryMessages)
+	cursor, err := messageCollection.Find(
+		ctx,
+		bson.M{
+			"sessionId": sessionID,
+			"clerkId":   clerkUserID,
+		},
+		findOptions,
+	)
+	if err != nil {
+		log.Printf("Failed to load chat history: %v", err)
+		return nil
+	}
+	defer cursor.Close(ctx)
+
+	var messages []models.ChatMessage
+	if err = cursor.All(ctx, &messages); err != nil {
+		log.Printf("Failed to decode chat history: %v", err)
+		return nil
+	}
+
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages
+}
@@ -1,7 +1,6 @@
 package chat
 
 import (
-	"context"
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -26,17 +25,17 @@ func GetChatSessions(c *fiber.Ctx) error {
 	sessionCollection := db.Collection("chat_sessions")
 	findOptions := options.Find().SetSort(bson.M{"lastActivity": -1})
 	cursor, err := sessionCollection.Find(
-		context.Background(),
-		bson.M{"clerkId": clerkUserID},
+		c.UserContext(),
+		bson.M{"clerkId": clerkUserID, "deletedAt": nil},
 		findOptions,
 	)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"message": "Failed to retrieve chat sessions"})
 	}
-	defer cursor.Close(context.Background())
+	defer cursor.Close(c.UserContext())
 
 	var sessions []models.ChatSession
-	if err = cursor.All(context.Background(), &sessions); err != nil {
+	if err = cursor.All(c.UserContext(), &sessions); err != nil {
 		return c.Status(500).JSON(fiber.Map{"message": "Failed to decode chat sessions"})
 	}
 
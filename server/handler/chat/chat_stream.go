@@ -0,0 +1,287 @@
+package chat
+
+import (
+	"bufio"
+	"context"
+	"log"
+	"server/database"
+	"server/middleware"
+	"server/models"
+	"server/services"
+	"server/utils"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// StartChatStream is the streaming counterpart of StartChat. Tokens are sent
+// as "token" events while the provider generates them, followed by a single
+// "done" event carrying the session metadata, or an "error" event.
+func StartChatStream(c *fiber.Ctx) error {
+	clerkUserID, err := middleware.GetClerkUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+
+	var chatReq models.ChatRequest
+	if err := c.BodyParser(&chatReq); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+			"error":   err.Error(),
+		})
+	}
+
+	if !services.IsSupportedProvider(chatReq.Model) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Model must be " + services.SupportedProvidersMessage(),
+		})
+	}
+
+	if chatReq.Mode != models.ChatModeDefault && chatReq.Mode != models.ChatModeNotes {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Mode must be empty or notes",
+		})
+	}
+
+	db, err := database.Connect()
+	if err != nil {
+		log.Printf("Database connection error: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Database connection failed"})
+	}
+
+	user, err := middleware.CurrentUser(c)
+	if err != nil {
+		return err
+	}
+
+	creds, modelID, err := resolveCredentials(user, chatReq.Model, chatReq.ModelID, chatReq.EndpointID)
+	if err != nil {
+		return err
+	}
+
+	if err := validateModelSelection(c.UserContext(), chatReq.Model, chatReq.ModelID, creds); err != nil {
+		return err
+	}
+
+	budgetWarnings, err := enforceBudgets(c, user, chatReq.Model)
+	if err != nil {
+		return err
+	}
+
+	citations, err := noteCitations(c, db, user, chatReq.Mode, chatReq.Message)
+	if err != nil {
+		return err
+	}
+
+	if chatReq.SessionID == "" {
+		chatReq.SessionID = uuid.New().String()
+	}
+
+	history := loadSessionHistory(c.UserContext(), db, clerkUserID, chatReq.SessionID)
+	touchChatSession(c.UserContext(), db, user, clerkUserID, chatReq.SessionID, chatReq.Message, chatReq.Model)
+
+	messageCollection := db.Collection("chat_messages")
+	userMessage := models.ChatMessage{
+		SessionID: chatReq.SessionID,
+		UserID:    user.ID,
+		ClerkID:   clerkUserID,
+		Role:      "user",
+		Content:   chatReq.Message,
+		Model:     chatReq.Model,
+		CreatedAt: time.Now(),
+	}
+	messageCollection.InsertOne(c.UserContext(), userMessage)
+
+	targets := chatTargets(c, user, chatReq.Model, modelID, creds)
+
+	// The stream writer runs after this handler has returned, so it gets a
+	// context of its own that is cancelled when the client disconnects.
+	ctx, cancel := middleware.DetachedContext(c)
+
+	setSSEHeaders(c)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+		stream := newSSEStream(ctx, w, cancel)
+		defer stream.close()
+
+		response, err := aiService.StreamChatWithAI(
+			ctx,
+			user.ID.Hex(),
+			clerkUserID,
+			chatReq.SessionID,
+			chatReq.Message,
+			targets,
+			history,
+			citations,
+			func(delta string) error {
+				return stream.send("token", fiber.Map{"content": delta})
+			},
+		)
+
+		// The assistant turn is only persisted once the stream has ended,
+		// keeping whatever was generated if the client went away mid-answer,
+		// so this write must survive the stream's cancellation.
+		var messageID primitive.ObjectID
+		if response != nil && response.Message != "" {
+			aiMessage := models.ChatMessage{
+				SessionID: chatReq.SessionID,
+				UserID:    user.ID,
+				ClerkID:   clerkUserID,
+				Role:      "assistant",
+				Content:   response.Message,
+				Model:     response.Model,
+				ModelID:   response.ModelID,
+				Usage:     response.Usage,
+				Citations: response.Citations,
+				CreatedAt: time.Now(),
+			}
+			result, insertErr := messageCollection.InsertOne(context.WithoutCancel(ctx), aiMessage)
+			if insertErr != nil {
+				log.Printf("Failed to save streamed chat message: %v", insertErr)
+			} else {
+				messageID = result.InsertedID.(primitive.ObjectID)
+			}
+		}
+
+		if response != nil {
+			recordChatUsage(ctx, user, clerkUserID, chatReq.SessionID, "chat", response.Model, response.ModelID, response.Usage)
+		}
+
+		if stream.disconnected() {
+			log.Printf("Chat stream for session %s aborted by client", chatReq.SessionID)
+			return
+		}
+
+		if err != nil {
+			log.Printf("AI service error: %v", err)
+			_, payload := aiErrorPayload("Failed to get AI response", err)
+			stream.send("error", payload)
+			return
+		}
+
+		stream.send("done", fiber.Map{
+			"sessionId":        response.SessionID,
+			"messageId":        messageID,
+			"role":             response.Role,
+			"model":            response.Model,
+			"modelId":          response.ModelID,
+			"fallbackAttempts": response.FallbackAttempts,
+			"memories":         response.Memories,
+			"citations":        response.Citations,
+			"tokenBudget":      response.TokenBudget,
+			"usage":            response.Usage,
+			"budgetWarnings":   budgetWarnings,
+			"createdAt":        response.CreatedAt,
+		})
+	})
+
+	return nil
+}
+
+// ChatWithNoteStream is the streaming counterpart of ChatWithNote.
+func ChatWithNoteStream(c *fiber.Ctx) error {
+	clerkUserID, err := middleware.GetClerkUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+
+	var chatReq NoteChatRequest
+	if err := c.BodyParser(&chatReq); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+			"error":   err.Error(),
+		})
+	}
+
+	if !services.IsSupportedProvider(chatReq.Provider) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Provider must be " + services.SupportedProvidersMessage(),
+		})
+	}
+
+	user, note, creds, modelID, err := loadNoteChatContext(c, chatReq)
+	if err != nil {
+		return err
+	}
+
+	budgetWarnings, err := enforceBudgets(c, user, chatReq.Provider)
+	if err != nil {
+		return err
+	}
+
+	contextPrompt := createNoteContextPrompt(note, chatReq.Message)
+	sessionID := "note-" + note.ID.Hex()
+
+	targets := chatTargets(c, user, chatReq.Provider, modelID, creds)
+
+	// The stream writer runs after this handler has returned, so it gets a
+	// context of its own that is cancelled when the client disconnects.
+	ctx, cancel := middleware.DetachedContext(c)
+
+	setSSEHeaders(c)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+		stream := newSSEStream(ctx, w, cancel)
+		defer stream.close()
+
+		var edits utils.NoteEditsFilter
+		sendText := func(text string) error {
+			if text == "" {
+				return nil
+			}
+			return stream.send("token", fiber.Map{"content": text})
+		}
+
+		response, err := aiService.StreamChatWithAI(
+			ctx,
+			user.ID.Hex(),
+			clerkUserID,
+			sessionID,
+			contextPrompt,
+			targets,
+			nil,
+			nil,
+			func(delta string) error {
+				return sendText(edits.Write(delta))
+			},
+		)
+
+		if response != nil {
+			recordChatUsage(ctx, user, clerkUserID, "", "note-chat", response.Model, response.ModelID, response.Usage)
+		}
+
+		if stream.disconnected() {
+			log.Printf("Note chat stream for note %s aborted by client", note.ID.Hex())
+			return
+		}
+
+		if err != nil {
+			log.Printf("AI service error: %v", err)
+			_, payload := aiErrorPayload("Failed to get AI response", err)
+			stream.send("error", payload)
+			return
+		}
+
+		sendText(edits.Flush())
+		reply := utils.ParseNoteReply(note, response.Message)
+		stream.send("done", fiber.Map{
+			"sessionId":        sessionID,
+			"model":            response.Model,
+			"modelId":          response.ModelID,
+			"fallbackAttempts": response.FallbackAttempts,
+			"noteContext":      note.Title + ": " + note.Content,
+			"message":          reply.Message,
+			"suggestion":       reply.Preview,
+			"edits":            reply.Edits,
+			"editError":        reply.EditError,
+			"noteVersion":      note.Version,
+			"usage":            response.Usage,
+			"budgetWarnings":   budgetWarnings,
+			"createdAt":        response.CreatedAt,
+		})
+	})
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package chat
+
+import (
+	"log"
+	"server/middleware"
+	"server/models"
+	"server/services"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetModelCatalog lists the models available to the caller for every
+// provider, or only ?provider=<name>. Providers the caller has a key for are
+// refreshed from the provider's list-models API; ?refresh=true bypasses the
+// cached list.
+func GetModelCatalog(c *fiber.Ctx) error {
+	user, err := middleware.CurrentUser(c)
+	if err != nil {
+		return err
+	}
+
+	providerNames := services.ProviderNames()
+	if provider := c.Query("provider"); provider != "" {
+		if !services.IsSupportedProvider(provider) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "Provider must be " + services.SupportedProvidersMessage(),
+			})
+		}
+		providerNames = []string{provider}
+	}
+	forceRefresh := c.QueryBool("refresh")
+
+	// Each custom endpoint is its own catalog.
+	type catalogRequest struct {
+		provider string
+		endpoint *models.CustomEndpoint
+		creds    services.Credentials
+	}
+	var requests []catalogRequest
+	for _, provider := range providerNames {
+		if provider != services.CustomProviderName {
+			requests = append(requests, catalogRequest{provider: provider, creds: services.Credentials{APIKey: user.APIKey(provider)}})
+			continue
+		}
+		for i := range user.CustomEndpoints {
+			endpoint := &user.CustomEndpoints[i]
+			requests = append(requests, catalogRequest{
+				provider: provider,
+				endpoint: endpoint,
+				creds:    services.Credentials{APIKey: endpoint.APIKey, BaseURL: endpoint.BaseURL},
+			})
+		}
+	}
+
+	catalogs := make([]services.ProviderCatalog, len(requests))
+	var wg sync.WaitGroup
+	for i, req := range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			catalog, err := services.ModelCatalog(c.UserContext(), req.provider, req.creds, forceRefresh)
+			if err != nil {
+				log.Printf("Failed to build %s model catalog: %v", req.provider, err)
+				return
+			}
+
+			if req.endpoint != nil {
+				catalog.EndpointID = req.endpoint.ID
+				catalog.EndpointName = req.endpoint.Name
+				catalog.DefaultModel = req.endpoint.Model
+				if !catalog.Has(req.endpoint.Model) {
+					catalog.Models = append([]services.CatalogModel{{
+						ID:            req.endpoint.Model,
+						ContextWindow: services.ContextWindow(req.endpoint.Model),
+						Streaming:     catalog.Capabilities.Streaming,
+					}}, catalog.Models...)
+				}
+				for j := range catalog.Models {
+					catalog.Models[j].Default = catalog.Models[j].ID == catalog.DefaultModel
+				}
+			}
+			catalogs[i] = catalog
+		}()
+	}
+	wg.Wait()
+
+	providers := make([]services.ProviderCatalog, 0, len(catalogs))
+	for _, catalog := range catalogs {
+		if catalog.Provider != "" {
+			providers = append(providers, catalog)
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":   "Model catalog retrieved successfully",
+		"providers": providers,
+	})
+}
@@ -1,23 +1,21 @@
 package chat
 
 import (
-	"context"
 	"log"
-	"server/database"
 	"server/middleware"
 	"server/models"
 	"server/services"
+	"server/utils"
 
 	"github.com/gofiber/fiber/v2"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type NoteChatRequest struct {
 	Message  string `json:"message" binding:"required"`
-	Model    string `json:"model" binding:"required"`    // Specific model ID like "gpt-4o-mini" or "gemini-1.5-flash"
-	Provider string `json:"provider" binding:"required"` // "openai" or "gemini"
+	Model    string `json:"model" binding:"required"`    // Specific model ID like "gpt-4o-mini" or "gemini-2.0-flash"
+	Provider string `json:"provider" binding:"required"` // A registered provider name, e.g. "openai"
+
+	EndpointID string `json:"endpointId,omitempty"` // Required when Provider is "custom"
 }
 
 type NoteChatResponse struct {
@@ -25,6 +23,22 @@ type NoteChatResponse struct {
 	Model       string `json:"model"`
 	NoteContext string `json:"noteContext"`
 	Suggestion  string `json:"suggestion,omitempty"`
+
+	ModelID string `json:"modelId,omitempty"`
+
+	// Edits are the structured changes the AI proposed. Suggestion holds the
+	// note content they produce, for clients that still replace the whole
+	// note. EditError explains why proposed edits were dropped.
+	Edits     []models.NoteEdit `json:"edits,omitempty"`
+	EditError string            `json:"editError,omitempty"`
+
+	// NoteVersion is the version the suggestion was made against; send it as
+	// If-Match when applying so edits never land on a different note.
+	NoteVersion int64 `json:"noteVersion"`
+
+	Usage            *models.TokenUsage       `json:"usage,omitempty"`
+	BudgetWarnings   []models.BudgetStatus    `json:"budgetWarnings,omitempty"`
+	FallbackAttempts []models.FallbackAttempt `json:"fallbackAttempts,omitempty"`
 }
 
 func ChatWithNote(c *fiber.Ctx) error {
@@ -33,13 +47,6 @@ func ChatWithNote(c *fiber.Ctx) error {
 		return err
 	}
 
-	noteID := c.Params("id")
-	if noteID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Note ID is required",
-		})
-	}
-
 	var chatReq NoteChatRequest
 	if err := c.BodyParser(&chatReq); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -48,67 +55,20 @@ func ChatWithNote(c *fiber.Ctx) error {
 		})
 	}
 
-	if chatReq.Provider != "openai" && chatReq.Provider != "gemini" {
+	if !services.IsSupportedProvider(chatReq.Provider) {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Provider must be 'openai' or 'gemini'",
+			"message": "Provider must be " + services.SupportedProvidersMessage(),
 		})
 	}
 
-	db, err := database.Connect()
-	if err != nil {
-		log.Printf("Database connection error: %v", err)
-		return c.Status(500).JSON(fiber.Map{"message": "Database connection failed"})
-	}
-
-	// Get user to access API keys
-	userCollection := db.Collection("users")
-	var user models.User
-	err = userCollection.FindOne(context.Background(), bson.M{"clerkId": clerkUserID}).Decode(&user)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"message": "User profile not found. Please create your profile first.",
-			})
-		}
-		return c.Status(500).JSON(fiber.Map{"message": "Failed to find user"})
-	}
-
-	// Get note
-	noteObjID, err := primitive.ObjectIDFromHex(noteID)
+	user, note, creds, modelID, err := loadNoteChatContext(c, chatReq)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Invalid note ID",
-		})
+		return err
 	}
 
-	notesCollection := db.Collection("notes")
-	var note models.Note
-	err = notesCollection.FindOne(context.Background(), bson.M{
-		"_id":    noteObjID,
-		"userId": user.ID,
-	}).Decode(&note)
+	budgetWarnings, err := enforceBudgets(c, user, chatReq.Provider)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"message": "Note not found",
-			})
-		}
-		return c.Status(500).JSON(fiber.Map{"message": "Failed to find note"})
-	}
-
-	// Get API key for the selected model
-	var apiKey string
-	switch chatReq.Provider {
-	case "openai":
-		apiKey = user.OpenAIKey
-	case "gemini":
-		apiKey = user.GeminiKey
-	}
-
-	if apiKey == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "No " + chatReq.Provider + " API key found. Please add your API key in profile settings.",
-		})
+		return err
 	}
 
 	// Create context-aware prompt
@@ -116,50 +76,97 @@ func ChatWithNote(c *fiber.Ctx) error {
 
 	// Get AI response using the existing ChatWithAI method with specific model ID
 	aiService := services.NewAIService()
-	sessionID := "note-" + noteID // Create a unique session ID for note-specific chats
+	sessionID := "note-" + note.ID.Hex() // Create a unique session ID for note-specific chats
 	response, err := aiService.ChatWithAI(
+		c.UserContext(),
 		user.ID.Hex(),
 		clerkUserID,
 		sessionID,
 		contextPrompt,
-		chatReq.Model,    // Pass the specific model ID
-		chatReq.Provider, // Pass the provider
-		apiKey,
+		chatTargets(c, user, chatReq.Provider, modelID, creds),
+		nil, // Note chats are not stored as session turns
+		nil,
 	)
 	if err != nil {
 		log.Printf("AI service error: %v", err)
-		return c.Status(500).JSON(fiber.Map{
-			"message": "Failed to get AI response",
-			"error":   err.Error(),
-		})
+		return respondAIError(c, "Failed to get AI response", err)
 	}
 
+	recordChatUsage(c.UserContext(), user, clerkUserID, "", "note-chat", response.Model, response.ModelID, response.Usage)
+
+	reply := utils.ParseNoteReply(note, response.Message)
+
 	chatResponse := NoteChatResponse{
-		Message:     response.Message,
-		Model:       chatReq.Provider, // Keep using provider for backward compatibility
+		Message:     reply.Message,
+		Model:       response.Model, // Keep using provider for backward compatibility
+		ModelID:     response.ModelID,
 		NoteContext: note.Title + ": " + note.Content,
-		Suggestion:  response.Message, // The AI response can be applied as a suggestion
+		Suggestion:  reply.Preview,
+		Edits:       reply.Edits,
+		EditError:   reply.EditError,
+		NoteVersion: note.Version,
+		Usage:       response.Usage,
+
+		BudgetWarnings:   budgetWarnings,
+		FallbackAttempts: response.FallbackAttempts,
 	}
 
 	return c.Status(fiber.StatusOK).JSON(chatResponse)
 }
 
+// loadNoteChatContext returns the caller, the note authorized for the route
+// and the credentials and model for the requested provider.
+func loadNoteChatContext(c *fiber.Ctx, chatReq NoteChatRequest) (models.User, models.Note, services.Credentials, string, error) {
+	var creds services.Credentials
+
+	user, err := middleware.CurrentUser(c)
+	if err != nil {
+		return user, models.Note{}, creds, "", err
+	}
+
+	note, err := middleware.CurrentNote(c)
+	if err != nil {
+		return user, note, creds, "", err
+	}
+
+	// Get credentials for the selected provider
+	creds, modelID, err := resolveCredentials(user, chatReq.Provider, chatReq.Model, chatReq.EndpointID)
+	if err != nil {
+		return user, note, creds, "", err
+	}
+
+	if err := validateModelSelection(c.UserContext(), chatReq.Provider, chatReq.Model, creds); err != nil {
+		return user, note, creds, "", err
+	}
+
+	return user, note, creds, modelID, nil
+}
+
 func createNoteContextPrompt(note models.Note, userMessage string) string {
 	return `You are a direct, no-nonsense AI assistant for note enhancement. 
 
 RESPONSE RULES:
 - NEVER start with "Here's", "Okay", "I understand", "Sure", or similar conversational phrases
 - NEVER include meta-commentary or explanations about what you're doing
-- Provide direct, actionable content that can be immediately used
-- If asked to add items to a list, provide only the new items in the same format
-- If asked to improve content, provide the improved version directly
 - Be concise, factual, and focused
+- Answer the request in plain text first
+
+EDITING THE NOTE:
+When the request asks to change the note, end your answer with a block listing the edits as a JSON array:
+` + utils.NoteEditsFence + `
+[{"op": "append_list_items", "heading": "Groceries", "items": ["bread"]}]
+` + "```" + `
+Available operations:
+- {"op": "insert_after_heading", "heading": "<existing heading text>", "content": "<markdown>"}
+- {"op": "replace_paragraph", "target": "<exact current paragraph or line>", "content": "<replacement markdown>"}
+- {"op": "delete_paragraph", "target": "<exact current paragraph or line>"}
+- {"op": "append_list_items", "heading": "<optional heading of the section holding the list>", "items": ["<item>"]}
+- {"op": "append", "content": "<markdown added at the end>"}
+Copy targets and headings exactly from the note. Never rewrite parts of the note that the request does not touch. Leave the block out when nothing should change.
 
 CURRENT NOTE:
 Title: ` + note.Title + `
 Content: ` + note.Content + `
 
-USER REQUEST: ` + userMessage + `
-
-Provide a direct response that addresses the request without conversational elements:`
+USER REQUEST: ` + userMessage
 }
@@ -0,0 +1,117 @@
+package chat
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// sseKeepAliveInterval is how often a comment is written while the provider
+// is silent, so that a client that has gone away is noticed promptly.
+const sseKeepAliveInterval = 10 * time.Second
+
+var errClientGone = errors.New("client disconnected")
+
+func setSSEHeaders(c *fiber.Ctx) {
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+}
+
+// writeSSE writes a single named event and flushes it to the client. A flush
+// error means the client has disconnected.
+func writeSSE(w *bufio.Writer, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// sseStream serializes writes to a stream response and cancels the stream's
+// context on the first failed write, which is how a client disconnect shows
+// up. Cancelling aborts the provider call and any work waiting on it.
+type sseStream struct {
+	mu     sync.Mutex
+	w      *bufio.Writer
+	cancel context.CancelFunc
+	gone   bool
+	closed bool
+}
+
+// newSSEStream starts the keep-alive loop for w; close must be called once
+// the stream is finished.
+func newSSEStream(ctx context.Context, w *bufio.Writer, cancel context.CancelFunc) *sseStream {
+	stream := &sseStream{w: w, cancel: cancel}
+	go stream.keepAlive(ctx)
+	return stream
+}
+
+func (s *sseStream) send(event string, data interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.gone || s.closed {
+		return errClientGone
+	}
+	if err := writeSSE(s.w, event, data); err != nil {
+		s.disconnect()
+		return errClientGone
+	}
+	return nil
+}
+
+func (s *sseStream) keepAlive(ctx context.Context) {
+	ticker := time.NewTicker(sseKeepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		s.mu.Lock()
+		if s.gone || s.closed {
+			s.mu.Unlock()
+			return
+		}
+		if _, err := s.w.WriteString(": keep-alive\n\n"); err != nil || s.w.Flush() != nil {
+			s.disconnect()
+		}
+		s.mu.Unlock()
+	}
+}
+
+// disconnect must be called with mu held.
+func (s *sseStream) disconnect() {
+	s.gone = true
+	s.cancel()
+}
+
+// disconnected reports whether the client went away during the stream.
+func (s *sseStream) disconnected() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.gone
+}
+
+// close stops the keep-alive loop. The response writer must not be used
+// after the stream writer function returns.
+func (s *sseStream) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+}
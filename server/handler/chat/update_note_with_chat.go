@@ -1,17 +1,17 @@
 package chat
 
 import (
-	"context"
-	"fmt"
+	"errors"
 	"log"
 	"server/database"
 	"server/middleware"
 	"server/models"
+	"server/services"
+	"server/utils"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
@@ -29,9 +29,9 @@ func UpdateNoteWithChat(c *fiber.Ctx) error {
 		})
 	}
 
-	if updateReq.Model != "openai" && updateReq.Model != "gemini" {
+	if !services.IsSupportedProvider(updateReq.Model) {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Model must be 'openai' or 'gemini'",
+			"message": "Model must be " + services.SupportedProvidersMessage(),
 		})
 	}
 
@@ -41,82 +41,107 @@ func UpdateNoteWithChat(c *fiber.Ctx) error {
 		return c.Status(500).JSON(fiber.Map{"message": "Database connection failed"})
 	}
 
-	userCollection := db.Collection("users")
-	var user models.User
-	err = userCollection.FindOne(context.Background(), bson.M{"clerkId": clerkUserID}).Decode(&user)
+	user, err := middleware.CurrentUser(c)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"message": "Failed to find user"})
+		return err
 	}
 
-	var apiKey string
-	switch updateReq.Model {
-	case "openai":
-		apiKey = user.OpenAIKey
-	case "gemini":
-		apiKey = user.GeminiKey
+	note, err := middleware.CurrentNote(c)
+	if err != nil {
+		return err
 	}
 
-	if apiKey == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": fmt.Sprintf("No %s API key found", updateReq.Model),
-		})
+	creds, modelID, err := resolveCredentials(user, updateReq.Model, updateReq.ModelID, updateReq.EndpointID)
+	if err != nil {
+		return err
 	}
 
-	noteID, err := primitive.ObjectIDFromHex(updateReq.NoteID)
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Invalid note ID format",
-		})
+	if err := validateModelSelection(c.UserContext(), updateReq.Model, updateReq.ModelID, creds); err != nil {
+		return err
 	}
 
-	noteCollection := db.Collection("notes")
-	var note models.Note
-	err = noteCollection.FindOne(context.Background(), bson.M{
-		"_id":    noteID,
-		"userId": user.ID,
-	}).Decode(&note)
+	budgetWarnings, err := enforceBudgets(c, user, updateReq.Model)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"message": "Note not found",
-			})
-		}
-		return c.Status(500).JSON(fiber.Map{"message": "Failed to retrieve note"})
+		return err
 	}
 
-	updatedContent, err := aiService.UpdateNoteWithAI(
+	// Refuse before spending tokens if the client is already behind.
+	if err := utils.CheckNoteVersion(note, c.Get(fiber.HeaderIfMatch), updateReq.Version); err != nil {
+		return err
+	}
+
+	update, err := aiService.UpdateNoteWithAI(
+		c.UserContext(),
 		user.ID.Hex(),
 		clerkUserID,
 		updateReq.SessionID,
-		updateReq.NoteID,
+		note.ID.Hex(),
 		note.Content,
-		updateReq.Model,
-		apiKey,
+		chatTargets(c, user, updateReq.Model, modelID, creds),
 		updateReq.Prompt,
 	)
 	if err != nil {
 		log.Printf("AI update error: %v", err)
-		return c.Status(500).JSON(fiber.Map{
-			"message": "Failed to update note with AI",
-			"error":   err.Error(),
-		})
+		return respondAIError(c, "Failed to update note with AI", err)
 	}
 
-	note.Content = updatedContent
-	note.UpdatedAt = time.Now()
+	recordChatUsage(c.UserContext(), user, clerkUserID, "", "note-update", update.Provider, update.ModelID, &update.Usage)
 
-	_, err = noteCollection.ReplaceOne(context.Background(), bson.M{"_id": noteID}, note)
+	// The model took a while; only save if nobody changed the note meanwhile.
+	// On conflict the rewrite is returned so the client can offer it again.
+	updatedNote, err := utils.UpdateNoteAtVersion(c.UserContext(), db, note, bson.M{
+		"content":   update.Content,
+		"updatedAt": time.Now(),
+	})
 	if err != nil {
+		var conflict *utils.NoteVersionConflictError
+		if errors.As(err, &conflict) {
+			c.Set(fiber.HeaderETag, utils.NoteETag(conflict.Current.Version))
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":          true,
+				"code":           "version_conflict",
+				"message":        conflict.Error(),
+				"currentVersion": conflict.Current.Version,
+				"note":           conflict.Current,
+				"suggestion":     update.Content,
+				"model":          update.Provider,
+				"modelId":        update.ModelID,
+				"usage":          update.Usage,
+			})
+		}
+		if err == mongo.ErrNoDocuments {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Note not found"})
+		}
+		log.Printf("Failed to save updated note: %v", err)
 		return c.Status(500).JSON(fiber.Map{"message": "Failed to save updated note"})
 	}
 
+	_, err = utils.RecordNoteRevision(c.UserContext(), db, &note, *updatedNote, models.NoteRevision{
+		Source:   models.RevisionSourceAIChat,
+		Author:   clerkUserID,
+		Provider: update.Provider,
+		ModelID:  update.ModelID,
+	})
+	if err != nil {
+		log.Printf("Failed to record note revision: %v", err)
+	}
+
+	services.IndexNoteInBackground(c.UserContext(), user, updatedNote.ID)
+
+	c.Set(fiber.HeaderETag, utils.NoteETag(updatedNote.Version))
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "Note updated successfully with AI assistance",
 		"note": fiber.Map{
-			"id":        note.ID,
-			"title":     note.Title,
-			"content":   note.Content,
-			"updatedAt": note.UpdatedAt,
+			"id":        updatedNote.ID,
+			"title":     updatedNote.Title,
+			"content":   updatedNote.Content,
+			"updatedAt": updatedNote.UpdatedAt,
+			"version":   updatedNote.Version,
 		},
+		"model":            update.Provider,
+		"modelId":          update.ModelID,
+		"usage":            update.Usage,
+		"budgetWarnings":   budgetWarnings,
+		"fallbackAttempts": update.FallbackAttempts,
 	})
 }
@@ -0,0 +1,268 @@
+package notebooks
+
+import (
+	"errors"
+	"log"
+	"server/database"
+	"server/middleware"
+	"server/models"
+	"server/utils"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ListNotebooks returns the caller's notebooks as a tree, with the number of
+// notes filed directly in each.
+func ListNotebooks(c *fiber.Ctx) error {
+	db, user, err := connect(c)
+	if err != nil {
+		return err
+	}
+
+	notebooks, err := utils.ListUserNotebooks(c.UserContext(), db, user.ID)
+	if err != nil {
+		log.Printf("Failed to list notebooks: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Failed to retrieve notebooks"})
+	}
+
+	counts, err := utils.CountNotesByNotebook(c.UserContext(), db, user.ID)
+	if err != nil {
+		log.Printf("Failed to count notebook notes: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Failed to retrieve notebooks"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":   "Notebooks retrieved successfully",
+		"notebooks": utils.NotebookTree(notebooks, counts),
+		"count":     len(notebooks),
+	})
+}
+
+func CreateNotebook(c *fiber.Ctx) error {
+	var notebookReq models.NotebookRequest
+	if err := c.BodyParser(&notebookReq); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+			"error":   err.Error(),
+		})
+	}
+
+	if notebookReq.Name == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Name is required"})
+	}
+	name, err := notebookName(*notebookReq.Name)
+	if err != nil {
+		return err
+	}
+
+	var parentID *primitive.ObjectID
+	if notebookReq.ParentID != nil {
+		if parentID, err = notebookParent(*notebookReq.ParentID); err != nil {
+			return err
+		}
+	}
+
+	db, user, err := connect(c)
+	if err != nil {
+		return err
+	}
+
+	if err := checkParent(c, db, user, nil, parentID); err != nil {
+		return err
+	}
+
+	notebook := models.Notebook{
+		UserID:    user.ID,
+		Name:      name,
+		ParentID:  parentID,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	result, err := db.Collection("notebooks").InsertOne(c.UserContext(), notebook)
+	if err != nil {
+		log.Printf("Failed to create notebook: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Failed to create notebook"})
+	}
+	notebook.ID = result.InsertedID.(primitive.ObjectID)
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":  "Notebook created successfully",
+		"notebook": notebook,
+	})
+}
+
+func GetNotebook(c *fiber.Ctx) error {
+	notebook, err := middleware.CurrentNotebook(c)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":  "Notebook retrieved successfully",
+		"notebook": notebook,
+	})
+}
+
+// UpdateNotebook renames a notebook or moves it, with everything in it,
+// under another parent.
+func UpdateNotebook(c *fiber.Ctx) error {
+	notebook, err := middleware.CurrentNotebook(c)
+	if err != nil {
+		return err
+	}
+
+	var notebookReq models.NotebookRequest
+	if err := c.BodyParser(&notebookReq); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+			"error":   err.Error(),
+		})
+	}
+
+	db, user, err := connect(c)
+	if err != nil {
+		return err
+	}
+
+	updateFields := bson.M{"updatedAt": time.Now()}
+
+	if notebookReq.Name != nil {
+		name, err := notebookName(*notebookReq.Name)
+		if err != nil {
+			return err
+		}
+		updateFields["name"] = name
+		notebook.Name = name
+	}
+
+	if notebookReq.ParentID != nil {
+		parentID, err := notebookParent(*notebookReq.ParentID)
+		if err != nil {
+			return err
+		}
+		if err := checkParent(c, db, user, &notebook.ID, parentID); err != nil {
+			return err
+		}
+		updateFields["parentId"] = parentID
+		notebook.ParentID = parentID
+	}
+
+	notebook.UpdatedAt = updateFields["updatedAt"].(time.Time)
+
+	_, err = db.Collection("notebooks").UpdateOne(c.UserContext(),
+		bson.M{"_id": notebook.ID, "userId": user.ID},
+		bson.M{"$set": updateFields},
+	)
+	if err != nil {
+		log.Printf("Failed to update notebook: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Failed to update notebook"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":  "Notebook updated successfully",
+		"notebook": notebook,
+	})
+}
+
+// DeleteNotebook deletes a notebook. By default (?mode=move) its notes and
+// child notebooks move up to its parent; ?mode=cascade deletes its whole
+// subtree and moves the notes in it to the trash.
+func DeleteNotebook(c *fiber.Ctx) error {
+	notebook, err := middleware.CurrentNotebook(c)
+	if err != nil {
+		return err
+	}
+
+	mode := c.Query("mode", models.NotebookDeleteMove)
+	if mode != models.NotebookDeleteMove && mode != models.NotebookDeleteCascade {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "mode must be " + models.NotebookDeleteMove + " or " + models.NotebookDeleteCascade,
+		})
+	}
+
+	db, user, err := connect(c)
+	if err != nil {
+		return err
+	}
+
+	notebooks, err := utils.ListUserNotebooks(c.UserContext(), db, user.ID)
+	if err != nil {
+		log.Printf("Failed to list notebooks: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Failed to delete notebook"})
+	}
+
+	result, err := utils.DeleteNotebook(c.UserContext(), db, notebook, mode, notebooks)
+	if err != nil {
+		log.Printf("Failed to delete notebook: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Failed to delete notebook"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Notebook deleted successfully",
+		"result":  result,
+	})
+}
+
+func connect(c *fiber.Ctx) (*mongo.Database, models.User, error) {
+	user, err := middleware.CurrentUser(c)
+	if err != nil {
+		return nil, user, err
+	}
+
+	db, err := database.Connect()
+	if err != nil {
+		log.Printf("Database connection error: %v", err)
+		return nil, user, fiber.NewError(fiber.StatusInternalServerError, "Database connection failed")
+	}
+	return db, user, nil
+}
+
+func notebookName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fiber.NewError(fiber.StatusBadRequest, "Name is required")
+	}
+	if utf8.RuneCountInString(name) > utils.MaxNotebookNameLength {
+		return "", fiber.NewError(fiber.StatusBadRequest, "Name is too long")
+	}
+	return name, nil
+}
+
+// notebookParent parses a parentId, where "" means the top level.
+func notebookParent(id string) (*primitive.ObjectID, error) {
+	if id == "" {
+		return nil, nil
+	}
+	parentID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid parent notebook ID format")
+	}
+	return &parentID, nil
+}
+
+// checkParent validates placing the notebook id (nil for a new notebook)
+// under parentID among the caller's notebooks.
+func checkParent(c *fiber.Ctx, db *mongo.Database, user models.User, id, parentID *primitive.ObjectID) error {
+	notebooks, err := utils.ListUserNotebooks(c.UserContext(), db, user.ID)
+	if err != nil {
+		log.Printf("Failed to list notebooks: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve notebooks")
+	}
+
+	err = utils.ValidateNotebookParent(notebooks, id, parentID)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, utils.ErrNotebookNotFound):
+		return fiber.NewError(fiber.StatusNotFound, "Parent notebook not found")
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+}
@@ -1,122 +1,138 @@
 package notes
 
 import (
-	"context"
+	"errors"
 	"log"
-	"server/database"
-	"server/middleware"
 	"server/models"
+	"server/services"
+	"server/utils"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-type SuggestionRequest struct {
-	NewTitle   string `json:"newTitle,omitempty"`
-	NewContent string `json:"newContent,omitempty"`
-}
-
+// ApplySuggestion applies a suggestion to the note as it is now. Edits are
+// applied all or nothing, and the write only succeeds if the note is still at
+// the version it was read at, or at the one named by If-Match.
 func ApplySuggestion(c *fiber.Ctx) error {
-	clerkUserID, err := middleware.GetClerkUserIDFromContext(c)
+	db, user, note, suggestion, err := loadSuggestion(c)
 	if err != nil {
 		return err
 	}
 
-	noteID := c.Params("id")
-	if noteID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Note ID is required",
-		})
+	if err := utils.CheckNoteVersion(note, c.Get(fiber.HeaderIfMatch), nil); err != nil {
+		return err
 	}
 
-	var suggestionReq SuggestionRequest
-	if err := c.BodyParser(&suggestionReq); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Invalid request body",
-			"error":   err.Error(),
-		})
+	title, content, err := applySuggestion(note, suggestion)
+	if err != nil {
+		return respondEditError(c, err)
 	}
 
-	// At least one field should be provided
-	if suggestionReq.NewTitle == "" && suggestionReq.NewContent == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "At least one field (newTitle or newContent) must be provided",
-		})
+	updatedNote, err := utils.UpdateNoteAtVersion(c.UserContext(), db, note, bson.M{
+		"title":     title,
+		"content":   content,
+		"updatedAt": time.Now(),
+	})
+	if err != nil {
+		return noteWriteError(err)
 	}
 
-	db, err := database.Connect()
+	_, err = utils.RecordNoteRevision(c.UserContext(), db, &note, *updatedNote, models.NoteRevision{
+		Source: models.RevisionSourceSuggestion,
+		Author: user.ClerkID,
+	})
 	if err != nil {
-		log.Printf("Database connection error: %v", err)
-		return c.Status(500).JSON(fiber.Map{"message": "Database connection failed"})
+		log.Printf("Failed to record note revision: %v", err)
 	}
 
-	// Get user to verify ownership
-	userCollection := db.Collection("users")
-	var user models.User
-	err = userCollection.FindOne(context.Background(), bson.M{"clerkId": clerkUserID}).Decode(&user)
+	services.IndexNoteInBackground(c.UserContext(), user, updatedNote.ID)
+
+	c.Set(fiber.HeaderETag, utils.NoteETag(updatedNote.Version))
+	return c.Status(fiber.StatusOK).JSON(updatedNote)
+}
+
+// PreviewSuggestion shows what ApplySuggestion would do to the note without
+// changing it.
+func PreviewSuggestion(c *fiber.Ctx) error {
+	_, _, note, suggestion, err := loadSuggestion(c)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"message": "User profile not found",
-			})
-		}
-		return c.Status(500).JSON(fiber.Map{"message": "Failed to find user"})
+		return err
 	}
 
-	// Convert noteID to ObjectID
-	noteObjID, err := primitive.ObjectIDFromHex(noteID)
+	title, content, err := applySuggestion(note, suggestion)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Invalid note ID",
-		})
+		return respondEditError(c, err)
 	}
 
-	// Update the note
-	notesCollection := db.Collection("notes")
+	diff := utils.DiffLines(note.Content, content)
+
+	// Applying with If-Match set to this ETag guarantees the note gets
+	// exactly the previewed change.
+	c.Set(fiber.HeaderETag, utils.NoteETag(note.Version))
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Suggestion preview generated successfully",
+		"noteId":  note.ID,
+		"version": note.Version,
+		"title":   title,
+		"content": content,
+		"diff":    utils.UnifiedDiff(note.Content, content, 3),
+		"lines":   diff,
+		"stats":   utils.CountDiff(diff),
+	})
+}
 
-	updateFields := bson.M{
-		"updatedAt": time.Now(),
+// loadSuggestion parses the suggestion in the request body and loads the
+// caller's note it targets.
+func loadSuggestion(c *fiber.Ctx) (*mongo.Database, models.User, models.Note, models.NoteSuggestion, error) {
+	var suggestion models.NoteSuggestion
+	if err := c.BodyParser(&suggestion); err != nil {
+		return nil, models.User{}, models.Note{}, suggestion, fiber.NewError(fiber.StatusBadRequest, "Invalid request body: "+err.Error())
 	}
 
-	if suggestionReq.NewTitle != "" {
-		updateFields["title"] = suggestionReq.NewTitle
+	if suggestion.NewTitle == "" && suggestion.NewContent == "" && len(suggestion.Edits) == 0 {
+		return nil, models.User{}, models.Note{}, suggestion, fiber.NewError(fiber.StatusBadRequest, "At least one of newTitle, edits or newContent must be provided")
 	}
-
-	if suggestionReq.NewContent != "" {
-		updateFields["content"] = suggestionReq.NewContent
+	if suggestion.NewContent != "" && len(suggestion.Edits) > 0 {
+		return nil, models.User{}, models.Note{}, suggestion, fiber.NewError(fiber.StatusBadRequest, "edits and newContent cannot be combined")
 	}
 
-	filter := bson.M{
-		"_id":    noteObjID,
-		"userId": user.ID,
-	}
+	db, user, note, err := loadOwnedNote(c)
+	return db, user, note, suggestion, err
+}
 
-	update := bson.M{
-		"$set": updateFields,
+// applySuggestion returns the title and content the note would have after
+// suggestion.
+func applySuggestion(note models.Note, suggestion models.NoteSuggestion) (string, string, error) {
+	title, content := note.Title, note.Content
+	if suggestion.NewTitle != "" {
+		title = suggestion.NewTitle
 	}
-
-	result, err := notesCollection.UpdateOne(context.Background(), filter, update)
-	if err != nil {
-		log.Printf("Failed to update note: %v", err)
-		return c.Status(500).JSON(fiber.Map{"message": "Failed to update note"})
+	if suggestion.NewContent != "" {
+		content = suggestion.NewContent
 	}
 
-	if result.MatchedCount == 0 {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"message": "Note not found or you don't have permission to update it",
-		})
+	if len(suggestion.Edits) > 0 {
+		var err error
+		content, err = utils.ApplyNoteEdits(note.Content, suggestion.Edits)
+		if err != nil {
+			return "", "", err
+		}
 	}
+	return title, content, nil
+}
 
-	// Get the updated note
-	var updatedNote models.Note
-	err = notesCollection.FindOne(context.Background(), filter).Decode(&updatedNote)
-	if err != nil {
-		log.Printf("Failed to fetch updated note: %v", err)
-		return c.Status(500).JSON(fiber.Map{"message": "Note updated but failed to fetch updated version"})
+// respondEditError reports edits that do not apply as 422 with the failing
+// edit.
+func respondEditError(c *fiber.Ctx, err error) error {
+	var editErr *utils.NoteEditError
+	if !errors.As(err, &editErr) {
+		return err
 	}
-
-	return c.Status(fiber.StatusOK).JSON(updatedNote)
+	return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+		"message": "The suggestion does not apply to the current note: " + editErr.Error(),
+		"edit":    editErr,
+	})
 }
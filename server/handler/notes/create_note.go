@@ -1,18 +1,16 @@
 package notes
 
 import (
-	"context"
 	"log"
 	"server/database"
 	"server/middleware"
 	"server/models"
+	"server/services"
 	"server/utils"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func CreateNote(c *fiber.Ctx) error {
@@ -22,8 +20,10 @@ func CreateNote(c *fiber.Ctx) error {
 	}
 
 	type NoteRequest struct {
-		Title   string `json:"title"`
-		Content string `json:"content"`
+		Title      string   `json:"title"`
+		Content    string   `json:"content"`
+		Tags       []string `json:"tags"`
+		NotebookID string   `json:"notebookId"`
 	}
 
 	noteReq := new(NoteRequest)
@@ -47,73 +47,97 @@ func CreateNote(c *fiber.Ctx) error {
 		noteReq.Content = " "
 	}
 
+	tags, err := utils.NormalizeTags(noteReq.Tags)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
 	db, err := database.Connect()
 	if err != nil {
 		log.Printf("Database connection error: %v", err)
 		return c.Status(500).JSON(fiber.Map{"message": "Database connection failed"})
 	}
 
-	userCollection := db.Collection("users")
-	var user models.User
-	err = userCollection.FindOne(context.Background(), bson.M{"clerkId": clerkUserID}).Decode(&user)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			log.Printf("User not found, creating profile for clerkID: %s", clerkUserID)
-			user = models.User{
-				ClerkID:   clerkUserID,
-				Email:     "",
-				Username:  "",
-				FirstName: "",
-				LastName:  "",
-				CreatedAt: time.Now(),
-				UpdatedAt: time.Now(),
-				NoteIds:   []primitive.ObjectID{},
-			}
-
-			result, createErr := userCollection.InsertOne(context.Background(), user)
-			if createErr != nil {
-				log.Printf("Failed to create user profile: %v", createErr)
-				return c.Status(500).JSON(fiber.Map{"message": "Failed to create user profile"})
-			}
-			user.ID = result.InsertedID.(primitive.ObjectID)
-			log.Printf("Created user profile with ID: %s", user.ID.Hex())
-		} else {
-			log.Printf("Failed to find user: %v", err)
-			return c.Status(500).JSON(fiber.Map{"message": "Failed to find user"})
+	user, err := middleware.CurrentUser(c)
+	if err == middleware.ErrUserProfileNotFound {
+		userCollection := db.Collection("users")
+		log.Printf("User not found, creating profile for clerkID: %s", clerkUserID)
+		user = models.User{
+			ClerkID:   clerkUserID,
+			Email:     "",
+			Username:  "",
+			FirstName: "",
+			LastName:  "",
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+			NoteIds:   []primitive.ObjectID{},
+		}
+
+		result, createErr := userCollection.InsertOne(c.UserContext(), user)
+		if createErr != nil {
+			log.Printf("Failed to create user profile: %v", createErr)
+			return c.Status(500).JSON(fiber.Map{"message": "Failed to create user profile"})
 		}
+		user.ID = result.InsertedID.(primitive.ObjectID)
+		log.Printf("Created user profile with ID: %s", user.ID.Hex())
+	}
+
+	notebookID, err := resolveNotebook(c, db, user, noteReq.NotebookID)
+	if err != nil {
+		return err
 	}
 
 	note := models.Note{
-		Title:     noteReq.Title,
-		Content:   noteReq.Content,
-		UserID:    user.ID,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		Title:      noteReq.Title,
+		Content:    noteReq.Content,
+		Tags:       tags,
+		NotebookID: notebookID,
+		UserID:     user.ID,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+		Version:    1,
 	}
 
 	collection := db.Collection("notes")
-	result, err := collection.InsertOne(context.Background(), note)
+	result, err := collection.InsertOne(c.UserContext(), note)
 	if err != nil {
 		log.Printf("Failed to create note: %v", err)
 		return c.Status(500).JSON(fiber.Map{"message": "Failed to create note"})
 	}
 
 	noteID := result.InsertedID.(primitive.ObjectID)
+	note.ID = noteID
+
+	_, err = utils.RecordNoteRevision(c.UserContext(), db, nil, note, models.NoteRevision{
+		Source: models.RevisionSourceManual,
+		Author: clerkUserID,
+	})
+	if err != nil {
+		log.Printf("Failed to record note revision: %v", err)
+	}
+
+	services.IndexNoteInBackground(c.UserContext(), user, noteID)
 
-	if err := utils.AddNoteToUser(db, user.ID, noteID); err != nil {
+	if err := utils.AddNoteToUser(c.UserContext(), db, user.ID, noteID); err != nil {
 		log.Printf("Failed to add note to user: %v", err)
 	}
 
+	c.Set(fiber.HeaderETag, utils.NoteETag(note.Version))
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"message": "Note created successfully",
 		"noteId":  noteID,
 		"note": fiber.Map{
-			"id":        noteID,
-			"title":     note.Title,
-			"content":   note.Content,
-			"userId":    note.UserID,
-			"createdAt": note.CreatedAt,
-			"updatedAt": note.UpdatedAt,
+			"id":         noteID,
+			"title":      note.Title,
+			"content":    note.Content,
+			"tags":       note.Tags,
+			"notebookId": note.NotebookID,
+			"userId":     note.UserID,
+			"createdAt":  note.CreatedAt,
+			"updatedAt":  note.UpdatedAt,
+			"version":    note.Version,
 		},
 	})
 }
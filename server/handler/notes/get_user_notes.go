@@ -1,18 +1,21 @@
 package notes
 
 import (
-	"context"
 	"log"
 	"server/database"
 	"server/middleware"
 	"server/models"
 	"server/utils"
+	"strconv"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	defaultNotePageSize = 50
+	maxNotePageSize     = 200
 )
 
 func GetUserNotes(c *fiber.Ctx) error {
@@ -27,55 +30,140 @@ func GetUserNotes(c *fiber.Ctx) error {
 		return c.Status(500).JSON(fiber.Map{"message": "Database connection failed"})
 	}
 
-	userCollection := db.Collection("users")
-	var user models.User
-	err = userCollection.FindOne(context.Background(), bson.M{"clerkId": clerkUserID}).Decode(&user)
+	user, err := middleware.CurrentUser(c)
+	if err == middleware.ErrUserProfileNotFound {
+		userCollection := db.Collection("users")
+		log.Printf("User not found, creating profile for clerkID: %s", clerkUserID)
+		user = models.User{
+			ClerkID:   clerkUserID,
+			Email:     "",
+			Username:  "",
+			FirstName: "",
+			LastName:  "",
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+			NoteIds:   []primitive.ObjectID{},
+		}
+
+		result, createErr := userCollection.InsertOne(c.UserContext(), user)
+		if createErr != nil {
+			log.Printf("Failed to create user profile: %v", createErr)
+			return c.Status(500).JSON(fiber.Map{"message": "Failed to create user profile"})
+		}
+		user.ID = result.InsertedID.(primitive.ObjectID)
+		log.Printf("Created user profile with ID: %s", user.ID.Hex())
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message":    "Notes retrieved successfully",
+			"notes":      []models.Note{},
+			"count":      0,
+			"total":      0,
+			"nextCursor": nil,
+		})
+	}
+
+	opts, err := noteListOptions(c)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			log.Printf("User not found, creating profile for clerkID: %s", clerkUserID)
-			user = models.User{
-				ClerkID:   clerkUserID,
-				Email:     "",
-				Username:  "",
-				FirstName: "",
-				LastName:  "",
-				CreatedAt: time.Now(),
-				UpdatedAt: time.Now(),
-				NoteIds:   []primitive.ObjectID{},
-			}
-
-			result, createErr := userCollection.InsertOne(context.Background(), user)
-			if createErr != nil {
-				log.Printf("Failed to create user profile: %v", createErr)
-				return c.Status(500).JSON(fiber.Map{"message": "Failed to create user profile"})
-			}
-			user.ID = result.InsertedID.(primitive.ObjectID)
-			log.Printf("Created user profile with ID: %s", user.ID.Hex())
-
-			return c.Status(fiber.StatusOK).JSON(fiber.Map{
-				"message": "Notes retrieved successfully",
-				"notes":   []models.Note{},
-				"count":   0,
-			})
-		} else {
-			log.Printf("Failed to find user: %v", err)
-			return c.Status(500).JSON(fiber.Map{"message": "Failed to find user"})
+		return err
+	}
+
+	filter := &opts.Filter
+	if tag := c.Query("tag"); tag != "" {
+		filter.Tag, err = utils.NormalizeTag(tag)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+		}
+	}
+	filter.Favorites = c.QueryBool("favorites")
+	switch filter.Archived = c.Query("archived"); filter.Archived {
+	case utils.ArchivedExclude, utils.ArchivedInclude, utils.ArchivedOnly:
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "archived must be include or only",
+		})
+	}
+	// ?notebook=none lists the notes that are not in any notebook.
+	if notebook := c.Query("notebook"); notebook == "none" {
+		filter.Unfiled = true
+	} else if notebook != "" {
+		if filter.NotebookID, err = resolveNotebook(c, db, user, notebook); err != nil {
+			return err
 		}
 	}
 
-	notes, err := utils.GetAllUserNotes(db, user.ID)
+	page, err := utils.ListUserNotes(c.UserContext(), db, user.ID, opts)
+	if err == utils.ErrInvalidNoteCursor {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid cursor. Cursors only continue a listing with the same sort and order.",
+		})
+	}
 	if err != nil {
 		log.Printf("Failed to get user notes: %v", err)
 		return c.Status(500).JSON(fiber.Map{"message": "Failed to retrieve notes"})
 	}
 
+	var notes interface{} = page.Notes
+	if opts.Summary {
+		notes = utils.SummarizeNotes(page.Notes)
+	}
+	var nextCursor interface{}
+	if page.NextCursor != "" {
+		nextCursor = page.NextCursor
+	}
+
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"message": "Notes retrieved successfully",
-		"notes":   notes,
-		"count":   len(notes),
+		"message":    "Notes retrieved successfully",
+		"notes":      notes,
+		"count":      len(page.Notes),
+		"total":      page.Total,
+		"nextCursor": nextCursor,
 	})
 }
 
+// noteListOptions reads the paging, order and view of a note listing from
+// the query string. Dates sort newest first and titles A to Z unless ?order
+// says otherwise. A request without ?limit or ?cursor, as clients made before
+// the listing was paged, gets the largest page so that they still see as many
+// notes as a single request may load.
+func noteListOptions(c *fiber.Ctx) (utils.NoteListOptions, error) {
+	opts := utils.NoteListOptions{
+		Sort:   c.Query("sort", utils.NoteSortCreated),
+		Cursor: c.Query("cursor"),
+	}
+	pageSize := defaultNotePageSize
+	if opts.Cursor == "" {
+		pageSize = maxNotePageSize
+	}
+	opts.Limit = c.QueryInt("limit", pageSize)
+
+	if !utils.IsNoteSort(opts.Sort) {
+		return opts, fiber.NewError(fiber.StatusBadRequest, "sort must be created, updated or title")
+	}
+
+	switch c.Query("order") {
+	case "":
+		opts.Ascending = opts.Sort == utils.NoteSortTitle
+	case "asc":
+		opts.Ascending = true
+	case "desc":
+	default:
+		return opts, fiber.NewError(fiber.StatusBadRequest, "order must be asc or desc")
+	}
+
+	if opts.Limit < 1 || opts.Limit > maxNotePageSize {
+		return opts, fiber.NewError(fiber.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxNotePageSize))
+	}
+
+	switch c.Query("view", "full") {
+	case "full":
+	case "summary":
+		opts.Summary = true
+	default:
+		return opts, fiber.NewError(fiber.StatusBadRequest, "view must be full or summary")
+	}
+	return opts, nil
+}
+
 func GetMyNotes(c *fiber.Ctx) error {
 	return GetUserNotes(c)
 }
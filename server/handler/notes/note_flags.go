@@ -0,0 +1,58 @@
+package notes
+
+import (
+	"server/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// PinNote keeps a note at the top of the note list.
+func PinNote(c *fiber.Ctx) error {
+	return setNoteFlag(c, "pinned", true, "Note pinned")
+}
+
+// UnpinNote returns a pinned note to its place in the note list.
+func UnpinNote(c *fiber.Ctx) error {
+	return setNoteFlag(c, "pinned", false, "Note unpinned")
+}
+
+// ArchiveNote hides a note from the note list without deleting it.
+func ArchiveNote(c *fiber.Ctx) error {
+	return setNoteFlag(c, "archived", true, "Note archived")
+}
+
+// UnarchiveNote brings an archived note back into the note list.
+func UnarchiveNote(c *fiber.Ctx) error {
+	return setNoteFlag(c, "archived", false, "Note unarchived")
+}
+
+// FavoriteNote marks a note as a favorite.
+func FavoriteNote(c *fiber.Ctx) error {
+	return setNoteFlag(c, "favorite", true, "Note added to favorites")
+}
+
+// UnfavoriteNote removes a note from the favorites.
+func UnfavoriteNote(c *fiber.Ctx) error {
+	return setNoteFlag(c, "favorite", false, "Note removed from favorites")
+}
+
+// setNoteFlag turns one of the note's flags on or off. Flags are outside the
+// note's version, so the note keeps its version and gets no revision, and
+// If-Match is not checked.
+func setNoteFlag(c *fiber.Ctx, flag string, on bool, message string) error {
+	db, _, note, err := loadOwnedNote(c)
+	if err != nil {
+		return err
+	}
+
+	updatedNote, err := utils.SetNoteFlag(c.UserContext(), db, note, flag, on)
+	if err != nil {
+		return noteWriteError(err)
+	}
+
+	c.Set(fiber.HeaderETag, utils.NoteETag(updatedNote.Version))
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": message,
+		"note":    updatedNote,
+	})
+}
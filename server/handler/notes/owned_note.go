@@ -0,0 +1,77 @@
+package notes
+
+import (
+	"errors"
+	"log"
+	"server/database"
+	"server/middleware"
+	"server/models"
+	"server/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// loadOwnedNote returns the caller and the note authorized by
+// middleware.AuthorizeNote for this route. Failures are returned as
+// *fiber.Error.
+func loadOwnedNote(c *fiber.Ctx) (*mongo.Database, models.User, models.Note, error) {
+	user, err := middleware.CurrentUser(c)
+	if err != nil {
+		return nil, user, models.Note{}, err
+	}
+
+	note, err := middleware.CurrentNote(c)
+	if err != nil {
+		return nil, user, note, err
+	}
+
+	db, err := database.Connect()
+	if err != nil {
+		log.Printf("Database connection error: %v", err)
+		return nil, user, note, fiber.NewError(fiber.StatusInternalServerError, "Database connection failed")
+	}
+
+	return db, user, note, nil
+}
+
+// resolveNotebook parses the ID of a notebook the caller wants to file a note
+// in or filter by, and checks that it is theirs. An empty id means no
+// notebook.
+func resolveNotebook(c *fiber.Ctx, db *mongo.Database, user models.User, id string) (*primitive.ObjectID, error) {
+	if id == "" {
+		return nil, nil
+	}
+
+	notebookID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid notebook ID format")
+	}
+
+	err = db.Collection("notebooks").FindOne(c.UserContext(), bson.M{"_id": notebookID, "userId": user.ID}).Err()
+	if err == mongo.ErrNoDocuments {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Notebook not found")
+	}
+	if err != nil {
+		log.Printf("Failed to get notebook: %v", err)
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve notebook")
+	}
+	return &notebookID, nil
+}
+
+// noteWriteError turns a failed utils.UpdateNoteAtVersion into the error to
+// respond with. Version conflicts are passed on for the error handler to
+// report with the current note.
+func noteWriteError(err error) error {
+	var conflict *utils.NoteVersionConflictError
+	if errors.As(err, &conflict) {
+		return err
+	}
+	if err == mongo.ErrNoDocuments {
+		return fiber.NewError(fiber.StatusNotFound, "Note not found")
+	}
+	log.Printf("Failed to update note: %v", err)
+	return fiber.NewError(fiber.StatusInternalServerError, "Failed to update note")
+}
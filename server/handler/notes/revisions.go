@@ -0,0 +1,177 @@
+package notes
+
+import (
+	"log"
+	"server/models"
+	"server/services"
+	"server/utils"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	defaultRevisionPageSize = 50
+	maxRevisionPageSize     = 200
+)
+
+// ListNoteRevisions returns a note's revisions newest first, without their
+// content. ?before=<number> pages back through older revisions.
+func ListNoteRevisions(c *fiber.Ctx) error {
+	db, _, note, err := loadOwnedNote(c)
+	if err != nil {
+		return err
+	}
+
+	limit := c.QueryInt("limit", defaultRevisionPageSize)
+	if limit < 1 || limit > maxRevisionPageSize {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "limit must be between 1 and " + strconv.Itoa(maxRevisionPageSize),
+		})
+	}
+
+	revisions, err := utils.ListNoteRevisions(c.UserContext(), db, note.ID, c.QueryInt("before"), limit)
+	if err != nil {
+		log.Printf("Failed to list note revisions: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Failed to retrieve note revisions"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":   "Note revisions retrieved successfully",
+		"noteId":    note.ID,
+		"revisions": revisions,
+		"count":     len(revisions),
+	})
+}
+
+// GetNoteRevision returns one revision including its content.
+func GetNoteRevision(c *fiber.Ctx) error {
+	db, _, note, err := loadOwnedNote(c)
+	if err != nil {
+		return err
+	}
+
+	revision, err := findRevision(c, db, note, c.Params("number"))
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":  "Note revision retrieved successfully",
+		"revision": revision,
+	})
+}
+
+// DiffNoteRevisions compares two revisions of a note. ?to defaults to the
+// latest revision and ?from to the one before ?to.
+func DiffNoteRevisions(c *fiber.Ctx) error {
+	db, _, note, err := loadOwnedNote(c)
+	if err != nil {
+		return err
+	}
+
+	to, err := findRevision(c, db, note, c.Query("to", "latest"))
+	if err != nil {
+		return err
+	}
+
+	fromNumber := c.Query("from")
+	if fromNumber == "" {
+		if to.Number <= 1 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "Revision 1 has nothing before it to compare with",
+			})
+		}
+		fromNumber = strconv.Itoa(to.Number - 1)
+	}
+	from, err := findRevision(c, db, note, fromNumber)
+	if err != nil {
+		return err
+	}
+
+	diff := utils.DiffLines(from.Content, to.Content)
+	unified := utils.UnifiedDiff(from.Content, to.Content, 3)
+	from.Content, to.Content = "", ""
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":      "Note revisions compared successfully",
+		"from":         from,
+		"to":           to,
+		"titleChanged": from.Title != to.Title,
+		"diff":         unified,
+		"lines":        diff,
+		"stats":        utils.CountDiff(diff),
+	})
+}
+
+// RestoreNoteRevision puts an older revision's title and content back on the
+// note. The restore is itself recorded as a new revision, so nothing in the
+// history is lost.
+func RestoreNoteRevision(c *fiber.Ctx) error {
+	db, user, note, err := loadOwnedNote(c)
+	if err != nil {
+		return err
+	}
+
+	revision, err := findRevision(c, db, note, c.Params("number"))
+	if err != nil {
+		return err
+	}
+
+	if err := utils.CheckNoteVersion(note, c.Get(fiber.HeaderIfMatch), nil); err != nil {
+		return err
+	}
+
+	restored, err := utils.UpdateNoteAtVersion(c.UserContext(), db, note, bson.M{
+		"title":     revision.Title,
+		"content":   revision.Content,
+		"updatedAt": time.Now(),
+	})
+	if err != nil {
+		return noteWriteError(err)
+	}
+
+	newRevision, err := utils.RecordNoteRevision(c.UserContext(), db, &note, *restored, models.NoteRevision{
+		Source:       models.RevisionSourceRestore,
+		Author:       user.ClerkID,
+		RestoredFrom: revision.Number,
+	})
+	if err != nil {
+		log.Printf("Failed to record note revision: %v", err)
+	}
+
+	services.IndexNoteInBackground(c.UserContext(), user, restored.ID)
+
+	c.Set(fiber.HeaderETag, utils.NoteETag(restored.Version))
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":  "Note restored to revision " + strconv.Itoa(revision.Number),
+		"note":     restored,
+		"revision": newRevision,
+	})
+}
+
+// findRevision loads the revision named by number, a revision number or
+// "latest".
+func findRevision(c *fiber.Ctx, db *mongo.Database, note models.Note, number string) (*models.NoteRevision, error) {
+	n := 0
+	if number != "latest" {
+		var err error
+		n, err = strconv.Atoi(number)
+		if err != nil || n < 1 {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid revision number")
+		}
+	}
+
+	revision, err := utils.GetNoteRevision(c.UserContext(), db, note.ID, n)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fiber.NewError(fiber.StatusNotFound, "Note revision not found")
+		}
+		log.Printf("Failed to get note revision: %v", err)
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve note revision")
+	}
+	return revision, nil
+}
@@ -0,0 +1,119 @@
+package notes
+
+import (
+	"log"
+	"net/url"
+	"server/database"
+	"server/middleware"
+	"server/models"
+	"server/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ListTags returns the caller's tags with how many notes carry each.
+func ListTags(c *fiber.Ctx) error {
+	user, err := middleware.CurrentUser(c)
+	if err != nil {
+		return err
+	}
+
+	db, err := database.Connect()
+	if err != nil {
+		log.Printf("Database connection error: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Database connection failed"})
+	}
+
+	tags, err := utils.ListUserTags(c.UserContext(), db, user.ID)
+	if err != nil {
+		log.Printf("Failed to list tags: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Failed to retrieve tags"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Tags retrieved successfully",
+		"tags":    tags,
+		"count":   len(tags),
+	})
+}
+
+// RenameTag renames the :tag tag on all of the caller's notes. Renaming to a
+// tag that already exists merges the two.
+func RenameTag(c *fiber.Ctx) error {
+	var renameReq struct {
+		Name string `json:"name"`
+	}
+	if err := c.BodyParser(&renameReq); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+			"error":   err.Error(),
+		})
+	}
+
+	tag, err := url.PathUnescape(c.Params("tag"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid tag"})
+	}
+
+	return mergeTags(c, []string{tag}, renameReq.Name)
+}
+
+// MergeTags replaces several tags with one on all of the caller's notes.
+func MergeTags(c *fiber.Ctx) error {
+	var mergeReq models.TagMergeRequest
+	if err := c.BodyParser(&mergeReq); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+			"error":   err.Error(),
+		})
+	}
+
+	return mergeTags(c, mergeReq.Tags, mergeReq.Into)
+}
+
+func mergeTags(c *fiber.Ctx, from []string, into string) error {
+	user, err := middleware.CurrentUser(c)
+	if err != nil {
+		return err
+	}
+
+	into, err = utils.NormalizeTag(into)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	}
+
+	var sources []string
+	for _, tag := range from {
+		tag, err := utils.NormalizeTag(tag)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+		}
+		if tag != into {
+			sources = append(sources, tag)
+		}
+	}
+	if len(sources) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "At least one tag other than the target must be given",
+		})
+	}
+
+	db, err := database.Connect()
+	if err != nil {
+		log.Printf("Database connection error: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Database connection failed"})
+	}
+
+	updated, err := utils.MergeUserTags(c.UserContext(), db, user.ID, sources, into)
+	if err != nil {
+		log.Printf("Failed to merge tags: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Failed to update tags"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":      "Tags updated successfully",
+		"tag":          into,
+		"merged":       sources,
+		"notesUpdated": updated,
+	})
+}
@@ -1,35 +1,27 @@
 package notes
 
 import (
-	"context"
 	"log"
-	"server/database"
 	"server/models"
+	"server/services"
+	"server/utils"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// UpdateNote changes a note's title, content, tags and notebook. Clients that send the
+// version they edited, either as If-Match or in the body, get 409 Conflict
+// instead of overwriting a newer version.
 func UpdateNote(c *fiber.Ctx) error {
-	noteID := c.Params("id")
-	if noteID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Note ID is required",
-		})
-	}
-
-	objectID, err := primitive.ObjectIDFromHex(noteID)
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Invalid note ID format",
-		})
-	}
-
 	type UpdateRequest struct {
-		Title   string `json:"title,omitempty"`
-		Content string `json:"content,omitempty"`
+		Title   string    `json:"title,omitempty"`
+		Content string    `json:"content,omitempty"`
+		Tags    *[]string `json:"tags,omitempty"`
+		// NotebookID moves the note; "" takes it out of its notebook.
+		NotebookID *string `json:"notebookId,omitempty"`
+		Version    *int64  `json:"version,omitempty"`
 	}
 
 	updateReq := new(UpdateRequest)
@@ -40,13 +32,14 @@ func UpdateNote(c *fiber.Ctx) error {
 		})
 	}
 
-	db, err := database.Connect()
+	db, user, note, err := loadOwnedNote(c)
 	if err != nil {
-		log.Printf("Database connection error: %v", err)
-		return c.Status(500).JSON(fiber.Map{"message": "Database connection failed"})
+		return err
 	}
 
-	collection := db.Collection("notes")
+	if err := utils.CheckNoteVersion(note, c.Get(fiber.HeaderIfMatch), updateReq.Version); err != nil {
+		return err
+	}
 
 	// Prepare update fields
 	updateFields := bson.M{
@@ -59,22 +52,40 @@ func UpdateNote(c *fiber.Ctx) error {
 	if updateReq.Content != "" {
 		updateFields["content"] = updateReq.Content
 	}
+	// Tags are replaced as a whole; an empty list removes them all.
+	if updateReq.Tags != nil {
+		tags, err := utils.NormalizeTags(*updateReq.Tags)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": err.Error(),
+			})
+		}
+		updateFields["tags"] = tags
+	}
+	if updateReq.NotebookID != nil {
+		notebookID, err := resolveNotebook(c, db, user, *updateReq.NotebookID)
+		if err != nil {
+			return err
+		}
+		updateFields["notebookId"] = notebookID
+	}
 
-	// Update the note
-	_, err = collection.UpdateOne(context.Background(), bson.M{"_id": objectID}, bson.M{"$set": updateFields})
+	updatedNote, err := utils.UpdateNoteAtVersion(c.UserContext(), db, note, updateFields)
 	if err != nil {
-		log.Printf("Failed to update note: %v", err)
-		return c.Status(500).JSON(fiber.Map{"message": "Failed to update note"})
+		return noteWriteError(err)
 	}
 
-	// Fetch and return the updated note
-	var updatedNote models.Note
-	err = collection.FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&updatedNote)
+	_, err = utils.RecordNoteRevision(c.UserContext(), db, &note, *updatedNote, models.NoteRevision{
+		Source: models.RevisionSourceManual,
+		Author: user.ClerkID,
+	})
 	if err != nil {
-		log.Printf("Failed to fetch updated note: %v", err)
-		return c.Status(500).JSON(fiber.Map{"message": "Note updated but failed to retrieve"})
+		log.Printf("Failed to record note revision: %v", err)
 	}
 
+	services.IndexNoteInBackground(c.UserContext(), user, updatedNote.ID)
+
+	c.Set(fiber.HeaderETag, utils.NoteETag(updatedNote.Version))
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "Note updated successfully",
 		"note":    updatedNote,
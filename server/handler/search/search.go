@@ -0,0 +1,99 @@
+package search
+
+import (
+	"log"
+	"server/database"
+	"server/middleware"
+	"server/utils"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const dateLayout = "2006-01-02"
+
+// Search runs a full-text search over the caller's notes and chat messages.
+// See docs/BACKEND.md for the query syntax and filters.
+func Search(c *fiber.Ctx) error {
+	user, err := middleware.CurrentUser(c)
+	if err != nil {
+		return err
+	}
+
+	query, err := utils.ParseSearchQuery(c.Query("q"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	}
+
+	opts := utils.SearchOptions{
+		Query: query,
+		Limit: min(max(c.QueryInt("limit", utils.DefaultSearchLimit), 1), utils.MaxSearchLimit),
+	}
+
+	switch c.Query("type", "all") {
+	case "all":
+		opts.Notes, opts.Chats = true, true
+	case "notes":
+		opts.Notes = true
+	case "chats":
+		opts.Chats = true
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "type must be all, notes or chats"})
+	}
+
+	if tag := c.Query("tag"); tag != "" {
+		if !opts.Notes {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "tag can only be used when searching notes"})
+		}
+		if opts.Tag, err = utils.NormalizeTag(tag); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+		}
+		// Chat messages have no tags.
+		opts.Chats = false
+	}
+
+	if opts.From, err = parseDate(c.Query("from"), false); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "from must be a date (YYYY-MM-DD) or an RFC 3339 time"})
+	}
+	if opts.To, err = parseDate(c.Query("to"), true); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "to must be a date (YYYY-MM-DD) or an RFC 3339 time"})
+	}
+
+	db, err := database.Connect()
+	if err != nil {
+		log.Printf("Database connection error: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Database connection failed"})
+	}
+
+	results, err := utils.Search(c.UserContext(), db, user, opts)
+	if err != nil {
+		log.Printf("Failed to search: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Failed to search"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Search completed successfully",
+		"query":   c.Query("q"),
+		"results": results,
+		"count":   len(results),
+	})
+}
+
+// parseDate parses a from or to bound. A plain date as the upper bound
+// includes that whole day.
+func parseDate(value string, upper bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse(dateLayout, value)
+	if err != nil {
+		return nil, err
+	}
+	if upper {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
@@ -0,0 +1,102 @@
+package search
+
+import (
+	"errors"
+	"log"
+	"server/database"
+	"server/middleware"
+	"server/services"
+	"server/utils"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SemanticSearch finds the caller's notes closest in meaning to q, using
+// embeddings of the notes made with their own provider key.
+func SemanticSearch(c *fiber.Ctx) error {
+	user, err := middleware.CurrentUser(c)
+	if err != nil {
+		return err
+	}
+
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "q is required"})
+	}
+	if utf8.RuneCountInString(query) > utils.MaxSearchQueryLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "q is too long"})
+	}
+	limit := min(max(c.QueryInt("limit", utils.DefaultSemanticSearchLimit), 1), utils.MaxSemanticSearchLimit)
+
+	db, err := database.Connect()
+	if err != nil {
+		log.Printf("Database connection error: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Database connection failed"})
+	}
+
+	results, target, err := services.SemanticSearch(c.UserContext(), db, user, query, limit)
+	if err != nil {
+		return semanticSearchError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":  "Search completed successfully",
+		"query":    query,
+		"provider": target.Provider,
+		"model":    target.ModelID,
+		"results":  results,
+		"count":    len(results),
+	})
+}
+
+// ReindexNotes starts embedding all of the caller's notes that are not yet
+// indexed with their current embedding model.
+func ReindexNotes(c *fiber.Ctx) error {
+	user, err := middleware.CurrentUser(c)
+	if err != nil {
+		return err
+	}
+
+	db, err := database.Connect()
+	if err != nil {
+		log.Printf("Database connection error: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Database connection failed"})
+	}
+
+	count, err := services.IndexUserNotesInBackground(c.UserContext(), db, user)
+	if err != nil {
+		return semanticSearchError(c, err)
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "Indexing started",
+		"notes":   count,
+	})
+}
+
+func semanticSearchError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, services.ErrNoEmbeddingProvider) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Semantic search needs an OpenAI or Gemini API key. Please add one in profile settings.",
+		})
+	}
+
+	var budgetErr *utils.BudgetExceededError
+	if errors.As(err, &budgetErr) {
+		return err
+	}
+
+	if providerErr, ok := services.AsProviderError(err); ok {
+		return c.Status(providerErr.HTTPStatus()).JSON(fiber.Map{
+			"message":  "Failed to embed the search query",
+			"error":    providerErr.Error(),
+			"code":     providerErr.Code(),
+			"provider": providerErr.Provider,
+		})
+	}
+
+	log.Printf("Semantic search failed: %v", err)
+	return c.Status(500).JSON(fiber.Map{"message": "Failed to search"})
+}
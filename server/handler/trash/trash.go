@@ -0,0 +1,158 @@
+package trash
+
+import (
+	"log"
+	"server/database"
+	"server/middleware"
+	"server/models"
+	"server/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ListTrash returns the caller's notes and chat sessions in the trash, most
+// recently deleted first. Notes are listed in their summary form.
+func ListTrash(c *fiber.Ctx) error {
+	user, err := middleware.CurrentUser(c)
+	if err != nil {
+		return err
+	}
+
+	db, err := database.Connect()
+	if err != nil {
+		log.Printf("Database connection error: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Database connection failed"})
+	}
+
+	notes, err := utils.ListTrashedNotes(c.UserContext(), db, user.ID)
+	if err != nil {
+		log.Printf("Failed to list trashed notes: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Failed to retrieve trash"})
+	}
+
+	sessions, err := utils.ListTrashedChatSessions(c.UserContext(), db, user.ClerkID)
+	if err != nil {
+		log.Printf("Failed to list trashed chat sessions: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Failed to retrieve trash"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":          "Trash retrieved successfully",
+		"notes":            utils.SummarizeNotes(notes),
+		"sessions":         sessions,
+		"count":            len(notes) + len(sessions),
+		"retentionSeconds": int64(utils.TrashRetention().Seconds()),
+	})
+}
+
+// RestoreNote takes a note out of the trash.
+func RestoreNote(c *fiber.Ctx) error {
+	note, err := middleware.CurrentNote(c)
+	if err != nil {
+		return err
+	}
+
+	db, err := database.Connect()
+	if err != nil {
+		log.Printf("Database connection error: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Database connection failed"})
+	}
+
+	note, err = utils.RestoreNote(c.UserContext(), db, note)
+	if err != nil {
+		log.Printf("Failed to restore note: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Failed to restore note"})
+	}
+
+	c.Set(fiber.HeaderETag, utils.NoteETag(note.Version))
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Note restored successfully",
+		"note":    note,
+	})
+}
+
+// DeleteNote deletes a note in the trash for good, together with its
+// revisions and search chunks.
+func DeleteNote(c *fiber.Ctx) error {
+	user, err := middleware.CurrentUser(c)
+	if err != nil {
+		return err
+	}
+	note, err := middleware.CurrentNote(c)
+	if err != nil {
+		return err
+	}
+
+	db, err := database.Connect()
+	if err != nil {
+		log.Printf("Database connection error: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Database connection failed"})
+	}
+
+	if _, err := utils.DeleteUserNotes(c.UserContext(), db, user.ID, []primitive.ObjectID{note.ID}); err != nil {
+		log.Printf("Failed to delete note: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Failed to delete note"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Note deleted permanently",
+	})
+}
+
+// RestoreChatSession takes a chat session and its messages out of the trash.
+func RestoreChatSession(c *fiber.Ctx) error {
+	session, err := currentSession(c)
+	if err != nil {
+		return err
+	}
+
+	db, err := database.Connect()
+	if err != nil {
+		log.Printf("Database connection error: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Database connection failed"})
+	}
+
+	if err := utils.RestoreChatSession(c.UserContext(), db, session); err != nil {
+		log.Printf("Failed to restore chat session: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Failed to restore chat session"})
+	}
+
+	session.DeletedAt = nil
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Chat session restored successfully",
+		"session": session,
+	})
+}
+
+// DeleteChatSession deletes a chat session in the trash and its messages for
+// good.
+func DeleteChatSession(c *fiber.Ctx) error {
+	session, err := currentSession(c)
+	if err != nil {
+		return err
+	}
+
+	db, err := database.Connect()
+	if err != nil {
+		log.Printf("Database connection error: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Database connection failed"})
+	}
+
+	if err := utils.DeleteChatSession(c.UserContext(), db, session); err != nil {
+		log.Printf("Failed to delete chat session: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Failed to delete chat session"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Chat session deleted permanently",
+	})
+}
+
+func currentSession(c *fiber.Ctx) (models.ChatSession, error) {
+	session, ok := middleware.CurrentChatSession(c)
+	if !ok {
+		return session, fiber.NewError(fiber.StatusNotFound, "Chat session not found")
+	}
+	return session, nil
+}
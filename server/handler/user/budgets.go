@@ -0,0 +1,142 @@
+package user
+
+import (
+	"fmt"
+	"log"
+	"server/database"
+	"server/middleware"
+	"server/models"
+	"server/services"
+	"server/utils"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// GetBudgets returns the user's spending budgets together with how much of
+// each has been used in its current period.
+func GetBudgets(c *fiber.Ctx) error {
+	clerkUserID, err := middleware.GetClerkUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+
+	db, err := database.Connect()
+	if err != nil {
+		log.Printf("Database connection error: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Database connection failed"})
+	}
+
+	user, err := middleware.CurrentUser(c)
+	if err != nil {
+		return err
+	}
+
+	statuses, err := utils.GetBudgetStatuses(c.UserContext(), db, clerkUserID, user.Budgets, time.Now())
+	if err != nil {
+		log.Printf("Failed to meter budgets: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Failed to retrieve budgets"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Budgets retrieved successfully",
+		"budgets": statuses,
+	})
+}
+
+// UpdateBudgets replaces the user's spending budgets. An empty list removes
+// every limit.
+func UpdateBudgets(c *fiber.Ctx) error {
+	clerkUserID, err := middleware.GetClerkUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+
+	budgetsReq := new(models.BudgetsUpdate)
+	if err := c.BodyParser(budgetsReq); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+			"error":   err.Error(),
+		})
+	}
+
+	seen := make(map[string]bool)
+	for i := range budgetsReq.Budgets {
+		if message := validateBudget(&budgetsReq.Budgets[i]); message != "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": fmt.Sprintf("budgets[%d]: %s", i, message),
+			})
+		}
+
+		key := budgetsReq.Budgets[i].Provider + "/" + budgetsReq.Budgets[i].Period
+		if seen[key] {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": fmt.Sprintf("budgets[%d]: only one %s budget per provider is allowed", i, budgetsReq.Budgets[i].Period),
+			})
+		}
+		seen[key] = true
+	}
+
+	if budgetsReq.Budgets == nil {
+		budgetsReq.Budgets = []models.SpendingBudget{}
+	}
+
+	db, err := database.Connect()
+	if err != nil {
+		log.Printf("Database connection error: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Database connection failed"})
+	}
+
+	result, err := db.Collection("users").UpdateOne(
+		c.UserContext(),
+		bson.M{"clerkId": clerkUserID},
+		bson.M{"$set": bson.M{"budgets": budgetsReq.Budgets, "updatedAt": time.Now()}},
+	)
+	if err != nil {
+		log.Printf("Failed to update budgets: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Failed to update budgets"})
+	}
+
+	if result.MatchedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "User profile not found",
+		})
+	}
+
+	statuses, err := utils.GetBudgetStatuses(c.UserContext(), db, clerkUserID, budgetsReq.Budgets, time.Now())
+	if err != nil {
+		log.Printf("Failed to meter budgets: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Budgets updated but failed to retrieve usage"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Budgets updated successfully",
+		"budgets": statuses,
+	})
+}
+
+// validateBudget normalizes budget in place and returns a user-facing message
+// describing what is wrong with it, or "" if it is valid.
+func validateBudget(budget *models.SpendingBudget) string {
+	budget.Provider = strings.ToLower(strings.TrimSpace(budget.Provider))
+	budget.Period = strings.ToLower(strings.TrimSpace(budget.Period))
+
+	if budget.Provider != models.BudgetAllProviders && !services.IsSupportedProvider(budget.Provider) {
+		return "provider must be 'all', " + services.SupportedProvidersMessage()
+	}
+	if budget.Period != models.BudgetPeriodDaily && budget.Period != models.BudgetPeriodMonthly {
+		return "period must be 'daily' or 'monthly'"
+	}
+	if budget.TokenLimit < 0 || budget.CostLimit < 0 {
+		return "limits cannot be negative"
+	}
+	if budget.TokenLimit == 0 && budget.CostLimit == 0 {
+		return "tokenLimit or costLimit is required"
+	}
+	if budget.WarnAt < 0 || budget.WarnAt > 1 {
+		return "warnAt must be between 0 and 1"
+	}
+	return ""
+}
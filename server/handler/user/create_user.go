@@ -1,7 +1,6 @@
 package user
 
 import (
-	"context"
 	"log"
 	"server/database"
 	"server/middleware"
@@ -43,7 +42,7 @@ func CreateOrSyncUser(c *fiber.Ctx) error {
 	collection := db.Collection("users")
 
 	var existingUser models.User
-	err = collection.FindOne(context.Background(), bson.M{"clerkId": clerkUserID}).Decode(&existingUser)
+	err = collection.FindOne(c.UserContext(), bson.M{"clerkId": clerkUserID}).Decode(&existingUser)
 
 	if err == nil {
 		existingUser.Email = userReq.Email
@@ -52,7 +51,7 @@ func CreateOrSyncUser(c *fiber.Ctx) error {
 		existingUser.LastName = userReq.LastName
 		existingUser.UpdatedAt = time.Now()
 
-		_, err = collection.ReplaceOne(context.Background(), bson.M{"clerkId": clerkUserID}, existingUser)
+		_, err = collection.ReplaceOne(c.UserContext(), bson.M{"clerkId": clerkUserID}, existingUser)
 		if err != nil {
 			log.Printf("Failed to update user: %v", err)
 			return c.Status(500).JSON(fiber.Map{"message": "Failed to update user profile"})
@@ -69,9 +68,13 @@ func CreateOrSyncUser(c *fiber.Ctx) error {
 				LastName:     existingUser.LastName,
 				HasOpenAIKey: existingUser.OpenAIKey != "",
 				HasGeminiKey: existingUser.GeminiKey != "",
+				HasClaudeKey: existingUser.ClaudeKey != "",
 				CreatedAt:    existingUser.CreatedAt,
 				UpdatedAt:    existingUser.UpdatedAt,
 				NoteIds:      existingUser.NoteIds,
+
+				CustomEndpoints:   models.NewCustomEndpointProfiles(existingUser.CustomEndpoints),
+				APIKeysVerifiedAt: existingUser.APIKeysVerifiedAt,
 			},
 		})
 	}
@@ -87,7 +90,7 @@ func CreateOrSyncUser(c *fiber.Ctx) error {
 		NoteIds:   []primitive.ObjectID{},
 	}
 
-	result, err := collection.InsertOne(context.Background(), newUser)
+	result, err := collection.InsertOne(c.UserContext(), newUser)
 	if err != nil {
 		log.Printf("Failed to create user: %v", err)
 		return c.Status(500).JSON(fiber.Map{"message": "Failed to create user profile"})
@@ -106,9 +109,12 @@ func CreateOrSyncUser(c *fiber.Ctx) error {
 			LastName:     newUser.LastName,
 			HasOpenAIKey: false,
 			HasGeminiKey: false,
+			HasClaudeKey: false,
 			CreatedAt:    newUser.CreatedAt,
 			UpdatedAt:    newUser.UpdatedAt,
 			NoteIds:      newUser.NoteIds,
+
+			CustomEndpoints: []models.CustomEndpointProfile{},
 		},
 	})
 }
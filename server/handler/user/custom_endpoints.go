@@ -0,0 +1,245 @@
+package user
+
+import (
+	"log"
+	"net/url"
+	"server/database"
+	"server/middleware"
+	"server/models"
+	"server/utils"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func GetCustomEndpoints(c *fiber.Ctx) error {
+	user, err := middleware.CurrentUser(c)
+	if err != nil {
+		return err
+	}
+
+	endpoints := models.NewCustomEndpointProfiles(user.CustomEndpoints)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":   "Custom endpoints retrieved successfully",
+		"endpoints": endpoints,
+		"count":     len(endpoints),
+	})
+}
+
+func CreateCustomEndpoint(c *fiber.Ctx) error {
+	clerkUserID, err := middleware.GetClerkUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+
+	endpointReq := new(models.CustomEndpointRequest)
+	if err := c.BodyParser(endpointReq); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+			"error":   err.Error(),
+		})
+	}
+
+	if message := validateCustomEndpoint(endpointReq); message != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": message,
+		})
+	}
+
+	db, err := database.Connect()
+	if err != nil {
+		log.Printf("Database connection error: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Database connection failed"})
+	}
+
+	sealedKey, err := utils.SealSecret(endpointReq.APIKey)
+	if err != nil {
+		log.Printf("Failed to encrypt endpoint API key: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Failed to create custom endpoint"})
+	}
+
+	endpoint := models.CustomEndpoint{
+		ID:        uuid.New().String(),
+		Name:      endpointReq.Name,
+		BaseURL:   endpointReq.BaseURL,
+		APIKey:    sealedKey,
+		Model:     endpointReq.Model,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	collection := db.Collection("users")
+	result, err := collection.UpdateOne(
+		c.UserContext(),
+		bson.M{"clerkId": clerkUserID},
+		bson.M{
+			"$push": bson.M{"customEndpoints": endpoint},
+			"$set":  bson.M{"updatedAt": time.Now()},
+		},
+	)
+	if err != nil {
+		log.Printf("Failed to create custom endpoint: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Failed to create custom endpoint"})
+	}
+
+	if result.MatchedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "User profile not found",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":  "Custom endpoint created successfully",
+		"endpoint": models.NewCustomEndpointProfiles([]models.CustomEndpoint{endpoint})[0],
+	})
+}
+
+func UpdateCustomEndpoint(c *fiber.Ctx) error {
+	clerkUserID, err := middleware.GetClerkUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+
+	endpointID := c.Params("endpointId")
+	if endpointID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Endpoint ID is required",
+		})
+	}
+
+	endpointReq := new(models.CustomEndpointRequest)
+	if err := c.BodyParser(endpointReq); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+			"error":   err.Error(),
+		})
+	}
+
+	if message := validateCustomEndpoint(endpointReq); message != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": message,
+		})
+	}
+
+	db, err := database.Connect()
+	if err != nil {
+		log.Printf("Database connection error: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Database connection failed"})
+	}
+
+	updateFields := bson.M{
+		"customEndpoints.$.name":      endpointReq.Name,
+		"customEndpoints.$.baseUrl":   endpointReq.BaseURL,
+		"customEndpoints.$.model":     endpointReq.Model,
+		"customEndpoints.$.updatedAt": time.Now(),
+		"updatedAt":                   time.Now(),
+	}
+
+	// An omitted key keeps the stored one, mirroring UpdateAPIKeys.
+	if endpointReq.APIKey != "" {
+		sealedKey, err := utils.SealSecret(endpointReq.APIKey)
+		if err != nil {
+			log.Printf("Failed to encrypt endpoint API key: %v", err)
+			return c.Status(500).JSON(fiber.Map{"message": "Failed to update custom endpoint"})
+		}
+		updateFields["customEndpoints.$.apiKey"] = sealedKey
+	}
+
+	collection := db.Collection("users")
+	filter := bson.M{"clerkId": clerkUserID, "customEndpoints.id": endpointID}
+	result, err := collection.UpdateOne(c.UserContext(), filter, bson.M{"$set": updateFields})
+	if err != nil {
+		log.Printf("Failed to update custom endpoint: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Failed to update custom endpoint"})
+	}
+
+	if result.MatchedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "Custom endpoint not found",
+		})
+	}
+
+	var user models.User
+	err = collection.FindOne(c.UserContext(), bson.M{"clerkId": clerkUserID}).Decode(&user)
+	if err != nil {
+		log.Printf("Failed to get updated user: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Custom endpoint updated but failed to retrieve it"})
+	}
+
+	endpoint, _ := user.FindCustomEndpoint(endpointID)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":  "Custom endpoint updated successfully",
+		"endpoint": models.NewCustomEndpointProfiles([]models.CustomEndpoint{endpoint})[0],
+	})
+}
+
+func DeleteCustomEndpoint(c *fiber.Ctx) error {
+	clerkUserID, err := middleware.GetClerkUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+
+	endpointID := c.Params("endpointId")
+	if endpointID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Endpoint ID is required",
+		})
+	}
+
+	db, err := database.Connect()
+	if err != nil {
+		log.Printf("Database connection error: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Database connection failed"})
+	}
+
+	collection := db.Collection("users")
+	result, err := collection.UpdateOne(
+		c.UserContext(),
+		bson.M{"clerkId": clerkUserID, "customEndpoints.id": endpointID},
+		bson.M{
+			"$pull": bson.M{"customEndpoints": bson.M{"id": endpointID}},
+			"$set":  bson.M{"updatedAt": time.Now()},
+		},
+	)
+	if err != nil {
+		log.Printf("Failed to delete custom endpoint: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Failed to delete custom endpoint"})
+	}
+
+	if result.MatchedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "Custom endpoint not found",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Custom endpoint deleted successfully",
+	})
+}
+
+// validateCustomEndpoint returns a user-facing message describing what is
+// wrong with the request, or "" if it is valid.
+func validateCustomEndpoint(endpointReq *models.CustomEndpointRequest) string {
+	endpointReq.Name = strings.TrimSpace(endpointReq.Name)
+	endpointReq.BaseURL = strings.TrimSuffix(strings.TrimSpace(endpointReq.BaseURL), "/")
+	endpointReq.Model = strings.TrimSpace(endpointReq.Model)
+
+	if endpointReq.Name == "" {
+		return "Name is required"
+	}
+	if endpointReq.Model == "" {
+		return "Model is required"
+	}
+
+	parsed, err := url.Parse(endpointReq.BaseURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "Base URL must be an absolute http(s) URL, e.g. http://localhost:11434/v1"
+	}
+
+	return ""
+}
@@ -1,7 +1,6 @@
 package user
 
 import (
-	"context"
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
 	"log"
@@ -20,7 +19,7 @@ func DeleteUser(c *fiber.Ctx) error {
 		return c.Status(500).JSON(fiber.Map{"message": err.Error()})
 	}
 	collection := db.Collection("users")
-	_, err = collection.DeleteOne(context.Background(), bson.M{"_id": user.ID})
+	_, err = collection.DeleteOne(c.UserContext(), bson.M{"_id": user.ID})
 	if err != nil {
 		log.Fatal(err.Error())
 		return c.Status(500).JSON(fiber.Map{"message": err.Error()})
@@ -0,0 +1,137 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"server/database"
+	"server/middleware"
+	"server/models"
+	"server/services"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// maxFallbackTargets keeps a failing request from walking an arbitrarily
+// long chain of providers.
+const maxFallbackTargets = 5
+
+func GetFallbackChain(c *fiber.Ctx) error {
+	user, err := middleware.CurrentUser(c)
+	if err != nil {
+		return err
+	}
+
+	chain := user.FallbackChain
+	if chain == nil {
+		chain = []models.FallbackTarget{}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":       "Fallback chain retrieved successfully",
+		"fallbackChain": chain,
+	})
+}
+
+// UpdateFallbackChain replaces the ordered list of provider/model pairs that
+// AI requests fall back to. An empty list disables fallbacks.
+func UpdateFallbackChain(c *fiber.Ctx) error {
+	clerkUserID, err := middleware.GetClerkUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+
+	chainReq := new(models.FallbackChainUpdate)
+	if err := c.BodyParser(chainReq); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+			"error":   err.Error(),
+		})
+	}
+
+	if len(chainReq.FallbackChain) > maxFallbackTargets {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": fmt.Sprintf("A fallback chain can have at most %d entries", maxFallbackTargets),
+		})
+	}
+
+	db, err := database.Connect()
+	if err != nil {
+		log.Printf("Database connection error: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Database connection failed"})
+	}
+
+	collection := db.Collection("users")
+	user, err := middleware.CurrentUser(c)
+	if err != nil {
+		return err
+	}
+
+	for i := range chainReq.FallbackChain {
+		if message := validateFallbackTarget(c.UserContext(), user, &chainReq.FallbackChain[i]); message != "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": fmt.Sprintf("fallbackChain[%d]: %s", i, message),
+			})
+		}
+	}
+
+	if chainReq.FallbackChain == nil {
+		chainReq.FallbackChain = []models.FallbackTarget{}
+	}
+
+	_, err = collection.UpdateOne(
+		c.UserContext(),
+		bson.M{"clerkId": clerkUserID},
+		bson.M{"$set": bson.M{"fallbackChain": chainReq.FallbackChain, "updatedAt": time.Now()}},
+	)
+	if err != nil {
+		log.Printf("Failed to update fallback chain: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Failed to update fallback chain"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":       "Fallback chain updated successfully",
+		"fallbackChain": chainReq.FallbackChain,
+	})
+}
+
+// validateFallbackTarget normalizes target in place and returns a user-facing
+// message describing what is wrong with it, or "" if it is valid. Keys are
+// not required up front: entries without one are skipped at request time.
+// An explicit model must be in the provider's catalog, as for chat requests.
+func validateFallbackTarget(ctx context.Context, user models.User, target *models.FallbackTarget) string {
+	target.Provider = strings.ToLower(strings.TrimSpace(target.Provider))
+	target.Model = strings.TrimSpace(target.Model)
+	target.EndpointID = strings.TrimSpace(target.EndpointID)
+
+	if !services.IsSupportedProvider(target.Provider) {
+		return "provider must be " + services.SupportedProvidersMessage()
+	}
+
+	creds := services.Credentials{APIKey: user.APIKey(target.Provider)}
+	if target.Provider != services.CustomProviderName {
+		if target.EndpointID != "" {
+			return "endpointId is only used with the custom provider"
+		}
+	} else {
+		if target.EndpointID == "" {
+			return "endpointId is required for the custom provider"
+		}
+		endpoint, ok := user.FindCustomEndpoint(target.EndpointID)
+		if !ok {
+			return "custom endpoint not found"
+		}
+		creds = services.Credentials{APIKey: endpoint.APIKey, BaseURL: endpoint.BaseURL}
+	}
+
+	if target.Model == "" {
+		return ""
+	}
+	if err := services.ValidateModel(ctx, target.Provider, target.Model, creds); err != nil {
+		return fmt.Sprintf("unknown model %q for provider %s. See GET /api/v1/models for available models", target.Model, target.Provider)
+	}
+	return ""
+}
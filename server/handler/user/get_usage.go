@@ -0,0 +1,57 @@
+package user
+
+import (
+	"log"
+	"server/database"
+	"server/middleware"
+	"server/utils"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultUsageDays = 30
+	maxUsageDays     = 365
+)
+
+func GetUsage(c *fiber.Ctx) error {
+	clerkUserID, err := middleware.GetClerkUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+
+	days := c.QueryInt("days", defaultUsageDays)
+	if days < 1 || days > maxUsageDays {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "days must be between 1 and 365",
+		})
+	}
+
+	db, err := database.Connect()
+	if err != nil {
+		log.Printf("Database connection error: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Database connection failed"})
+	}
+
+	user, err := middleware.CurrentUser(c)
+	if err != nil {
+		return err
+	}
+
+	// Days are counted in UTC, matching the daily breakdown.
+	now := time.Now().UTC()
+	since := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, -(days - 1))
+
+	summary, err := utils.GetUsageSummary(c.UserContext(), db, clerkUserID, since)
+	if err != nil {
+		log.Printf("Failed to aggregate usage: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Failed to retrieve usage"})
+	}
+	summary.Lifetime = user.Usage
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Usage retrieved successfully",
+		"usage":   summary,
+	})
+}
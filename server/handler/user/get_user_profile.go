@@ -1,7 +1,6 @@
 package user
 
 import (
-	"context"
 	"log"
 	"server/database"
 	"server/middleware"
@@ -9,9 +8,7 @@ import (
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func GetUserProfile(c *fiber.Ctx) error {
@@ -26,35 +23,29 @@ func GetUserProfile(c *fiber.Ctx) error {
 		return c.Status(500).JSON(fiber.Map{"message": "Database connection failed"})
 	}
 
-	collection := db.Collection("users")
-	var user models.User
-	err = collection.FindOne(context.Background(), bson.M{"clerkId": clerkUserID}).Decode(&user)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			// Automatically create user profile if it doesn't exist
-			log.Printf("User profile not found, creating for clerkID: %s", clerkUserID)
-			user = models.User{
-				ClerkID:   clerkUserID,
-				Email:     "",
-				Username:  "",
-				FirstName: "",
-				LastName:  "",
-				CreatedAt: time.Now(),
-				UpdatedAt: time.Now(),
-				NoteIds:   []primitive.ObjectID{},
-			}
+	user, err := middleware.CurrentUser(c)
+	if err == middleware.ErrUserProfileNotFound {
+		// Automatically create user profile if it doesn't exist
+		collection := db.Collection("users")
+		log.Printf("User profile not found, creating for clerkID: %s", clerkUserID)
+		user = models.User{
+			ClerkID:   clerkUserID,
+			Email:     "",
+			Username:  "",
+			FirstName: "",
+			LastName:  "",
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+			NoteIds:   []primitive.ObjectID{},
+		}
 
-			result, createErr := collection.InsertOne(context.Background(), user)
-			if createErr != nil {
-				log.Printf("Failed to create user profile: %v", createErr)
-				return c.Status(500).JSON(fiber.Map{"message": "Failed to create user profile"})
-			}
-			user.ID = result.InsertedID.(primitive.ObjectID)
-			log.Printf("Created user profile with ID: %s", user.ID.Hex())
-		} else {
-			log.Printf("Failed to get user: %v", err)
-			return c.Status(500).JSON(fiber.Map{"message": "Failed to retrieve user profile"})
+		result, createErr := collection.InsertOne(c.UserContext(), user)
+		if createErr != nil {
+			log.Printf("Failed to create user profile: %v", createErr)
+			return c.Status(500).JSON(fiber.Map{"message": "Failed to create user profile"})
 		}
+		user.ID = result.InsertedID.(primitive.ObjectID)
+		log.Printf("Created user profile with ID: %s", user.ID.Hex())
 	}
 
 	profile := models.UserProfile{
@@ -66,9 +57,13 @@ func GetUserProfile(c *fiber.Ctx) error {
 		LastName:     user.LastName,
 		HasOpenAIKey: user.OpenAIKey != "",
 		HasGeminiKey: user.GeminiKey != "",
+		HasClaudeKey: user.ClaudeKey != "",
 		CreatedAt:    user.CreatedAt,
 		UpdatedAt:    user.UpdatedAt,
 		NoteIds:      user.NoteIds,
+
+		CustomEndpoints:   models.NewCustomEndpointProfiles(user.CustomEndpoints),
+		APIKeysVerifiedAt: user.APIKeysVerifiedAt,
 	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
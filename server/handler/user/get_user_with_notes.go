@@ -3,30 +3,26 @@ package user
 import (
 	"log"
 	"server/database"
+	"server/middleware"
 	"server/utils"
 
 	"github.com/gofiber/fiber/v2"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// GetUserWithNotes returns the caller's profile together with their notes.
 func GetUserWithNotes(c *fiber.Ctx) error {
-	userIDStr := c.Params("userId")
-	if userIDStr == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "User ID is required"})
-	}
-
-	userID, err := primitive.ObjectIDFromHex(userIDStr)
+	user, err := middleware.CurrentUser(c)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid user ID format"})
+		return err
 	}
 
 	db, err := database.Connect()
 	if err != nil {
-		log.Fatal(err.Error())
-		return c.Status(500).JSON(fiber.Map{"message": err.Error()})
+		log.Printf("Database connection error: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Database connection failed"})
 	}
 
-	userWithNotes, err := utils.GetUserWithNotes(db, userID)
+	userWithNotes, err := utils.GetUserWithNotes(c.UserContext(), db, user.ID)
 	if err != nil {
 		log.Printf("Failed to get user with notes: %v", err)
 		return c.Status(500).JSON(fiber.Map{"message": "Failed to retrieve user with notes"})
@@ -1,17 +1,20 @@
 package user
 
 import (
-	"context"
 	"log"
 	"server/database"
 	"server/middleware"
 	"server/models"
+	"server/services"
+	"server/utils"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
 )
 
+// UpdateAPIKeys stores the keys in the request after checking each against its
+// provider. Nothing is stored unless every submitted key verifies.
 func UpdateAPIKeys(c *fiber.Ctx) error {
 	clerkUserID, err := middleware.GetClerkUserIDFromContext(c)
 	if err != nil {
@@ -26,6 +29,41 @@ func UpdateAPIKeys(c *fiber.Ctx) error {
 		})
 	}
 
+	// Keys are sealed before they are checked, since provider credentials
+	// only ever carry sealed keys.
+	keys := map[string]string{}
+	for provider, key := range apiKeys.Keys() {
+		sealed, err := utils.SealSecret(key)
+		if err != nil {
+			log.Printf("Failed to encrypt %s API key: %v", provider, err)
+			return c.Status(500).JSON(fiber.Map{"message": "Failed to update API keys"})
+		}
+		keys[provider] = sealed
+	}
+
+	results := checkAPIKeys(c.UserContext(), keys)
+	for _, result := range results {
+		if result.Status == models.APIKeyStatusValid {
+			continue
+		}
+
+		// A rejected key is the caller's problem; a provider we could not
+		// reach is not, and the key may be resubmitted later.
+		status := fiber.StatusServiceUnavailable
+		message := "Could not verify API keys with the provider. Please try again."
+		for _, result := range results {
+			if result.Status == models.APIKeyStatusInvalid {
+				status = fiber.StatusUnprocessableEntity
+				message = "One or more API keys were rejected by the provider"
+				break
+			}
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"message": message,
+			"keys":    results,
+		})
+	}
+
 	db, err := database.Connect()
 	if err != nil {
 		log.Printf("Database connection error: %v", err)
@@ -34,19 +72,15 @@ func UpdateAPIKeys(c *fiber.Ctx) error {
 
 	collection := db.Collection("users")
 
-	updateFields := bson.M{
-		"updatedAt": time.Now(),
-	}
-
-	if apiKeys.OpenAIKey != "" {
-		updateFields["openaiKey"] = apiKeys.OpenAIKey
-	}
-	if apiKeys.GeminiKey != "" {
-		updateFields["geminiKey"] = apiKeys.GeminiKey
+	updateFields := verifiedKeyFields(results)
+	updateFields["updatedAt"] = time.Now()
+	for provider, sealed := range keys {
+		field, _ := models.APIKeyField(provider)
+		updateFields[field] = sealed
 	}
 
 	result, err := collection.UpdateOne(
-		context.Background(),
+		c.UserContext(),
 		bson.M{"clerkId": clerkUserID},
 		bson.M{"$set": updateFields},
 	)
@@ -63,7 +97,7 @@ func UpdateAPIKeys(c *fiber.Ctx) error {
 	}
 
 	var user models.User
-	err = collection.FindOne(context.Background(), bson.M{"clerkId": clerkUserID}).Decode(&user)
+	err = collection.FindOne(c.UserContext(), bson.M{"clerkId": clerkUserID}).Decode(&user)
 	if err != nil {
 		log.Printf("Failed to get updated user: %v", err)
 		return c.Status(500).JSON(fiber.Map{"message": "API keys updated but failed to retrieve user"})
@@ -74,7 +108,10 @@ func UpdateAPIKeys(c *fiber.Ctx) error {
 		"apiKeyStatus": fiber.Map{
 			"hasOpenaiKey": user.OpenAIKey != "",
 			"hasGeminiKey": user.GeminiKey != "",
+			"hasClaudeKey": user.ClaudeKey != "",
 		},
+		"keys":              results,
+		"apiKeysVerifiedAt": user.APIKeysVerifiedAt,
 	})
 }
 
@@ -99,24 +136,20 @@ func DeleteAPIKey(c *fiber.Ctx) error {
 
 	collection := db.Collection("users")
 
-	var updateField string
-	switch keyType {
-	case "openai":
-		updateField = "openaiKey"
-	case "gemini":
-		updateField = "geminiKey"
-	case "claude":
-		updateField = "claudeKey"
-	default:
+	updateField, ok := models.APIKeyField(keyType)
+	if !ok || !services.IsSupportedProvider(keyType) {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Invalid key type. Must be 'openai', 'gemini', or 'claude'",
+			"message": "Invalid key type. Must be " + services.SupportedProvidersMessage(),
 		})
 	}
 
 	result, err := collection.UpdateOne(
-		context.Background(),
+		c.UserContext(),
 		bson.M{"clerkId": clerkUserID},
-		bson.M{"$set": bson.M{updateField: "", "updatedAt": time.Now()}},
+		bson.M{
+			"$set":   bson.M{updateField: "", "updatedAt": time.Now()},
+			"$unset": bson.M{"apiKeysVerifiedAt." + keyType: ""},
+		},
 	)
 
 	if err != nil {
@@ -1,7 +1,6 @@
 package user
 
 import (
-	"context"
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
 	"log"
@@ -20,7 +19,7 @@ func UpdateUser(c *fiber.Ctx) error {
 		return c.Status(500).JSON(fiber.Map{"message": err.Error()})
 	}
 	collection := db.Collection("users")
-	_, err = collection.UpdateOne(context.Background(), bson.M{"_id": user.ID}, bson.M{"$set": user})
+	_, err = collection.UpdateOne(c.UserContext(), bson.M{"_id": user.ID}, bson.M{"$set": user})
 	if err != nil {
 		log.Fatal(err.Error())
 		return c.Status(500).JSON(fiber.Map{"message": err.Error()})
@@ -0,0 +1,169 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"log"
+	"server/database"
+	"server/middleware"
+	"server/models"
+	"server/services"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// VerifyAPIKeys checks the caller's stored keys against their providers and
+// reports the health of each. The body may name the providers to check;
+// otherwise every provider that takes a user key is checked. Keys that pass
+// have their last-verified timestamp refreshed.
+func VerifyAPIKeys(c *fiber.Ctx) error {
+	clerkUserID, err := middleware.GetClerkUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+
+	var verifyReq models.APIKeysVerifyRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&verifyReq); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "Invalid request body",
+				"error":   err.Error(),
+			})
+		}
+	}
+
+	providers := verifyReq.Providers
+	if len(providers) == 0 {
+		providers = keyedProviders()
+	}
+	for _, provider := range providers {
+		if _, ok := models.APIKeyField(provider); !ok || !services.IsSupportedProvider(provider) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "Invalid provider " + provider + ". Must be " + services.SupportedProvidersMessage(),
+			})
+		}
+	}
+
+	db, err := database.Connect()
+	if err != nil {
+		log.Printf("Database connection error: %v", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Database connection failed"})
+	}
+
+	collection := db.Collection("users")
+	user, err := middleware.CurrentUser(c)
+	if err != nil {
+		return err
+	}
+
+	keys := map[string]string{}
+	for _, provider := range providers {
+		keys[provider] = user.APIKey(provider)
+	}
+
+	results := checkAPIKeys(c.UserContext(), keys)
+	for i := range results {
+		if results[i].Status != models.APIKeyStatusValid {
+			if verifiedAt, ok := user.APIKeysVerifiedAt[results[i].Provider]; ok {
+				results[i].LastVerified = &verifiedAt
+			}
+		}
+	}
+
+	if verified := verifiedKeyFields(results); len(verified) > 0 {
+		_, err = collection.UpdateOne(c.UserContext(), bson.M{"clerkId": clerkUserID}, bson.M{"$set": verified})
+		if err != nil {
+			log.Printf("Failed to record API key verification: %v", err)
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "API keys verified",
+		"keys":    results,
+	})
+}
+
+// keyedProviders returns the registered providers that take a per-user key.
+func keyedProviders() []string {
+	var keyed []string
+	for _, provider := range services.ProviderNames() {
+		if _, ok := models.APIKeyField(provider); ok {
+			keyed = append(keyed, provider)
+		}
+	}
+	return keyed
+}
+
+// checkAPIKeys verifies every key concurrently and returns one result per
+// provider, sorted like services.ProviderNames. Keys must be sealed, like the
+// stored ones. An empty key is reported as missing without calling the
+// provider.
+func checkAPIKeys(ctx context.Context, keys map[string]string) []models.APIKeyHealth {
+	aiService := services.NewAIService()
+
+	var providers []string
+	for _, provider := range services.ProviderNames() {
+		if _, ok := keys[provider]; ok {
+			providers = append(providers, provider)
+		}
+	}
+
+	results := make([]models.APIKeyHealth, len(providers))
+	var wg sync.WaitGroup
+	for i, provider := range providers {
+		results[i] = models.APIKeyHealth{Provider: provider, Status: models.APIKeyStatusMissing}
+		if keys[provider] == "" {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := aiService.ValidateAPIKey(ctx, provider, services.Credentials{APIKey: keys[provider]})
+			results[i] = apiKeyHealth(provider, err)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func apiKeyHealth(provider string, err error) models.APIKeyHealth {
+	health := models.APIKeyHealth{Provider: provider}
+	if err == nil {
+		now := time.Now()
+		health.Status = models.APIKeyStatusValid
+		health.LastVerified = &now
+		return health
+	}
+
+	health.Status = models.APIKeyStatusUnverified
+	health.Error = err.Error()
+	if errors.Is(err, context.DeadlineExceeded) {
+		health.Code = "timeout"
+		return health
+	}
+
+	if providerErr, ok := services.AsProviderError(err); ok {
+		health.Code = providerErr.Code()
+		if providerErr.Kind == services.ErrorKindAuth {
+			health.Status = models.APIKeyStatusInvalid
+		}
+	}
+	return health
+}
+
+// verifiedKeyFields returns the $set fields that record a successful check
+// for every valid result.
+func verifiedKeyFields(results []models.APIKeyHealth) bson.M {
+	fields := bson.M{}
+	for _, result := range results {
+		if result.Status == models.APIKeyStatusValid {
+			fields["apiKeysVerifiedAt."+result.Provider] = *result.LastVerified
+		}
+	}
+	return fields
+}
@@ -1,10 +1,15 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 	"os"
+	"server/config"
 	"server/database"
 	"server/routes"
+	"server/utils"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -20,6 +25,29 @@ func main() {
 			if e, ok := err.(*fiber.Error); ok {
 				code = e.Code
 			}
+
+			var budgetErr *utils.BudgetExceededError
+			if errors.As(err, &budgetErr) {
+				return c.Status(budgetErr.StatusCode()).JSON(fiber.Map{
+					"error":   true,
+					"code":    "budget_exceeded",
+					"message": budgetErr.Error(),
+					"budget":  budgetErr.Status,
+				})
+			}
+
+			var conflictErr *utils.NoteVersionConflictError
+			if errors.As(err, &conflictErr) {
+				c.Set(fiber.HeaderETag, utils.NoteETag(conflictErr.Current.Version))
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+					"error":          true,
+					"code":           "version_conflict",
+					"message":        conflictErr.Error(),
+					"currentVersion": conflictErr.Current.Version,
+					"note":           conflictErr.Current,
+				})
+			}
+
 			log.Printf("Error: %v", err)
 			return c.Status(code).JSON(fiber.Map{
 				"error":   true,
@@ -32,13 +60,34 @@ func main() {
 		Format: "[${time}] ${status} - ${method} ${path} - ${latency}\n",
 	}))
 
-	app.Use(cors.New())
+	// Browsers only let clients read the response headers listed here.
+	app.Use(cors.New(cors.Config{
+		ExposeHeaders: "ETag, Retry-After, X-Budget-Warning",
+	}))
+
+	if err := utils.InitEncryption(); err != nil {
+		log.Fatalf("❌ Failed to load encryption keys: %v", err)
+	}
 
 	if err := database.Init(); err != nil {
 		log.Fatalf("❌ Failed to connect to database: %v", err)
 	}
 	defer database.Disconnect()
 
+	// A missing index only slows queries down, so it is not worth refusing to
+	// start over.
+	if err := database.EnsureIndexes(context.Background()); err != nil {
+		log.Printf("⚠️ Failed to create database indexes: %v", err)
+	}
+
+	// Deleted notes and chat sessions wait in the trash until they are
+	// purged here.
+	db, err := database.Connect()
+	if err != nil {
+		log.Fatalf("❌ Failed to connect to database: %v", err)
+	}
+	go utils.RunTrashPurge(context.Background(), db, config.Duration("TRASH_PURGE_INTERVAL", time.Hour))
+
 	routes.SetupRoutes(app)
 
 	app.Get("/", func(c *fiber.Ctx) error {
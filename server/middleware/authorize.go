@@ -0,0 +1,302 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"server/database"
+	"server/models"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	currentUserKey        = "currentUser"
+	authorizedNoteKey     = "authorizedNote"
+	authorizedNotebookKey = "authorizedNotebook"
+	authorizedChatKey     = "authorizedChatSession"
+	noteNotFoundMsg       = "Note not found"
+	notebookNotFoundMsg   = "Notebook not found"
+	sessionNotFoundMsg    = "Chat session not found"
+)
+
+// ErrUserProfileNotFound is returned by CurrentUser when the caller has
+// signed in but has no profile yet.
+var ErrUserProfileNotFound = fiber.NewError(fiber.StatusNotFound, "User profile not found. Please create your profile first.")
+
+// ResourceID extracts the ID of the resource a request targets.
+type ResourceID func(c *fiber.Ctx) string
+
+// FromParam reads the resource ID from a route parameter.
+func FromParam(name string) ResourceID {
+	return func(c *fiber.Ctx) string {
+		return c.Params(name)
+	}
+}
+
+// FromBody reads the resource ID from a string field of the JSON body. The
+// handler still parses the body itself afterwards.
+func FromBody(field string) ResourceID {
+	return func(c *fiber.Ctx) string {
+		var body map[string]json.RawMessage
+		if err := json.Unmarshal(c.Body(), &body); err != nil {
+			return ""
+		}
+		var id string
+		if err := json.Unmarshal(body[field], &id); err != nil {
+			return ""
+		}
+		return id
+	}
+}
+
+// LoadCurrentUser loads the authenticated caller's profile once per request
+// for CurrentUser and the Authorize middlewares. It runs after
+// ClerkMiddleware. Callers without a profile are let through so that they
+// can create one.
+func LoadCurrentUser() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		clerkUserID, err := GetClerkUserIDFromContext(c)
+		if err != nil {
+			return err
+		}
+
+		db, err := database.Connect()
+		if err != nil {
+			log.Printf("Database connection error: %v", err)
+			return fiber.NewError(fiber.StatusInternalServerError, "Database connection failed")
+		}
+
+		var user models.User
+		err = db.Collection("users").FindOne(c.UserContext(), bson.M{"clerkId": clerkUserID}).Decode(&user)
+		if err == nil {
+			c.Locals(currentUserKey, user)
+		} else if err != mongo.ErrNoDocuments {
+			log.Printf("Failed to find user: %v", err)
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to find user")
+		}
+
+		return c.Next()
+	}
+}
+
+// CurrentUser returns the profile loaded by LoadCurrentUser, or
+// ErrUserProfileNotFound.
+func CurrentUser(c *fiber.Ctx) (models.User, error) {
+	user, ok := c.Locals(currentUserKey).(models.User)
+	if !ok {
+		return models.User{}, ErrUserProfileNotFound
+	}
+	return user, nil
+}
+
+// AuthorizeNote resolves the note identified by id and lets the request
+// through only if the current user may access it. Notes the caller may not
+// see are reported as not found, so that their existence is not revealed,
+// and so are notes in the trash. Handlers read the note with CurrentNote.
+func AuthorizeNote(id ResourceID) fiber.Handler {
+	return authorizeNote(id, false)
+}
+
+// AuthorizeTrashedNote is AuthorizeNote for the trash: it only lets through
+// notes that are in it.
+func AuthorizeTrashedNote(id ResourceID) fiber.Handler {
+	return authorizeNote(id, true)
+}
+
+func authorizeNote(id ResourceID, trashed bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := CurrentUser(c)
+		if err != nil {
+			return err
+		}
+
+		noteID, err := primitive.ObjectIDFromHex(id(c))
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid note ID format")
+		}
+
+		var note models.Note
+		err = findResource(c.UserContext(), "notes", bson.M{"_id": noteID}, &note)
+		if err != nil {
+			return lookupError(err, "note", noteNotFoundMsg)
+		}
+
+		if !canAccessNote(user, note) {
+			log.Printf("Denied user %s access to note %s", user.ID.Hex(), noteID.Hex())
+			return fiber.NewError(fiber.StatusNotFound, noteNotFoundMsg)
+		}
+		if (note.DeletedAt != nil) != trashed {
+			return fiber.NewError(fiber.StatusNotFound, noteNotFoundMsg)
+		}
+
+		c.Locals(authorizedNoteKey, note)
+		return c.Next()
+	}
+}
+
+// CurrentNote returns the note authorized by AuthorizeNote.
+func CurrentNote(c *fiber.Ctx) (models.Note, error) {
+	note, ok := c.Locals(authorizedNoteKey).(models.Note)
+	if !ok {
+		log.Printf("CurrentNote used on %s without AuthorizeNote", c.Path())
+		return models.Note{}, fiber.NewError(fiber.StatusInternalServerError, "Note was not authorized")
+	}
+	return note, nil
+}
+
+// AuthorizeNotebook resolves the notebook identified by id and lets the
+// request through only if the current user may access it. Handlers read the
+// notebook with CurrentNotebook.
+func AuthorizeNotebook(id ResourceID) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := CurrentUser(c)
+		if err != nil {
+			return err
+		}
+
+		notebookID, err := primitive.ObjectIDFromHex(id(c))
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid notebook ID format")
+		}
+
+		var notebook models.Notebook
+		err = findResource(c.UserContext(), "notebooks", bson.M{"_id": notebookID}, &notebook)
+		if err != nil {
+			return lookupError(err, "notebook", notebookNotFoundMsg)
+		}
+
+		if !canAccessNotebook(user, notebook) {
+			log.Printf("Denied user %s access to notebook %s", user.ID.Hex(), notebookID.Hex())
+			return fiber.NewError(fiber.StatusNotFound, notebookNotFoundMsg)
+		}
+
+		c.Locals(authorizedNotebookKey, notebook)
+		return c.Next()
+	}
+}
+
+// CurrentNotebook returns the notebook authorized by AuthorizeNotebook.
+func CurrentNotebook(c *fiber.Ctx) (models.Notebook, error) {
+	notebook, ok := c.Locals(authorizedNotebookKey).(models.Notebook)
+	if !ok {
+		log.Printf("CurrentNotebook used on %s without AuthorizeNotebook", c.Path())
+		return models.Notebook{}, fiber.NewError(fiber.StatusInternalServerError, "Notebook was not authorized")
+	}
+	return notebook, nil
+}
+
+// AuthorizeChatSession resolves the chat session identified by id and lets
+// the request through only if it exists, is not in the trash and the current
+// user may access it. Handlers read the session with CurrentChatSession.
+func AuthorizeChatSession(id ResourceID) fiber.Handler {
+	return authorizeChatSession(id, false, false)
+}
+
+// AuthorizeChatSessionOrNew is AuthorizeChatSession for requests that start
+// a session when the ID is empty or not yet used. It still refuses IDs that
+// belong to another user or to a session in the trash.
+func AuthorizeChatSessionOrNew(id ResourceID) fiber.Handler {
+	return authorizeChatSession(id, true, false)
+}
+
+// AuthorizeTrashedChatSession is AuthorizeChatSession for the trash: it only
+// lets through sessions that are in it.
+func AuthorizeTrashedChatSession(id ResourceID) fiber.Handler {
+	return authorizeChatSession(id, false, true)
+}
+
+func authorizeChatSession(id ResourceID, allowNew, trashed bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := CurrentUser(c)
+		if err != nil {
+			return err
+		}
+
+		sessionID := id(c)
+		if sessionID == "" {
+			if allowNew {
+				return c.Next()
+			}
+			return fiber.NewError(fiber.StatusBadRequest, "Session ID is required")
+		}
+
+		var session models.ChatSession
+		err = findResource(c.UserContext(), "chat_sessions", bson.M{"sessionId": sessionID}, &session)
+		if err == mongo.ErrNoDocuments && allowNew {
+			return c.Next()
+		}
+		if err != nil {
+			return lookupError(err, "chat session", sessionNotFoundMsg)
+		}
+
+		if !canAccessChatSession(user, session) {
+			log.Printf("Denied user %s access to chat session %s", user.ID.Hex(), sessionID)
+			return fiber.NewError(fiber.StatusNotFound, sessionNotFoundMsg)
+		}
+		if (session.DeletedAt != nil) != trashed {
+			return fiber.NewError(fiber.StatusNotFound, sessionNotFoundMsg)
+		}
+
+		c.Locals(authorizedChatKey, session)
+		return c.Next()
+	}
+}
+
+// CurrentChatSession returns the session authorized by AuthorizeChatSession
+// or AuthorizeChatSessionOrNew. The second result is false when the request
+// starts a new session.
+func CurrentChatSession(c *fiber.Ctx) (models.ChatSession, bool) {
+	session, ok := c.Locals(authorizedChatKey).(models.ChatSession)
+	return session, ok
+}
+
+// errDatabaseConnection is returned by findResource when there is no
+// database to look in.
+var errDatabaseConnection = fiber.NewError(fiber.StatusInternalServerError, "Database connection failed")
+
+// findResource decodes the first document of collection matching filter
+// into out, or returns mongo.ErrNoDocuments. Tests replace it to authorize
+// against resources held in memory.
+var findResource = func(ctx context.Context, collection string, filter bson.M, out interface{}) error {
+	db, err := database.Connect()
+	if err != nil {
+		log.Printf("Database connection error: %v", err)
+		return errDatabaseConnection
+	}
+	return db.Collection(collection).FindOne(ctx, filter).Decode(out)
+}
+
+// lookupError turns a failed findResource for a resource of the given kind
+// into the response: notFoundMsg for a missing one, 500 otherwise.
+func lookupError(err error, kind, notFoundMsg string) error {
+	if err == mongo.ErrNoDocuments {
+		return fiber.NewError(fiber.StatusNotFound, notFoundMsg)
+	}
+	if err == errDatabaseConnection {
+		return err
+	}
+	log.Printf("Failed to get %s: %v", kind, err)
+	return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve "+kind)
+}
+
+// canAccessNote is the access policy for notes: only their owner may read or
+// change them.
+func canAccessNote(user models.User, note models.Note) bool {
+	return note.UserID == user.ID
+}
+
+// canAccessNotebook is the access policy for notebooks: only their owner may
+// see, change or fill them.
+func canAccessNotebook(user models.User, notebook models.Notebook) bool {
+	return notebook.UserID == user.ID
+}
+
+// canAccessChatSession is the access policy for chat sessions: only the user
+// who started a session may read, continue or delete it.
+func canAccessChatSession(user models.User, session models.ChatSession) bool {
+	return session.ClerkID == user.ClerkID
+}
@@ -0,0 +1,194 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"server/models"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	alice = models.User{ID: primitive.NewObjectID(), ClerkID: "user_alice"}
+	bob   = models.User{ID: primitive.NewObjectID(), ClerkID: "user_bob"}
+)
+
+// fakeResources stands in for the database with a note, notebook and chat
+// session for each user, plus a trashed note and session each.
+type fakeResources struct {
+	notes     map[primitive.ObjectID]models.Note
+	notebooks map[primitive.ObjectID]models.Notebook
+	sessions  map[string]models.ChatSession
+}
+
+func newFakeResources() *fakeResources {
+	deletedAt := time.Now()
+	r := &fakeResources{
+		notes:     map[primitive.ObjectID]models.Note{},
+		notebooks: map[primitive.ObjectID]models.Notebook{},
+		sessions:  map[string]models.ChatSession{},
+	}
+	for _, user := range []models.User{alice, bob} {
+		note := models.Note{ID: primitive.NewObjectID(), UserID: user.ID}
+		trashedNote := models.Note{ID: primitive.NewObjectID(), UserID: user.ID, DeletedAt: &deletedAt}
+		notebook := models.Notebook{ID: primitive.NewObjectID(), UserID: user.ID}
+		r.notes[note.ID] = note
+		r.notes[trashedNote.ID] = trashedNote
+		r.notebooks[notebook.ID] = notebook
+
+		session := models.ChatSession{SessionID: user.ClerkID + "-session", UserID: user.ID, ClerkID: user.ClerkID}
+		trashedSession := models.ChatSession{SessionID: user.ClerkID + "-trashed", UserID: user.ID, ClerkID: user.ClerkID, DeletedAt: &deletedAt}
+		r.sessions[session.SessionID] = session
+		r.sessions[trashedSession.SessionID] = trashedSession
+	}
+	return r
+}
+
+func (r *fakeResources) find(_ context.Context, collection string, filter bson.M, out interface{}) error {
+	var found bool
+	switch out := out.(type) {
+	case *models.Note:
+		*out, found = r.notes[filter["_id"].(primitive.ObjectID)]
+	case *models.Notebook:
+		*out, found = r.notebooks[filter["_id"].(primitive.ObjectID)]
+	case *models.ChatSession:
+		*out, found = r.sessions[filter["sessionId"].(string)]
+	}
+	if !found {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// noteOf returns the ID of user's note, in the trash or not.
+func (r *fakeResources) noteOf(user models.User, trashed bool) string {
+	for id, note := range r.notes {
+		if note.UserID == user.ID && (note.DeletedAt != nil) == trashed {
+			return id.Hex()
+		}
+	}
+	panic("no such note")
+}
+
+func (r *fakeResources) notebookOf(user models.User) string {
+	for id, notebook := range r.notebooks {
+		if notebook.UserID == user.ID {
+			return id.Hex()
+		}
+	}
+	panic("no such notebook")
+}
+
+func sessionOf(user models.User, trashed bool) string {
+	if trashed {
+		return user.ClerkID + "-trashed"
+	}
+	return user.ClerkID + "-session"
+}
+
+// authorize runs authorizer for a request by alice for id and reports the
+// response status and whether the handler behind it ran.
+func authorize(t *testing.T, authorizer fiber.Handler, id string) (int, bool) {
+	t.Helper()
+
+	reached := false
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals(currentUserKey, alice)
+		return c.Next()
+	})
+	app.Get("/resources/:id", authorizer, func(c *fiber.Ctx) error {
+		reached = true
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/resources/"+id, nil))
+	if err != nil {
+		t.Fatalf("app.Test() error = %v", err)
+	}
+	return resp.StatusCode, reached
+}
+
+func TestAuthorizeDeniesOtherUsersResources(t *testing.T) {
+	resources := newFakeResources()
+	defer func(find func(context.Context, string, bson.M, interface{}) error) { findResource = find }(findResource)
+	findResource = resources.find
+
+	byID := FromParam("id")
+	tests := []struct {
+		name        string
+		authorizer  fiber.Handler
+		id          string
+		wantStatus  int
+		wantReached bool
+	}{
+		{"note: own", AuthorizeNote(byID), resources.noteOf(alice, false), fiber.StatusOK, true},
+		{"note: other user's", AuthorizeNote(byID), resources.noteOf(bob, false), fiber.StatusNotFound, false},
+		{"note: own in trash", AuthorizeNote(byID), resources.noteOf(alice, true), fiber.StatusNotFound, false},
+		{"note: missing", AuthorizeNote(byID), primitive.NewObjectID().Hex(), fiber.StatusNotFound, false},
+		{"note: malformed ID", AuthorizeNote(byID), "not-an-id", fiber.StatusBadRequest, false},
+
+		{"trashed note: own", AuthorizeTrashedNote(byID), resources.noteOf(alice, true), fiber.StatusOK, true},
+		{"trashed note: other user's", AuthorizeTrashedNote(byID), resources.noteOf(bob, true), fiber.StatusNotFound, false},
+		{"trashed note: own not in trash", AuthorizeTrashedNote(byID), resources.noteOf(alice, false), fiber.StatusNotFound, false},
+
+		{"notebook: own", AuthorizeNotebook(byID), resources.notebookOf(alice), fiber.StatusOK, true},
+		{"notebook: other user's", AuthorizeNotebook(byID), resources.notebookOf(bob), fiber.StatusNotFound, false},
+		{"notebook: missing", AuthorizeNotebook(byID), primitive.NewObjectID().Hex(), fiber.StatusNotFound, false},
+
+		{"session: own", AuthorizeChatSession(byID), sessionOf(alice, false), fiber.StatusOK, true},
+		{"session: other user's", AuthorizeChatSession(byID), sessionOf(bob, false), fiber.StatusNotFound, false},
+		{"session: own in trash", AuthorizeChatSession(byID), sessionOf(alice, true), fiber.StatusNotFound, false},
+		{"session: missing", AuthorizeChatSession(byID), "unknown-session", fiber.StatusNotFound, false},
+
+		{"session or new: own", AuthorizeChatSessionOrNew(byID), sessionOf(alice, false), fiber.StatusOK, true},
+		{"session or new: unused ID", AuthorizeChatSessionOrNew(byID), "unknown-session", fiber.StatusOK, true},
+		{"session or new: other user's", AuthorizeChatSessionOrNew(byID), sessionOf(bob, false), fiber.StatusNotFound, false},
+		{"session or new: other user's in trash", AuthorizeChatSessionOrNew(byID), sessionOf(bob, true), fiber.StatusNotFound, false},
+		{"session or new: own in trash", AuthorizeChatSessionOrNew(byID), sessionOf(alice, true), fiber.StatusNotFound, false},
+
+		{"trashed session: own", AuthorizeTrashedChatSession(byID), sessionOf(alice, true), fiber.StatusOK, true},
+		{"trashed session: other user's", AuthorizeTrashedChatSession(byID), sessionOf(bob, true), fiber.StatusNotFound, false},
+		{"trashed session: own not in trash", AuthorizeTrashedChatSession(byID), sessionOf(alice, false), fiber.StatusNotFound, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, reached := authorize(t, tt.authorizer, tt.id)
+			if status != tt.wantStatus {
+				t.Errorf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if reached != tt.wantReached {
+				t.Errorf("handler reached = %v, want %v", reached, tt.wantReached)
+			}
+		})
+	}
+}
+
+func TestAuthorizeRequiresProfile(t *testing.T) {
+	resources := newFakeResources()
+	defer func(find func(context.Context, string, bson.M, interface{}) error) { findResource = find }(findResource)
+	findResource = resources.find
+
+	reached := false
+	app := fiber.New()
+	app.Get("/notes/:id", AuthorizeNote(FromParam("id")), func(c *fiber.Ctx) error {
+		reached = true
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/notes/"+resources.noteOf(alice, false), nil))
+	if err != nil {
+		t.Fatalf("app.Test() error = %v", err)
+	}
+	if resp.StatusCode != fiber.StatusNotFound || reached {
+		t.Errorf("without a profile: status %d, handler reached %v; want 404 and not reached", resp.StatusCode, reached)
+	}
+}
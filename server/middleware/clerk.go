@@ -1,7 +1,6 @@
 package middleware
 
 import (
-	"context"
 	"log"
 	"server/config"
 	"strings"
@@ -55,7 +54,7 @@ func ClerkMiddleware() fiber.Handler {
 			})
 		}
 
-		claims, err := jwt.Verify(context.Background(), &jwt.VerifyParams{
+		claims, err := jwt.Verify(c.UserContext(), &jwt.VerifyParams{
 			Token:  sessionToken,
 			Leeway: 30 * time.Second,
 			AuthorizedPartyHandler: func(azp string) bool {
@@ -125,7 +124,7 @@ func OptionalClerkMiddleware() fiber.Handler {
 
 		sessionToken := tokenParts[1]
 		if sessionToken != "" {
-			claims, err := jwt.Verify(context.Background(), &jwt.VerifyParams{
+			claims, err := jwt.Verify(c.UserContext(), &jwt.VerifyParams{
 				Token:  sessionToken,
 				Leeway: 30 * time.Second,
 				AuthorizedPartyHandler: func(azp string) bool {
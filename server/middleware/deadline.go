@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	baseContextKey = "baseContext"
+	timeoutKey     = "requestTimeout"
+)
+
+// Deadline bounds the work done for a request: c.UserContext() is cancelled
+// after timeout or when the handler returns. A Deadline on a route replaces
+// one inherited from its group rather than narrowing it, so slow routes can
+// be given more time than the group default.
+func Deadline(timeout time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		base, ok := c.Locals(baseContextKey).(context.Context)
+		if !ok {
+			base = c.UserContext()
+			c.Locals(baseContextKey, base)
+		}
+		c.Locals(timeoutKey, timeout)
+
+		ctx, cancel := context.WithTimeout(base, timeout)
+		defer cancel()
+
+		c.SetUserContext(ctx)
+		return c.Next()
+	}
+}
+
+// DetachedContext returns a context carrying the route's deadline that,
+// unlike c.UserContext(), outlives the handler. Streaming handlers use it for
+// the work done inside SetBodyStreamWriter and must call cancel when done.
+func DetachedContext(c *fiber.Ctx) (context.Context, context.CancelFunc) {
+	base, ok := c.Locals(baseContextKey).(context.Context)
+	if !ok {
+		base = c.UserContext()
+	}
+
+	timeout, ok := c.Locals(timeoutKey).(time.Duration)
+	if !ok {
+		return context.WithCancel(base)
+	}
+	return context.WithTimeout(base, timeout)
+}
+
+// CancelOnDisconnect cancels c.UserContext() when the client closes the
+// connection before the handler returns. fasthttp never cancels the request
+// context and does not read from the connection while the handler runs, so
+// the connection is watched here instead; as with net/http, the end of the
+// client's input is taken to mean it went away. Whatever the watch reads is
+// lost to the connection, so the response closes it.
+//
+// It must come after Deadline on the route. Streaming routes detect
+// disconnects by their failed writes instead and must not use it, since
+// their writers outlive the handler.
+func CancelOnDisconnect() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		conn := c.Context().Conn()
+		if conn == nil {
+			return c.Next()
+		}
+
+		ctx, cancel := context.WithCancel(c.UserContext())
+		defer cancel()
+		c.SetUserContext(ctx)
+		c.Context().SetConnectionClose()
+
+		watched := make(chan struct{})
+		go func() {
+			defer close(watched)
+			var b [1]byte
+			if _, err := conn.Read(b[:]); err != nil {
+				cancel()
+			}
+		}()
+		defer func() {
+			// Unblock the watch before the connection is handed back.
+			conn.SetReadDeadline(time.Unix(1, 0))
+			<-watched
+		}()
+
+		return c.Next()
+	}
+}
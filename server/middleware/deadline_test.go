@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// serve runs app on a local port until the test ends and returns its address.
+func serve(t *testing.T, app *fiber.App) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() error = %v", err)
+	}
+	go app.Listener(ln)
+	t.Cleanup(func() { app.Shutdown() })
+	return ln.Addr().String()
+}
+
+func TestCancelOnDisconnectCancelsWhenClientLeaves(t *testing.T) {
+	started := make(chan struct{})
+	result := make(chan error, 1)
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/wait", Deadline(time.Minute), CancelOnDisconnect(), func(c *fiber.Ctx) error {
+		close(started)
+		select {
+		case <-c.UserContext().Done():
+			result <- c.UserContext().Err()
+		case <-time.After(5 * time.Second):
+			result <- errors.New("context was not cancelled")
+		}
+		return nil
+	})
+
+	conn, err := net.Dial("tcp", serve(t, app))
+	if err != nil {
+		t.Fatalf("net.Dial() error = %v", err)
+	}
+	if _, err := io.WriteString(conn, "GET /wait HTTP/1.1\r\nHost: test\r\n\r\n"); err != nil {
+		t.Fatalf("writing request: %v", err)
+	}
+	<-started
+	conn.Close()
+
+	if err := <-result; !errors.Is(err, context.Canceled) {
+		t.Errorf("context error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestCancelOnDisconnectLeavesConnectedClientAlone(t *testing.T) {
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/wait", Deadline(time.Minute), CancelOnDisconnect(), func(c *fiber.Ctx) error {
+		select {
+		case <-c.UserContext().Done():
+			return c.Status(fiber.StatusInternalServerError).SendString(c.UserContext().Err().Error())
+		case <-time.After(100 * time.Millisecond):
+			return c.SendString("ok")
+		}
+	})
+
+	resp, err := http.Get("http://" + serve(t, app) + "/wait")
+	if err != nil {
+		t.Fatalf("http.Get() error = %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != fiber.StatusOK || string(body) != "ok" {
+		t.Errorf("response = %d %q, want 200 \"ok\"", resp.StatusCode, body)
+	}
+	if !resp.Close {
+		t.Error("response does not close the connection")
+	}
+}
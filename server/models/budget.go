@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+const (
+	BudgetPeriodDaily   = "daily"
+	BudgetPeriodMonthly = "monthly"
+
+	// BudgetAllProviders makes a budget apply to every provider combined.
+	BudgetAllProviders = "all"
+)
+
+// SpendingBudget caps how much a user can spend on a provider per period.
+// Either or both limits may be set; a zero limit is not enforced.
+type SpendingBudget struct {
+	Provider   string  `json:"provider" bson:"provider"`
+	Period     string  `json:"period" bson:"period"`
+	TokenLimit int     `json:"tokenLimit,omitempty" bson:"tokenLimit,omitempty"`
+	CostLimit  float64 `json:"costLimit,omitempty" bson:"costLimit,omitempty"`
+	WarnAt     float64 `json:"warnAt,omitempty" bson:"warnAt,omitempty"`
+}
+
+// BudgetStatus is a budget together with the usage counted against it in the
+// current period.
+type BudgetStatus struct {
+	Budget      SpendingBudget `json:"budget"`
+	UsedTokens  int            `json:"usedTokens"`
+	UsedCost    float64        `json:"usedCost"`
+	FractionUse float64        `json:"fractionUsed"`
+	Exceeded    bool           `json:"exceeded"`
+	Warning     bool           `json:"warning"`
+	PeriodStart time.Time      `json:"periodStart"`
+	ResetsAt    time.Time      `json:"resetsAt"`
+}
+
+type BudgetsUpdate struct {
+	Budgets []SpendingBudget `json:"budgets"`
+}
@@ -14,8 +14,14 @@ type ChatMessage struct {
 	Role      string             `json:"role" bson:"role"`
 	Content   string             `json:"content" bson:"content"`
 	Model     string             `json:"model" bson:"model"`
+	ModelID   string             `json:"modelId,omitempty" bson:"modelId,omitempty"`
 	MemoryIds []string           `json:"memoryIds,omitempty" bson:"memoryIds,omitempty"`
+	Usage     *TokenUsage        `json:"usage,omitempty" bson:"usage,omitempty"`
+	Citations []Citation         `json:"citations,omitempty" bson:"citations,omitempty"`
 	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	// DeletedAt is copied from the message's session while it is in the
+	// trash, so that searches can leave the message out.
+	DeletedAt *time.Time `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
 }
 
 type ChatSession struct {
@@ -26,9 +32,12 @@ type ChatSession struct {
 	Title        string             `json:"title" bson:"title"`
 	Model        string             `json:"model" bson:"model"`
 	MessageCount int                `json:"messageCount" bson:"messageCount"`
+	Usage        *TokenUsage        `json:"usage,omitempty" bson:"usage,omitempty"`
 	LastActivity time.Time          `json:"lastActivity" bson:"lastActivity"`
 	CreatedAt    time.Time          `json:"createdAt" bson:"createdAt"`
 	UpdatedAt    time.Time          `json:"updatedAt" bson:"updatedAt"`
+	// DeletedAt is set while the session is in the trash.
+	DeletedAt *time.Time `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
 }
 
 type Memory struct {
@@ -46,26 +55,73 @@ type Memory struct {
 	UpdatedAt  time.Time              `json:"updated_at"`
 }
 
+// Chat modes for ChatRequest.Mode.
+const (
+	ChatModeDefault = ""
+	// ChatModeNotes answers from the user's own notes and cites them.
+	ChatModeNotes = "notes"
+)
+
 type ChatRequest struct {
-	SessionID string `json:"sessionId"`
-	Message   string `json:"message" binding:"required"`
-	Model     string `json:"model" binding:"required"`
+	SessionID  string `json:"sessionId"`
+	Message    string `json:"message" binding:"required"`
+	Model      string `json:"model" binding:"required"`
+	ModelID    string `json:"modelId,omitempty"`
+	EndpointID string `json:"endpointId,omitempty"`
+	Mode       string `json:"mode,omitempty"`
+}
+
+// Citation is an excerpt of a note that a ChatModeNotes answer was given
+// from. The answer refers to it by Number, e.g. "[1]".
+type Citation struct {
+	Number  int                `json:"number" bson:"number"`
+	NoteID  primitive.ObjectID `json:"noteId" bson:"noteId"`
+	Title   string             `json:"title" bson:"title"`
+	Excerpt string             `json:"excerpt" bson:"excerpt"`
+	Score   float64            `json:"score" bson:"score"`
 }
 
 type ChatResponse struct {
-	SessionID string    `json:"sessionId"`
-	Message   string    `json:"message"`
-	Role      string    `json:"role"`
-	Model     string    `json:"model"`
-	Memories  []Memory  `json:"memories,omitempty"`
-	CreatedAt time.Time `json:"createdAt"`
+	SessionID   string       `json:"sessionId"`
+	Message     string       `json:"message"`
+	Role        string       `json:"role"`
+	Model       string       `json:"model"`
+	Memories    []Memory     `json:"memories,omitempty"`
+	Citations   []Citation   `json:"citations,omitempty"`
+	TokenBudget *TokenBudget `json:"tokenBudget,omitempty"`
+	Usage       *TokenUsage  `json:"usage,omitempty"`
+	CreatedAt   time.Time    `json:"createdAt"`
+
+	BudgetWarnings []BudgetStatus `json:"budgetWarnings,omitempty"`
+
+	// Model is the provider that answered and ModelID its model; they differ
+	// from the request when the fallback chain was used.
+	ModelID          string            `json:"modelId,omitempty"`
+	FallbackAttempts []FallbackAttempt `json:"fallbackAttempts,omitempty"`
+}
+
+// TokenBudget reports how a prompt was fitted into the model's context window.
+// Token counts are estimates.
+type TokenBudget struct {
+	ContextWindow     int `json:"contextWindow"`
+	ReservedForOutput int `json:"reservedForOutput"`
+	PromptTokens      int `json:"promptTokens"`
+	HistoryMessages   int `json:"historyMessages"`
+	TrimmedMessages   int `json:"trimmedMessages"`
 }
 
 type UpdateNoteRequest struct {
-	NoteID    string `json:"noteId" binding:"required"`
-	SessionID string `json:"sessionId" binding:"required"`
-	Model     string `json:"model" binding:"required"`
-	Prompt    string `json:"prompt,omitempty"`
+	NoteID     string `json:"noteId" binding:"required"`
+	SessionID  string `json:"sessionId" binding:"required"`
+	Model      string `json:"model" binding:"required"`
+	ModelID    string `json:"modelId,omitempty"`
+	Prompt     string `json:"prompt,omitempty"`
+	EndpointID string `json:"endpointId,omitempty"`
+
+	// Version is the note version the prompt was written against. When set,
+	// or when If-Match is sent, the AI's rewrite is only saved if the note
+	// is still at that version.
+	Version *int64 `json:"version,omitempty"`
 }
 
 type Mem0AddRequest struct {
@@ -0,0 +1,22 @@
+package models
+
+// FallbackTarget is one entry of a user's fallback chain. Model is optional
+// and defaults to the provider's default model; EndpointID selects the
+// self-hosted endpoint when Provider is "custom".
+type FallbackTarget struct {
+	Provider   string `json:"provider" bson:"provider"`
+	Model      string `json:"model,omitempty" bson:"model,omitempty"`
+	EndpointID string `json:"endpointId,omitempty" bson:"endpointId,omitempty"`
+}
+
+// FallbackAttempt records a provider that failed before another answered.
+type FallbackAttempt struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+	Code     string `json:"code"`
+	Error    string `json:"error"`
+}
+
+type FallbackChainUpdate struct {
+	FallbackChain []FallbackTarget `json:"fallbackChain"`
+}
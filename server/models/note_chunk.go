@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// NoteChunk is a piece of a note's content with its embedding, for semantic
+// search. Embeddings from different models cannot be compared, so each chunk
+// records the provider and model that produced it. ContentHash identifies the
+// title and content that were embedded.
+type NoteChunk struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	NoteID      primitive.ObjectID `json:"noteId" bson:"noteId"`
+	UserID      primitive.ObjectID `json:"userId" bson:"userId"`
+	Index       int                `json:"index" bson:"index"`
+	Text        string             `json:"text" bson:"text"`
+	Embedding   []float32          `json:"-" bson:"embedding"`
+	Provider    string             `json:"provider" bson:"provider"`
+	Model       string             `json:"model" bson:"model"`
+	ContentHash string             `json:"contentHash" bson:"contentHash"`
+	CreatedAt   time.Time          `json:"createdAt" bson:"createdAt"`
+}
+
+// SemanticSearchResult is a note found by semantic search, with the chunk of
+// it that is closest to the query.
+type SemanticSearchResult struct {
+	NoteID     primitive.ObjectID `json:"noteId"`
+	Title      string             `json:"title"`
+	Excerpt    string             `json:"excerpt"`
+	ChunkIndex int                `json:"chunkIndex"`
+	Score      float64            `json:"score"`
+}
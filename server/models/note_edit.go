@@ -0,0 +1,38 @@
+package models
+
+// Note edit operations proposed by the AI and applied by ApplySuggestion.
+const (
+	NoteEditInsertAfterHeading = "insert_after_heading"
+	NoteEditReplaceParagraph   = "replace_paragraph"
+	NoteEditDeleteParagraph    = "delete_paragraph"
+	NoteEditAppendListItems    = "append_list_items"
+	NoteEditAppend             = "append"
+)
+
+// NoteEdit is one structured change to a note's content. Which fields are
+// used depends on Op:
+//
+//   - insert_after_heading: Heading, Content
+//   - replace_paragraph:    Target (the paragraph's current text), Content
+//   - delete_paragraph:     Target
+//   - append_list_items:    Items, and optionally Heading to pick the list
+//     in that section instead of the note's last list
+//   - append:               Content
+type NoteEdit struct {
+	Op      string   `json:"op"`
+	Heading string   `json:"heading,omitempty"`
+	Target  string   `json:"target,omitempty"`
+	Content string   `json:"content,omitempty"`
+	Items   []string `json:"items,omitempty"`
+}
+
+// NoteSuggestion is a set of edits, plus an optional new title, that is
+// previewed or applied as a unit.
+type NoteSuggestion struct {
+	NewTitle string     `json:"newTitle,omitempty"`
+	Edits    []NoteEdit `json:"edits,omitempty"`
+
+	// NewContent replaces the whole note. It predates Edits and is kept for
+	// older clients; it cannot be combined with Edits.
+	NewContent string `json:"newContent,omitempty"`
+}
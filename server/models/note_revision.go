@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Where a note revision came from.
+const (
+	RevisionSourceManual     = "manual"
+	RevisionSourceAIChat     = "ai-chat"
+	RevisionSourceSuggestion = "suggestion"
+	RevisionSourceRestore    = "restore"
+
+	// RevisionSourceOriginal marks the snapshot taken of a note that was
+	// created before revisions were recorded, the first time it changes.
+	RevisionSourceOriginal = "original"
+)
+
+// NoteRevision is a snapshot of a note after one change. Revisions are
+// numbered from 1 per note and never modified.
+type NoteRevision struct {
+	ID      primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	NoteID  primitive.ObjectID `json:"noteId" bson:"noteId"`
+	UserID  primitive.ObjectID `json:"userId" bson:"userId"`
+	Number  int                `json:"number" bson:"number"`
+	Title   string             `json:"title" bson:"title"`
+	Content string             `json:"content,omitempty" bson:"content"`
+	Source  string             `json:"source" bson:"source"`
+
+	// Author is the Clerk ID of the user who made the change. AI changes
+	// also name the provider and model that wrote them.
+	Author   string `json:"author,omitempty" bson:"author,omitempty"`
+	Provider string `json:"provider,omitempty" bson:"provider,omitempty"`
+	ModelID  string `json:"modelId,omitempty" bson:"modelId,omitempty"`
+
+	// NoteVersion is the note's version once this revision was written.
+	NoteVersion  int64     `json:"noteVersion,omitempty" bson:"noteVersion,omitempty"`
+	RestoredFrom int       `json:"restoredFrom,omitempty" bson:"restoredFrom,omitempty"`
+	CreatedAt    time.Time `json:"createdAt" bson:"createdAt"`
+}
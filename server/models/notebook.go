@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// How DELETE /notebooks/:id treats what the notebook contains.
+const (
+	// NotebookDeleteMove moves the notebook's notes and child notebooks up
+	// to its parent.
+	NotebookDeleteMove = "move"
+	// NotebookDeleteCascade deletes the notebook's whole subtree, notes
+	// included.
+	NotebookDeleteCascade = "cascade"
+)
+
+// Notebook groups notes. Notebooks nest: ParentID is nil for a top-level
+// notebook.
+type Notebook struct {
+	ID        primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	UserID    primitive.ObjectID  `json:"userId" bson:"userId"`
+	Name      string              `json:"name" bson:"name"`
+	ParentID  *primitive.ObjectID `json:"parentId" bson:"parentId"`
+	CreatedAt time.Time           `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time           `json:"updatedAt" bson:"updatedAt"`
+}
+
+// NotebookNode is a notebook in the tree returned by GET /notebooks.
+// NoteCount only counts the notes directly in the notebook.
+type NotebookNode struct {
+	Notebook
+	NoteCount int            `json:"noteCount"`
+	Children  []NotebookNode `json:"children"`
+}
+
+// NotebookRequest creates or changes a notebook. On update, a nil field is
+// left unchanged and an empty ParentID moves the notebook to the top level.
+type NotebookRequest struct {
+	Name     *string `json:"name,omitempty"`
+	ParentID *string `json:"parentId,omitempty"`
+}
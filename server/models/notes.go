@@ -13,4 +13,43 @@ type Note struct {
 	UserID    primitive.ObjectID `json:"userId" bson:"userId,omitempty" binding:"required"`
 	CreatedAt time.Time          `json:"createdAt,omitempty" bson:"createdAt,omitempty" binding:"required"`
 	UpdatedAt time.Time          `json:"updatedAt,omitempty" bson:"updatedAt,omitempty" binding:"required"`
+
+	// Tags are stored normalized by utils.NormalizeTags.
+	Tags []string `json:"tags,omitempty" bson:"tags,omitempty"`
+
+	// NotebookID is the notebook the note is filed in, or nil for none.
+	NotebookID *primitive.ObjectID `json:"notebookId,omitempty" bson:"notebookId,omitempty"`
+
+	// Version goes up by one with every change to the note and is its ETag.
+	// Writes that name the version they started from fail with 409 Conflict
+	// if the note has moved on. Notes created before versioning read as 0.
+	Version int64 `json:"version" bson:"version"`
+
+	// Pinned notes are listed first, archived notes are left out of the
+	// note list unless asked for, and favorites can be listed on their own.
+	// The flags are only stored while set.
+	Pinned   bool `json:"pinned" bson:"pinned,omitempty"`
+	Archived bool `json:"archived" bson:"archived,omitempty"`
+	Favorite bool `json:"favorite" bson:"favorite,omitempty"`
+
+	// DeletedAt is set while the note is in the trash. Trashed notes are left
+	// out everywhere but the trash and are purged after the retention period.
+	DeletedAt *time.Time `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
+}
+
+// NoteSummary is the lightweight form of a note in listings: the start of
+// its content in place of the whole content.
+type NoteSummary struct {
+	ID         primitive.ObjectID  `json:"id"`
+	Title      string              `json:"title"`
+	Snippet    string              `json:"snippet"`
+	Tags       []string            `json:"tags,omitempty"`
+	NotebookID *primitive.ObjectID `json:"notebookId,omitempty"`
+	CreatedAt  time.Time           `json:"createdAt"`
+	UpdatedAt  time.Time           `json:"updatedAt"`
+	Version    int64               `json:"version"`
+	Pinned     bool                `json:"pinned"`
+	Archived   bool                `json:"archived"`
+	Favorite   bool                `json:"favorite"`
+	DeletedAt  *time.Time          `json:"deletedAt,omitempty"`
 }
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Kinds of SearchResult.
+const (
+	SearchResultNote = "note"
+	SearchResultChat = "chat"
+)
+
+// SearchResult is a note or chat message matching a search. For chat
+// messages ID is the message and Title the title of its session.
+type SearchResult struct {
+	Type      string             `json:"type"`
+	ID        primitive.ObjectID `json:"id"`
+	Title     string             `json:"title"`
+	Snippet   string             `json:"snippet"`
+	Score     float64            `json:"score"`
+	Tags      []string           `json:"tags,omitempty"`
+	SessionID string             `json:"sessionId,omitempty"`
+	Role      string             `json:"role,omitempty"`
+	CreatedAt time.Time          `json:"createdAt"`
+}
@@ -0,0 +1,14 @@
+package models
+
+// TagCount is a tag and how many of a user's notes carry it.
+type TagCount struct {
+	Name  string `json:"name" bson:"_id"`
+	Count int    `json:"count" bson:"count"`
+}
+
+// TagMergeRequest replaces every tag in Tags with Into on all of a user's
+// notes.
+type TagMergeRequest struct {
+	Tags []string `json:"tags"`
+	Into string   `json:"into"`
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TokenUsage holds token counts reported by a provider and the estimated
+// cost in USD derived from them.
+type TokenUsage struct {
+	PromptTokens     int     `json:"promptTokens" bson:"promptTokens"`
+	CompletionTokens int     `json:"completionTokens" bson:"completionTokens"`
+	TotalTokens      int     `json:"totalTokens" bson:"totalTokens"`
+	Cost             float64 `json:"cost" bson:"cost"`
+}
+
+// UsageEvent records a single provider call. It backs the daily and
+// per-model breakdowns of GET /user/usage.
+type UsageEvent struct {
+	ID               primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID           primitive.ObjectID `json:"userId" bson:"userId"`
+	ClerkID          string             `json:"clerkId" bson:"clerkId"`
+	SessionID        string             `json:"sessionId,omitempty" bson:"sessionId,omitempty"`
+	Source           string             `json:"source" bson:"source"`
+	Provider         string             `json:"provider" bson:"provider"`
+	Model            string             `json:"model" bson:"model"`
+	PromptTokens     int                `json:"promptTokens" bson:"promptTokens"`
+	CompletionTokens int                `json:"completionTokens" bson:"completionTokens"`
+	TotalTokens      int                `json:"totalTokens" bson:"totalTokens"`
+	Cost             float64            `json:"cost" bson:"cost"`
+	CreatedAt        time.Time          `json:"createdAt" bson:"createdAt"`
+}
+
+type UsageBreakdown struct {
+	Date             string  `json:"date,omitempty" bson:"date,omitempty"`
+	Provider         string  `json:"provider,omitempty" bson:"provider,omitempty"`
+	Model            string  `json:"model,omitempty" bson:"model,omitempty"`
+	Requests         int     `json:"requests" bson:"requests"`
+	PromptTokens     int     `json:"promptTokens" bson:"promptTokens"`
+	CompletionTokens int     `json:"completionTokens" bson:"completionTokens"`
+	TotalTokens      int     `json:"totalTokens" bson:"totalTokens"`
+	Cost             float64 `json:"cost" bson:"cost"`
+}
+
+type UsageSummary struct {
+	Since    time.Time        `json:"since"`
+	Totals   UsageBreakdown   `json:"totals"`
+	Daily    []UsageBreakdown `json:"daily"`
+	ByModel  []UsageBreakdown `json:"byModel"`
+	Lifetime *TokenUsage      `json:"lifetime,omitempty"`
+}
@@ -6,6 +6,8 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// User is a Klara account. Provider keys are stored sealed with
+// utils.SealSecret and are never serialized to JSON.
 type User struct {
 	ID        primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
 	ClerkID   string               `json:"clerkId" bson:"clerkId" binding:"required"`
@@ -13,11 +15,106 @@ type User struct {
 	Username  string               `json:"username,omitempty" bson:"username,omitempty"`
 	FirstName string               `json:"firstName,omitempty" bson:"firstName,omitempty"`
 	LastName  string               `json:"lastName,omitempty" bson:"lastName,omitempty"`
-	OpenAIKey string               `json:"openaiKey,omitempty" bson:"openaiKey,omitempty"`
-	GeminiKey string               `json:"geminiKey,omitempty" bson:"geminiKey,omitempty"`
+	OpenAIKey string               `json:"-" bson:"openaiKey,omitempty"`
+	GeminiKey string               `json:"-" bson:"geminiKey,omitempty"`
+	ClaudeKey string               `json:"-" bson:"claudeKey,omitempty"`
 	CreatedAt time.Time            `json:"createdAt,omitempty" bson:"createdAt,omitempty"`
 	UpdatedAt time.Time            `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
 	NoteIds   []primitive.ObjectID `json:"noteIds,omitempty" bson:"noteIds,omitempty"`
+	Usage     *TokenUsage          `json:"usage,omitempty" bson:"usage,omitempty"`
+	Budgets   []SpendingBudget     `json:"budgets,omitempty" bson:"budgets,omitempty"`
+
+	FallbackChain []FallbackTarget `json:"fallbackChain,omitempty" bson:"fallbackChain,omitempty"`
+
+	CustomEndpoints []CustomEndpoint `json:"customEndpoints,omitempty" bson:"customEndpoints,omitempty"`
+
+	// APIKeysVerifiedAt records, per provider, when the stored key last
+	// passed verification against the provider.
+	APIKeysVerifiedAt map[string]time.Time `json:"apiKeysVerifiedAt,omitempty" bson:"apiKeysVerifiedAt,omitempty"`
+}
+
+// CustomEndpoint is a self-hosted server speaking the OpenAI chat completions
+// format, such as Ollama, vLLM or LM Studio.
+type CustomEndpoint struct {
+	ID        string    `json:"id" bson:"id"`
+	Name      string    `json:"name" bson:"name"`
+	BaseURL   string    `json:"baseUrl" bson:"baseUrl"`
+	APIKey    string    `json:"-" bson:"apiKey,omitempty"`
+	Model     string    `json:"model" bson:"model"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt"`
+}
+
+// CustomEndpointProfile is the client-facing view of a CustomEndpoint that
+// never exposes the stored key.
+type CustomEndpointProfile struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	BaseURL   string    `json:"baseUrl"`
+	Model     string    `json:"model"`
+	HasAPIKey bool      `json:"hasApiKey"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type CustomEndpointRequest struct {
+	Name    string `json:"name"`
+	BaseURL string `json:"baseUrl"`
+	APIKey  string `json:"apiKey,omitempty"`
+	Model   string `json:"model"`
+}
+
+func NewCustomEndpointProfiles(endpoints []CustomEndpoint) []CustomEndpointProfile {
+	profiles := make([]CustomEndpointProfile, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		profiles = append(profiles, CustomEndpointProfile{
+			ID:        endpoint.ID,
+			Name:      endpoint.Name,
+			BaseURL:   endpoint.BaseURL,
+			Model:     endpoint.Model,
+			HasAPIKey: endpoint.APIKey != "",
+			CreatedAt: endpoint.CreatedAt,
+			UpdatedAt: endpoint.UpdatedAt,
+		})
+	}
+	return profiles
+}
+
+func (u User) FindCustomEndpoint(endpointID string) (CustomEndpoint, bool) {
+	for _, endpoint := range u.CustomEndpoints {
+		if endpoint.ID == endpointID {
+			return endpoint, true
+		}
+	}
+	return CustomEndpoint{}, false
+}
+
+// APIKeyField returns the bson field that stores the user's key for provider.
+func APIKeyField(provider string) (string, bool) {
+	switch provider {
+	case "openai":
+		return "openaiKey", true
+	case "gemini":
+		return "geminiKey", true
+	case "claude":
+		return "claudeKey", true
+	default:
+		return "", false
+	}
+}
+
+// APIKey returns the user's stored key for provider, or "" if none is set.
+func (u User) APIKey(provider string) string {
+	switch provider {
+	case "openai":
+		return u.OpenAIKey
+	case "gemini":
+		return u.GeminiKey
+	case "claude":
+		return u.ClaudeKey
+	default:
+		return ""
+	}
 }
 
 type UserWithNotes struct {
@@ -27,8 +124,6 @@ type UserWithNotes struct {
 	Username  string               `json:"username,omitempty" bson:"username,omitempty"`
 	FirstName string               `json:"firstName,omitempty" bson:"firstName,omitempty"`
 	LastName  string               `json:"lastName,omitempty" bson:"lastName,omitempty"`
-	OpenAIKey string               `json:"openaiKey,omitempty" bson:"openaiKey,omitempty"`
-	GeminiKey string               `json:"geminiKey,omitempty" bson:"geminiKey,omitempty"`
 	CreatedAt time.Time            `json:"createdAt,omitempty" bson:"createdAt,omitempty"`
 	UpdatedAt time.Time            `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
 	NoteIds   []primitive.ObjectID `json:"noteIds,omitempty" bson:"noteIds,omitempty"`
@@ -44,12 +139,54 @@ type UserProfile struct {
 	LastName     string               `json:"lastName,omitempty"`
 	HasOpenAIKey bool                 `json:"hasOpenaiKey"`
 	HasGeminiKey bool                 `json:"hasGeminiKey"`
+	HasClaudeKey bool                 `json:"hasClaudeKey"`
 	CreatedAt    time.Time            `json:"createdAt,omitempty"`
 	UpdatedAt    time.Time            `json:"updatedAt,omitempty"`
 	NoteIds      []primitive.ObjectID `json:"noteIds,omitempty"`
+
+	CustomEndpoints   []CustomEndpointProfile `json:"customEndpoints"`
+	APIKeysVerifiedAt map[string]time.Time    `json:"apiKeysVerifiedAt,omitempty"`
 }
 
 type APIKeysUpdate struct {
 	OpenAIKey string `json:"openaiKey,omitempty"`
 	GeminiKey string `json:"geminiKey,omitempty"`
+	ClaudeKey string `json:"claudeKey,omitempty"`
+}
+
+// Keys returns the keys present in the update by provider name.
+func (u APIKeysUpdate) Keys() map[string]string {
+	keys := map[string]string{}
+	if u.OpenAIKey != "" {
+		keys["openai"] = u.OpenAIKey
+	}
+	if u.GeminiKey != "" {
+		keys["gemini"] = u.GeminiKey
+	}
+	if u.ClaudeKey != "" {
+		keys["claude"] = u.ClaudeKey
+	}
+	return keys
+}
+
+const (
+	APIKeyStatusValid      = "valid"
+	APIKeyStatusInvalid    = "invalid"
+	APIKeyStatusUnverified = "unverified"
+	APIKeyStatusMissing    = "missing"
+)
+
+// APIKeyHealth is the outcome of checking one provider key. Unverified means
+// the provider could not be reached or answered with an error that says
+// nothing about the key itself.
+type APIKeyHealth struct {
+	Provider     string     `json:"provider"`
+	Status       string     `json:"status"`
+	Code         string     `json:"code,omitempty"`
+	Error        string     `json:"error,omitempty"`
+	LastVerified *time.Time `json:"lastVerified,omitempty"`
+}
+
+type APIKeysVerifyRequest struct {
+	Providers []string `json:"providers,omitempty"`
 }
@@ -1,15 +1,28 @@
 package routes
 
 import (
+	"server/config"
 	"server/handler/chat"
+	"server/handler/notebooks"
 	"server/handler/notes"
+	"server/handler/search"
+	"server/handler/trash"
 	"server/handler/user"
 	"server/middleware"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 func SetupRoutes(app *fiber.App) {
+	// Per-route deadlines. AI routes wait on providers that may be retried,
+	// and streams stay open for as long as the answer takes to generate.
+	requestDeadline := middleware.Deadline(config.Duration("REQUEST_TIMEOUT", 15*time.Second))
+	aiDeadline := middleware.Deadline(config.Duration("AI_REQUEST_TIMEOUT", 2*time.Minute))
+	streamDeadline := middleware.Deadline(config.Duration("AI_STREAM_TIMEOUT", 5*time.Minute))
+	// Non-streaming AI routes give up on the provider when the client leaves.
+	cancelOnDisconnect := middleware.CancelOnDisconnect()
+
 	api := app.Group("/api/v1")
 
 	public := api.Group("/public")
@@ -38,29 +51,92 @@ func SetupRoutes(app *fiber.App) {
 		})
 	})
 
-	protected := api.Group("/", middleware.ClerkMiddleware())
+	// Every protected request has its caller's profile loaded once. Routes
+	// that target a note, notebook or chat session authorize it before the handler
+	// runs, and handlers read it back with middleware.CurrentNote,
+	// middleware.CurrentNotebook and middleware.CurrentChatSession instead of
+	// querying it themselves.
+	protected := api.Group("/", requestDeadline, middleware.ClerkMiddleware(), middleware.LoadCurrentUser())
+	ownNote := middleware.AuthorizeNote(middleware.FromParam("id"))
+	ownNotebook := middleware.AuthorizeNotebook(middleware.FromParam("id"))
+	ownSession := middleware.AuthorizeChatSession(middleware.FromParam("sessionId"))
 
 	userRoutes := protected.Group("/user")
 	userRoutes.Post("/profile", user.CreateOrSyncUser)
 	userRoutes.Get("/profile", user.GetUserProfile)
 	userRoutes.Put("/api-keys", user.UpdateAPIKeys)
+	userRoutes.Post("/api-keys/verify", user.VerifyAPIKeys)
 	userRoutes.Delete("/api-keys/:keyType", user.DeleteAPIKey)
+	userRoutes.Get("/endpoints", user.GetCustomEndpoints)
+	userRoutes.Post("/endpoints", user.CreateCustomEndpoint)
+	userRoutes.Put("/endpoints/:endpointId", user.UpdateCustomEndpoint)
+	userRoutes.Delete("/endpoints/:endpointId", user.DeleteCustomEndpoint)
 	userRoutes.Get("/with-notes", user.GetUserWithNotes)
+	userRoutes.Get("/usage", user.GetUsage)
+	userRoutes.Get("/budgets", user.GetBudgets)
+	userRoutes.Put("/budgets", user.UpdateBudgets)
+	userRoutes.Get("/fallbacks", user.GetFallbackChain)
+	userRoutes.Put("/fallbacks", user.UpdateFallbackChain)
 
 	notesRoutes := protected.Group("/notes")
 	notesRoutes.Post("/", notes.CreateNote)
 	notesRoutes.Get("/", notes.GetMyNotes)
-	notesRoutes.Get("/:id", notes.GetNote)
-	notesRoutes.Put("/:id", notes.UpdateNote)
-	notesRoutes.Delete("/:id", notes.DeleteNote)
+	notesRoutes.Get("/:id", ownNote, notes.GetNote)
+	notesRoutes.Put("/:id", ownNote, notes.UpdateNote)
+	notesRoutes.Delete("/:id", ownNote, notes.DeleteNote)
+	notesRoutes.Post("/:id/pin", ownNote, notes.PinNote)
+	notesRoutes.Delete("/:id/pin", ownNote, notes.UnpinNote)
+	notesRoutes.Post("/:id/archive", ownNote, notes.ArchiveNote)
+	notesRoutes.Delete("/:id/archive", ownNote, notes.UnarchiveNote)
+	notesRoutes.Post("/:id/favorite", ownNote, notes.FavoriteNote)
+	notesRoutes.Delete("/:id/favorite", ownNote, notes.UnfavoriteNote)
+
+	notesRoutes.Post("/:id/chat", aiDeadline, cancelOnDisconnect, ownNote, chat.ChatWithNote)
+	notesRoutes.Post("/:id/chat/stream", streamDeadline, ownNote, chat.ChatWithNoteStream)
+	notesRoutes.Post("/:id/apply-suggestion", ownNote, notes.ApplySuggestion)
+	notesRoutes.Post("/:id/preview-suggestion", ownNote, notes.PreviewSuggestion)
+	notesRoutes.Get("/:id/revisions", ownNote, notes.ListNoteRevisions)
+	notesRoutes.Get("/:id/revisions/diff", ownNote, notes.DiffNoteRevisions)
+	notesRoutes.Get("/:id/revisions/:number", ownNote, notes.GetNoteRevision)
+	notesRoutes.Post("/:id/revisions/:number/restore", ownNote, notes.RestoreNoteRevision)
+
+	tagRoutes := protected.Group("/tags")
+	tagRoutes.Get("/", notes.ListTags)
+	tagRoutes.Post("/merge", notes.MergeTags)
+	tagRoutes.Put("/:tag", notes.RenameTag)
 
-	notesRoutes.Post("/:id/chat", chat.ChatWithNote)
-	notesRoutes.Post("/:id/apply-suggestion", notes.ApplySuggestion)
+	notebookRoutes := protected.Group("/notebooks")
+	notebookRoutes.Get("/", notebooks.ListNotebooks)
+	notebookRoutes.Post("/", notebooks.CreateNotebook)
+	notebookRoutes.Get("/:id", ownNotebook, notebooks.GetNotebook)
+	notebookRoutes.Put("/:id", ownNotebook, notebooks.UpdateNotebook)
+	notebookRoutes.Delete("/:id", ownNotebook, notebooks.DeleteNotebook)
+
+	searchRoutes := protected.Group("/search")
+	searchRoutes.Get("/", search.Search)
+	searchRoutes.Get("/semantic", aiDeadline, cancelOnDisconnect, search.SemanticSearch)
+	searchRoutes.Post("/semantic/reindex", search.ReindexNotes)
+
+	// Deleting a note or chat session moves it here. It can be restored or
+	// deleted for good until the trash purge removes it.
+	trashRoutes := protected.Group("/trash")
+	trashedNote := middleware.AuthorizeTrashedNote(middleware.FromParam("id"))
+	trashedSession := middleware.AuthorizeTrashedChatSession(middleware.FromParam("sessionId"))
+	trashRoutes.Get("/", trash.ListTrash)
+	trashRoutes.Post("/notes/:id/restore", trashedNote, trash.RestoreNote)
+	trashRoutes.Delete("/notes/:id", trashedNote, trash.DeleteNote)
+	trashRoutes.Post("/sessions/:sessionId/restore", trashedSession, trash.RestoreChatSession)
+	trashRoutes.Delete("/sessions/:sessionId", trashedSession, trash.DeleteChatSession)
 
 	chatRoutes := protected.Group("/chat")
-	chatRoutes.Post("/", chat.StartChat)
+	bodySession := middleware.AuthorizeChatSessionOrNew(middleware.FromBody("sessionId"))
+	chatRoutes.Post("/", aiDeadline, cancelOnDisconnect, bodySession, chat.StartChat)
+	chatRoutes.Post("/stream", streamDeadline, bodySession, chat.StartChatStream)
 	chatRoutes.Get("/sessions", chat.GetChatSessions)
-	chatRoutes.Get("/sessions/:sessionId", chat.GetChatHistory)
-	chatRoutes.Delete("/sessions/:sessionId", chat.DeleteChatSession)
-	chatRoutes.Post("/update-note", chat.UpdateNoteWithChat)
+	chatRoutes.Get("/sessions/:sessionId", ownSession, chat.GetChatHistory)
+	chatRoutes.Delete("/sessions/:sessionId", ownSession, chat.DeleteChatSession)
+	chatRoutes.Post("/update-note", aiDeadline, cancelOnDisconnect,
+		middleware.AuthorizeNote(middleware.FromBody("noteId")), bodySession, chat.UpdateNoteWithChat)
+
+	protected.Get("/models", chat.GetModelCatalog)
 }
@@ -0,0 +1,242 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// CatalogSourceBuiltin marks a catalog that only lists the models known
+	// to this server; CatalogSourceProvider marks one that was merged with the
+	// provider's list-models response for the caller's key.
+	CatalogSourceBuiltin  = "builtin"
+	CatalogSourceProvider = "provider"
+
+	// catalogRefreshInterval is how long a provider's model list is reused
+	// before it is fetched again for the same key.
+	catalogRefreshInterval = time.Hour
+)
+
+// CatalogModel describes a model that can be selected for a chat.
+type CatalogModel struct {
+	ID            string        `json:"id"`
+	Name          string        `json:"name,omitempty"`
+	ContextWindow int           `json:"contextWindow"`
+	Streaming     bool          `json:"streaming"`
+	Vision        bool          `json:"vision"`
+	Pricing       *ModelPricing `json:"pricing,omitempty"`
+	Default       bool          `json:"default,omitempty"`
+}
+
+// ProviderCatalog is the set of models offered by one provider. Custom
+// endpoints get a catalog each, identified by EndpointID.
+type ProviderCatalog struct {
+	Provider     string         `json:"provider"`
+	EndpointID   string         `json:"endpointId,omitempty"`
+	EndpointName string         `json:"endpointName,omitempty"`
+	DefaultModel string         `json:"defaultModel,omitempty"`
+	Capabilities Capabilities   `json:"capabilities"`
+	Source       string         `json:"source"`
+	RefreshedAt  *time.Time     `json:"refreshedAt,omitempty"`
+	RefreshError string         `json:"refreshError,omitempty"`
+	Models       []CatalogModel `json:"models"`
+}
+
+// Has reports whether modelID is listed in the catalog.
+func (pc ProviderCatalog) Has(modelID string) bool {
+	for _, model := range pc.Models {
+		if model.ID == modelID {
+			return true
+		}
+	}
+	return false
+}
+
+// builtinModels lists the chat models offered for each built-in provider
+// before, or without, asking the provider. Context windows and prices come
+// from contextWindows and modelPrices.
+var builtinModels = map[string][]struct {
+	id       string
+	name     string
+	noVision bool
+}{
+	"openai": {
+		{id: "gpt-4o-mini", name: "GPT-4o mini"},
+		{id: "gpt-4o", name: "GPT-4o"},
+		{id: "gpt-4.1", name: "GPT-4.1"},
+		{id: "gpt-4.1-mini", name: "GPT-4.1 mini"},
+		{id: "gpt-4.1-nano", name: "GPT-4.1 nano"},
+		{id: "gpt-4-turbo", name: "GPT-4 Turbo"},
+		{id: "gpt-4", name: "GPT-4", noVision: true},
+		{id: "gpt-3.5-turbo", name: "GPT-3.5 Turbo", noVision: true},
+		{id: "o1", name: "o1"},
+		{id: "o1-mini", name: "o1-mini", noVision: true},
+		{id: "o3", name: "o3"},
+		{id: "o3-mini", name: "o3-mini", noVision: true},
+		{id: "o4-mini", name: "o4-mini"},
+	},
+	"gemini": {
+		{id: "gemini-2.0-flash", name: "Gemini 2.0 Flash"},
+		{id: "gemini-2.5-flash", name: "Gemini 2.5 Flash"},
+		{id: "gemini-2.5-pro", name: "Gemini 2.5 Pro"},
+		{id: "gemini-1.5-flash", name: "Gemini 1.5 Flash"},
+		{id: "gemini-1.5-pro", name: "Gemini 1.5 Pro"},
+	},
+	"claude": {
+		{id: "claude-3-5-haiku-latest", name: "Claude 3.5 Haiku"},
+		{id: "claude-sonnet-4-20250514", name: "Claude Sonnet 4"},
+		{id: "claude-opus-4-20250514", name: "Claude Opus 4"},
+		{id: "claude-3-7-sonnet-latest", name: "Claude 3.7 Sonnet"},
+		{id: "claude-3-5-sonnet-latest", name: "Claude 3.5 Sonnet"},
+		{id: "claude-3-haiku-20240307", name: "Claude 3 Haiku"},
+	},
+}
+
+// nonChatModelMarkers filters embedding, audio, image and similar models out
+// of list-models responses, which return everything a key can access.
+var nonChatModelMarkers = []string{
+	"embedding", "whisper", "tts", "dall-e", "davinci", "babbage", "moderation",
+	"transcribe", "realtime", "audio", "image", "search", "computer-use",
+	"aqa", "imagen", "veo",
+}
+
+type cachedModelList struct {
+	models    []ModelInfo
+	fetchedAt time.Time
+}
+
+var (
+	modelListsMu sync.Mutex
+	modelLists   = map[string]cachedModelList{}
+)
+
+// modelListKey identifies a cached model list without keeping the key itself
+// in memory longer than necessary.
+func modelListKey(providerName string, creds Credentials) string {
+	sum := sha256.Sum256([]byte(creds.APIKey))
+	return providerName + "|" + creds.BaseURL + "|" + hex.EncodeToString(sum[:8])
+}
+
+// canListModels reports whether creds are enough to call the provider's
+// list-models API. Custom endpoints may run without a key.
+func canListModels(providerName string, creds Credentials) bool {
+	if providerName == CustomProviderName {
+		return creds.BaseURL != ""
+	}
+	return creds.APIKey != ""
+}
+
+// listModelsCached returns the provider's model list for creds, fetching it
+// again once it is older than catalogRefreshInterval or when forced.
+func listModelsCached(ctx context.Context, provider Provider, creds Credentials, force bool) ([]ModelInfo, time.Time, error) {
+	key := modelListKey(provider.Name(), creds)
+
+	modelListsMu.Lock()
+	cached, ok := modelLists[key]
+	modelListsMu.Unlock()
+	if ok && !force && time.Since(cached.fetchedAt) < catalogRefreshInterval {
+		return cached.models, cached.fetchedAt, nil
+	}
+
+	listed, err := provider.ListModels(ctx, creds)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	fetchedAt := time.Now()
+	modelListsMu.Lock()
+	modelLists[key] = cachedModelList{models: listed, fetchedAt: fetchedAt}
+	modelListsMu.Unlock()
+	return listed, fetchedAt, nil
+}
+
+func isChatModel(modelID string) bool {
+	id := strings.ToLower(modelID)
+	for _, marker := range nonChatModelMarkers {
+		if strings.Contains(id, marker) {
+			return false
+		}
+	}
+	return true
+}
+
+func catalogModel(id, name string, capabilities Capabilities, vision bool) CatalogModel {
+	return CatalogModel{
+		ID:            id,
+		Name:          name,
+		ContextWindow: ContextWindow(id),
+		Streaming:     capabilities.Streaming,
+		Vision:        capabilities.Vision && vision,
+		Pricing:       PriceOf(id),
+	}
+}
+
+// ModelCatalog returns the models offered by providerName. When creds allow
+// it the built-in list is merged with the provider's own list-models
+// response, which is cached per key; a failed refresh falls back to the
+// built-in list and is reported in RefreshError.
+func ModelCatalog(ctx context.Context, providerName string, creds Credentials, forceRefresh bool) (ProviderCatalog, error) {
+	provider, err := GetProvider(providerName)
+	if err != nil {
+		return ProviderCatalog{}, err
+	}
+
+	catalog := ProviderCatalog{
+		Provider:     providerName,
+		DefaultModel: provider.DefaultModel(),
+		Capabilities: provider.Capabilities(),
+		Source:       CatalogSourceBuiltin,
+		Models:       []CatalogModel{},
+	}
+
+	for _, builtin := range builtinModels[providerName] {
+		catalog.Models = append(catalog.Models, catalogModel(builtin.id, builtin.name, catalog.Capabilities, !builtin.noVision))
+	}
+
+	if canListModels(providerName, creds) {
+		listed, fetchedAt, err := listModelsCached(ctx, provider, creds, forceRefresh)
+		if err != nil {
+			log.Printf("Failed to refresh %s model catalog: %v", providerName, err)
+			catalog.RefreshError = err.Error()
+		} else {
+			catalog.Source = CatalogSourceProvider
+			catalog.RefreshedAt = &fetchedAt
+			for _, model := range listed {
+				if !isChatModel(model.ID) || catalog.Has(model.ID) {
+					continue
+				}
+				catalog.Models = append(catalog.Models, catalogModel(model.ID, model.Name, catalog.Capabilities, true))
+			}
+		}
+	}
+
+	for i := range catalog.Models {
+		catalog.Models[i].Default = catalog.Models[i].ID == catalog.DefaultModel
+	}
+	return catalog, nil
+}
+
+// ValidateModel checks that modelID is offered by providerName for creds.
+// Custom endpoints whose model list cannot be fetched accept any model, since
+// many self-hosted servers do not implement list-models.
+func ValidateModel(ctx context.Context, providerName, modelID string, creds Credentials) error {
+	catalog, err := ModelCatalog(ctx, providerName, creds, false)
+	if err != nil {
+		return err
+	}
+
+	if catalog.Has(modelID) {
+		return nil
+	}
+	if providerName == CustomProviderName && catalog.Source != CatalogSourceProvider {
+		return nil
+	}
+
+	return fmt.Errorf("model %q is not available for provider %s", modelID, providerName)
+}
@@ -0,0 +1,271 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"server/models"
+)
+
+const claudeAPIVersion = "2023-06-01"
+
+type ClaudeMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type ClaudeRequest struct {
+	Model       string          `json:"model"`
+	System      string          `json:"system,omitempty"`
+	Messages    []ClaudeMessage `json:"messages"`
+	MaxTokens   int             `json:"max_tokens"`
+	Temperature float64         `json:"temperature,omitempty"`
+	Stream      bool            `json:"stream,omitempty"`
+}
+
+type ClaudeResponse struct {
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	StopReason string      `json:"stop_reason"`
+	Usage      ClaudeUsage `json:"usage"`
+}
+
+type ClaudeUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type ClaudeModelList struct {
+	Data []struct {
+		ID          string `json:"id"`
+		DisplayName string `json:"display_name"`
+	} `json:"data"`
+}
+
+type ClaudeStreamEvent struct {
+	Type  string `json:"type"`
+	Delta struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"delta"`
+	Message struct {
+		Usage ClaudeUsage `json:"usage"`
+	} `json:"message"`
+	Usage ClaudeUsage `json:"usage"`
+}
+
+type claudeProvider struct {
+	client       *http.Client
+	streamClient *http.Client
+}
+
+func init() {
+	RegisterProvider(&claudeProvider{
+		client:       newProviderClient(),
+		streamClient: newStreamClient(),
+	})
+}
+
+func (p *claudeProvider) Name() string {
+	return "claude"
+}
+
+func (p *claudeProvider) DefaultModel() string {
+	return "claude-3-5-haiku-latest"
+}
+
+func (p *claudeProvider) Capabilities() Capabilities {
+	return Capabilities{Streaming: true, Vision: true}
+}
+
+func buildClaudeRequest(chatContext string, messages []Message, modelID string) ClaudeRequest {
+	request := ClaudeRequest{
+		Model:       modelID,
+		Messages:    buildClaudeMessages(messages),
+		MaxTokens:   maxResponseTokens,
+		Temperature: 0.7,
+	}
+
+	if chatContext != "" {
+		request.System = fmt.Sprintf("Context from previous conversations:\n%s", chatContext)
+	}
+
+	return request
+}
+
+// buildClaudeMessages converts messages to the Messages API format, which
+// requires the conversation to start with a user turn and to alternate roles.
+func buildClaudeMessages(messages []Message) []ClaudeMessage {
+	claudeMessages := []ClaudeMessage{}
+
+	for _, message := range messages {
+		if len(claudeMessages) == 0 && message.Role != "user" {
+			continue
+		}
+
+		last := len(claudeMessages) - 1
+		if last >= 0 && claudeMessages[last].Role == message.Role {
+			claudeMessages[last].Content += "\n\n" + message.Content
+			continue
+		}
+
+		claudeMessages = append(claudeMessages, ClaudeMessage{
+			Role:    message.Role,
+			Content: message.Content,
+		})
+	}
+
+	return claudeMessages
+}
+
+func newClaudeHTTPRequest(ctx context.Context, request ClaudeRequest, creds Credentials) (*http.Request, error) {
+	url := "https://api.anthropic.com/v1/messages"
+
+	apiKey, err := creds.apiKey()
+	if err != nil {
+		return nil, err
+	}
+
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Add("x-api-key", apiKey)
+	req.Header.Add("anthropic-version", claudeAPIVersion)
+	req.Header.Add("Content-Type", "application/json")
+
+	return req, nil
+}
+
+func (p *claudeProvider) Chat(ctx context.Context, chatContext string, messages []Message, modelID string, creds Credentials) (Completion, error) {
+	req, err := newClaudeHTTPRequest(ctx, buildClaudeRequest(chatContext, messages, modelID), creds)
+	if err != nil {
+		return Completion{}, err
+	}
+
+	body, err := doProviderRequest(p.client, p.Name(), req)
+	if err != nil {
+		return Completion{}, err
+	}
+
+	var claudeResp ClaudeResponse
+	if err := json.Unmarshal(body, &claudeResp); err != nil {
+		return Completion{}, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	var text string
+	for _, block := range claudeResp.Content {
+		if block.Type == "text" {
+			text += block.Text
+		}
+	}
+
+	if text == "" {
+		if claudeResp.StopReason == "refusal" {
+			return Completion{}, &ProviderError{Provider: p.Name(), Kind: ErrorKindContentFilter}
+		}
+		return Completion{}, fmt.Errorf("no response from Claude")
+	}
+
+	return Completion{
+		Content: text,
+		Usage: models.TokenUsage{
+			PromptTokens:     claudeResp.Usage.InputTokens,
+			CompletionTokens: claudeResp.Usage.OutputTokens,
+		},
+	}, nil
+}
+
+func (p *claudeProvider) StreamChat(ctx context.Context, chatContext string, messages []Message, modelID string, creds Credentials, onDelta StreamHandler) (models.TokenUsage, error) {
+	var usage models.TokenUsage
+
+	request := buildClaudeRequest(chatContext, messages, modelID)
+	request.Stream = true
+
+	req, err := newClaudeHTTPRequest(ctx, request, creds)
+	if err != nil {
+		return usage, err
+	}
+	req.Header.Add("Accept", "text/event-stream")
+
+	resp, err := openProviderStream(p.streamClient, p.Name(), req)
+	if err != nil {
+		return usage, err
+	}
+	defer resp.Body.Close()
+
+	err = readSSEData(resp.Body, func(data string) error {
+		var event ClaudeStreamEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return fmt.Errorf("failed to unmarshal stream chunk: %w", err)
+		}
+
+		switch event.Type {
+		case "message_start":
+			usage.PromptTokens = event.Message.Usage.InputTokens
+			usage.CompletionTokens = event.Message.Usage.OutputTokens
+		case "message_delta":
+			// output_tokens here is cumulative for the whole message.
+			usage.CompletionTokens = event.Usage.OutputTokens
+		case "content_block_delta":
+			if event.Delta.Type != "text_delta" || event.Delta.Text == "" {
+				return nil
+			}
+			return onDelta(event.Delta.Text)
+		case "message_stop":
+			return errStreamDone
+		case "error":
+			return newStreamError(p.Name(), data)
+		}
+		return nil
+	})
+	return usage, err
+}
+
+func (p *claudeProvider) ValidateKey(ctx context.Context, creds Credentials) error {
+	_, err := p.ListModels(ctx, creds)
+	return err
+}
+
+func (p *claudeProvider) ListModels(ctx context.Context, creds Credentials) ([]ModelInfo, error) {
+	url := "https://api.anthropic.com/v1/models"
+
+	apiKey, err := creds.apiKey()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Add("x-api-key", apiKey)
+	req.Header.Add("anthropic-version", claudeAPIVersion)
+
+	body, err := doProviderRequest(p.client, p.Name(), req)
+	if err != nil {
+		return nil, err
+	}
+
+	var list ClaudeModelList
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	models := make([]ModelInfo, 0, len(list.Data))
+	for _, model := range list.Data {
+		models = append(models, ModelInfo{ID: model.ID, Name: model.DisplayName})
+	}
+	return models, nil
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"server/models"
+	"strings"
+	"unicode/utf8"
+)
+
+// Message is a single conversation turn sent to a provider. Role is either
+// "user" or "assistant"; providers translate it to their own vocabulary.
+type Message struct {
+	Role    string
+	Content string
+}
+
+const (
+	// maxResponseTokens is the completion size requested from every provider
+	// and is held back from the prompt budget.
+	maxResponseTokens = 1000
+
+	defaultContextWindow = 8192
+
+	// perMessageTokenOverhead approximates the role and separator tokens
+	// each message costs on top of its content.
+	perMessageTokenOverhead = 4
+)
+
+// contextWindows maps model ID prefixes to their context window in tokens.
+// Longer prefixes are listed before shorter ones that they extend.
+var contextWindows = []struct {
+	prefix string
+	tokens int
+}{
+	{"gpt-4o", 128000},
+	{"gpt-4.1", 1047576},
+	{"gpt-4-turbo", 128000},
+	{"gpt-4", 8192},
+	{"gpt-3.5-turbo", 16385},
+	{"o1", 200000},
+	{"o3", 200000},
+	{"o4", 200000},
+	{"gemini-1.5-pro", 2097152},
+	{"gemini-1.5-flash", 1048576},
+	{"gemini-2", 1048576},
+	{"claude", 200000},
+}
+
+// ContextWindow returns the context window of modelID in tokens, falling back
+// to a conservative default for unknown and self-hosted models.
+func ContextWindow(modelID string) int {
+	for _, window := range contextWindows {
+		if strings.HasPrefix(modelID, window.prefix) {
+			return window.tokens
+		}
+	}
+	return defaultContextWindow
+}
+
+// EstimateTokens gives a rough token count for text using the common
+// four-characters-per-token heuristic.
+func EstimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// conversationTurns returns the user and assistant turns of history that can
+// be sent to a provider. A user turn followed by another one, or by the new
+// message, was never answered because its provider call failed. It is left
+// out so that turns keep alternating.
+func conversationTurns(history []models.ChatMessage) []models.ChatMessage {
+	turns := make([]models.ChatMessage, 0, len(history))
+	for _, turn := range history {
+		if turn.Role != "user" && turn.Role != "assistant" {
+			continue
+		}
+		if turn.Role == "user" && len(turns) > 0 && turns[len(turns)-1].Role == "user" {
+			turns = turns[:len(turns)-1]
+		}
+		turns = append(turns, turn)
+	}
+	if len(turns) > 0 && turns[len(turns)-1].Role == "user" {
+		turns = turns[:len(turns)-1]
+	}
+	return turns
+}
+
+// buildConversation turns the stored session turns plus the new user message
+// into provider messages. The oldest turns are dropped until the prompt fits
+// in the model's context window with room left for the response.
+func buildConversation(chatContext string, history []models.ChatMessage, message, modelID string) ([]Message, models.TokenBudget) {
+	history = conversationTurns(history)
+
+	budget := models.TokenBudget{
+		ContextWindow:     ContextWindow(modelID),
+		ReservedForOutput: maxResponseTokens,
+	}
+
+	used := EstimateTokens(chatContext) + EstimateTokens(message) + 2*perMessageTokenOverhead
+	available := budget.ContextWindow - budget.ReservedForOutput
+
+	// Walk backwards so the most recent turns win when space runs out.
+	kept := 0
+	for i := len(history) - 1; i >= 0; i-- {
+		cost := EstimateTokens(history[i].Content) + perMessageTokenOverhead
+		if used+cost > available {
+			break
+		}
+		used += cost
+		kept++
+	}
+
+	messages := make([]Message, 0, kept+1)
+	for _, turn := range history[len(history)-kept:] {
+		messages = append(messages, Message{Role: turn.Role, Content: turn.Content})
+	}
+	messages = append(messages, Message{Role: "user", Content: message})
+
+	budget.PromptTokens = used
+	budget.HistoryMessages = kept
+	budget.TrimmedMessages = len(history) - kept
+
+	return messages, budget
+}
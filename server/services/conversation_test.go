@@ -0,0 +1,54 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"server/models"
+)
+
+func TestBuildConversationSkipsUnusableTurns(t *testing.T) {
+	turn := func(role, content string) models.ChatMessage {
+		return models.ChatMessage{Role: role, Content: content}
+	}
+	tests := []struct {
+		name    string
+		history []models.ChatMessage
+		want    []Message
+	}{
+		{
+			name:    "alternating turns",
+			history: []models.ChatMessage{turn("user", "hi"), turn("assistant", "hello")},
+			want:    []Message{{Role: "user", Content: "hi"}, {Role: "assistant", Content: "hello"}},
+		},
+		{
+			name:    "other roles",
+			history: []models.ChatMessage{turn("system", "note"), turn("user", "hi"), turn("tool", "x"), turn("assistant", "hello")},
+			want:    []Message{{Role: "user", Content: "hi"}, {Role: "assistant", Content: "hello"}},
+		},
+		{
+			name:    "unanswered turn in the middle",
+			history: []models.ChatMessage{turn("user", "lost"), turn("user", "hi"), turn("assistant", "hello")},
+			want:    []Message{{Role: "user", Content: "hi"}, {Role: "assistant", Content: "hello"}},
+		},
+		{
+			name:    "unanswered last turn",
+			history: []models.ChatMessage{turn("user", "hi"), turn("assistant", "hello"), turn("user", "lost")},
+			want:    []Message{{Role: "user", Content: "hi"}, {Role: "assistant", Content: "hello"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages, budget := buildConversation("", tt.history, "next", "gpt-4o-mini")
+
+			want := append(tt.want, Message{Role: "user", Content: "next"})
+			if !reflect.DeepEqual(messages, want) {
+				t.Errorf("messages = %v, want %v", messages, want)
+			}
+			if budget.HistoryMessages != len(tt.want) || budget.TrimmedMessages != 0 {
+				t.Errorf("history %d, trimmed %d; want %d, 0", budget.HistoryMessages, budget.TrimmedMessages, len(tt.want))
+			}
+		})
+	}
+}
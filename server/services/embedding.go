@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"server/models"
+)
+
+// embedBatchSize is how many texts are embedded per provider request, within
+// every provider's limit.
+const embedBatchSize = 64
+
+// embeddingProviders are the providers that can embed notes, in the order
+// they are picked for a user who has keys for several.
+var embeddingProviders = []string{"openai", "gemini"}
+
+// ErrNoEmbeddingProvider is returned for users without a key for any of
+// embeddingProviders.
+var ErrNoEmbeddingProvider = errors.New("semantic search needs an OpenAI or Gemini API key")
+
+// Embedder is implemented by providers that can turn text into vectors for
+// semantic search.
+type Embedder interface {
+	DefaultEmbeddingModel() string
+	Embed(ctx context.Context, texts []string, modelID string, creds Credentials) ([][]float32, models.TokenUsage, error)
+}
+
+// EmbeddingTargetFor returns the provider, model and credentials used to
+// embed user's notes and queries.
+func EmbeddingTargetFor(user models.User) (ChatTarget, error) {
+	for _, name := range embeddingProviders {
+		apiKey := user.APIKey(name)
+		if apiKey == "" {
+			continue
+		}
+
+		provider, err := GetProvider(name)
+		if err != nil {
+			continue
+		}
+		if embedder, ok := provider.(Embedder); ok {
+			return ChatTarget{
+				Provider: name,
+				ModelID:  embedder.DefaultEmbeddingModel(),
+				Creds:    Credentials{APIKey: apiKey},
+			}, nil
+		}
+	}
+	return ChatTarget{}, ErrNoEmbeddingProvider
+}
+
+// EmbedTexts embeds texts with target in batches, retrying transient
+// failures like any other provider call. The returned usage covers all
+// batches, and on failure the batches that were billed before it.
+func EmbedTexts(ctx context.Context, target ChatTarget, texts []string) ([][]float32, models.TokenUsage, error) {
+	provider, err := GetProvider(target.Provider)
+	if err != nil {
+		return nil, models.TokenUsage{}, err
+	}
+	embedder, ok := provider.(Embedder)
+	if !ok {
+		return nil, models.TokenUsage{}, fmt.Errorf("provider %s cannot embed text", target.Provider)
+	}
+
+	var embeddings [][]float32
+	var usage models.TokenUsage
+	for start := 0; start < len(texts); start += embedBatchSize {
+		batch := texts[start:min(start+embedBatchSize, len(texts))]
+
+		var vectors [][]float32
+		var batchUsage models.TokenUsage
+		err := callProvider(ctx, target.Provider, target.Creds, func() error {
+			vectors, batchUsage, err = embedder.Embed(ctx, batch, target.ModelID, target.Creds)
+			return err
+		}, nil)
+		if err != nil {
+			return nil, finalizeUsage(target.ModelID, usage), err
+		}
+		usage.PromptTokens += batchUsage.PromptTokens
+		usage.TotalTokens += batchUsage.TotalTokens
+		if len(vectors) != len(batch) {
+			return nil, finalizeUsage(target.ModelID, usage), fmt.Errorf("%s returned %d embeddings for %d texts", target.Provider, len(vectors), len(batch))
+		}
+
+		embeddings = append(embeddings, vectors...)
+	}
+	return embeddings, finalizeUsage(target.ModelID, usage), nil
+}
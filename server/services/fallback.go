@@ -0,0 +1,56 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"server/models"
+)
+
+// ChatTarget is one provider/model pair to try, with the credentials to use
+// for it. AIService methods take them in order of preference: the one the
+// user asked for first, then their fallback chain.
+type ChatTarget struct {
+	Provider string
+	ModelID  string
+	Creds    Credentials
+}
+
+var errNoTargets = errors.New("no provider to send the request to")
+
+// tryTargets calls attempt for each target in turn until one succeeds. It
+// only moves on when the failure is one another provider may not share
+// (an outage, a rate limit or exhausted quota) and canFallback, if set,
+// still allows it. The attempts that failed before the answering target are
+// returned for reporting.
+func tryTargets(ctx context.Context, targets []ChatTarget, attempt func(target ChatTarget) error, canFallback func() bool) (ChatTarget, []models.FallbackAttempt, error) {
+	if len(targets) == 0 {
+		return ChatTarget{}, nil, errNoTargets
+	}
+
+	var attempts []models.FallbackAttempt
+	for i, target := range targets {
+		err := attempt(target)
+		if err == nil {
+			return target, attempts, nil
+		}
+
+		providerErr, ok := AsProviderError(err)
+		last := i == len(targets)-1
+		if last || !ok || !providerErr.Fallbackable() || ctx.Err() != nil || (canFallback != nil && !canFallback()) {
+			return target, attempts, err
+		}
+
+		log.Printf("%s/%s failed (%s), falling back to %s/%s",
+			target.Provider, target.ModelID, providerErr.Code(), targets[i+1].Provider, targets[i+1].ModelID)
+		attempts = append(attempts, models.FallbackAttempt{
+			Provider: target.Provider,
+			Model:    target.ModelID,
+			Code:     providerErr.Code(),
+			Error:    providerErr.Error(),
+		})
+	}
+
+	// Unreachable: the last target always returns above.
+	return ChatTarget{}, attempts, errNoTargets
+}
@@ -0,0 +1,338 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"server/models"
+	"strings"
+)
+
+type GeminiContent struct {
+	Parts []struct {
+		Text string `json:"text"`
+	} `json:"parts"`
+	Role string `json:"role,omitempty"`
+}
+
+type GeminiRequest struct {
+	Contents []GeminiContent `json:"contents"`
+}
+
+type GeminiResponse struct {
+	Candidates []struct {
+		Content      GeminiContent `json:"content"`
+		FinishReason string        `json:"finishReason"`
+	} `json:"candidates"`
+	PromptFeedback struct {
+		BlockReason string `json:"blockReason"`
+	} `json:"promptFeedback"`
+	UsageMetadata GeminiUsageMetadata `json:"usageMetadata"`
+}
+
+// blockReason explains why Gemini returned no text, if it was filtered.
+func (r GeminiResponse) blockReason() string {
+	if r.PromptFeedback.BlockReason != "" {
+		return r.PromptFeedback.BlockReason
+	}
+	if len(r.Candidates) > 0 {
+		switch reason := r.Candidates[0].FinishReason; reason {
+		case "SAFETY", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII", "RECITATION":
+			return reason
+		}
+	}
+	return ""
+}
+
+type GeminiUsageMetadata struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+	TotalTokenCount      int `json:"totalTokenCount"`
+}
+
+func (m GeminiUsageMetadata) tokenUsage() models.TokenUsage {
+	return models.TokenUsage{
+		PromptTokens:     m.PromptTokenCount,
+		CompletionTokens: m.CandidatesTokenCount,
+		TotalTokens:      m.TotalTokenCount,
+	}
+}
+
+type GeminiEmbedRequest struct {
+	Requests []GeminiEmbedContentRequest `json:"requests"`
+}
+
+type GeminiEmbedContentRequest struct {
+	Model   string        `json:"model"`
+	Content GeminiContent `json:"content"`
+}
+
+type GeminiEmbedResponse struct {
+	Embeddings []struct {
+		Values []float32 `json:"values"`
+	} `json:"embeddings"`
+}
+
+type GeminiModelList struct {
+	Models []struct {
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} `json:"models"`
+}
+
+type geminiProvider struct {
+	client       *http.Client
+	streamClient *http.Client
+}
+
+func init() {
+	RegisterProvider(&geminiProvider{
+		client:       newProviderClient(),
+		streamClient: newStreamClient(),
+	})
+}
+
+func (p *geminiProvider) Name() string {
+	return "gemini"
+}
+
+func (p *geminiProvider) DefaultModel() string {
+	return "gemini-2.0-flash"
+}
+
+func (p *geminiProvider) Capabilities() Capabilities {
+	return Capabilities{Streaming: true, Vision: true}
+}
+
+func (p *geminiProvider) Chat(ctx context.Context, chatContext string, messages []Message, modelID string, creds Credentials) (Completion, error) {
+	apiKey, err := creds.apiKey()
+	if err != nil {
+		return Completion{}, err
+	}
+	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent?key=%s", modelID, apiKey)
+
+	request := GeminiRequest{
+		Contents: buildGeminiContents(chatContext, messages),
+	}
+
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return Completion{}, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return Completion{}, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Add("Content-Type", "application/json")
+
+	body, err := doProviderRequest(p.client, p.Name(), req)
+	if err != nil {
+		return Completion{}, err
+	}
+
+	var geminiResp GeminiResponse
+	if err := json.Unmarshal(body, &geminiResp); err != nil {
+		return Completion{}, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if len(geminiResp.Candidates) == 0 || len(geminiResp.Candidates[0].Content.Parts) == 0 {
+		if reason := geminiResp.blockReason(); reason != "" {
+			return Completion{}, &ProviderError{Provider: p.Name(), Kind: ErrorKindContentFilter, Message: reason}
+		}
+		return Completion{}, fmt.Errorf("no response from Gemini")
+	}
+
+	return Completion{
+		Content: geminiResp.Candidates[0].Content.Parts[0].Text,
+		Usage:   geminiResp.UsageMetadata.tokenUsage(),
+	}, nil
+}
+
+func (p *geminiProvider) StreamChat(ctx context.Context, chatContext string, messages []Message, modelID string, creds Credentials, onDelta StreamHandler) (models.TokenUsage, error) {
+	var usage models.TokenUsage
+
+	apiKey, err := creds.apiKey()
+	if err != nil {
+		return usage, err
+	}
+	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:streamGenerateContent?alt=sse&key=%s", modelID, apiKey)
+
+	request := GeminiRequest{
+		Contents: buildGeminiContents(chatContext, messages),
+	}
+
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return usage, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return usage, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Accept", "text/event-stream")
+
+	resp, err := openProviderStream(p.streamClient, p.Name(), req)
+	if err != nil {
+		return usage, err
+	}
+	defer resp.Body.Close()
+
+	err = readSSEData(resp.Body, func(data string) error {
+		var chunk GeminiResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("failed to unmarshal stream chunk: %w", err)
+		}
+
+		// Every chunk reports the running totals, so the last one wins.
+		if chunk.UsageMetadata.TotalTokenCount > 0 {
+			usage = chunk.UsageMetadata.tokenUsage()
+		}
+
+		if len(chunk.Candidates) == 0 {
+			return nil
+		}
+
+		for _, part := range chunk.Candidates[0].Content.Parts {
+			if part.Text == "" {
+				continue
+			}
+			if err := onDelta(part.Text); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return usage, err
+}
+
+func (p *geminiProvider) ValidateKey(ctx context.Context, creds Credentials) error {
+	_, err := p.ListModels(ctx, creds)
+	return err
+}
+
+func (p *geminiProvider) ListModels(ctx context.Context, creds Credentials) ([]ModelInfo, error) {
+	apiKey, err := creds.apiKey()
+	if err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models?key=%s", apiKey)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	body, err := doProviderRequest(p.client, p.Name(), req)
+	if err != nil {
+		return nil, err
+	}
+
+	var list GeminiModelList
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	models := make([]ModelInfo, 0, len(list.Models))
+	for _, model := range list.Models {
+		models = append(models, ModelInfo{
+			ID:   strings.TrimPrefix(model.Name, "models/"),
+			Name: model.DisplayName,
+		})
+	}
+	return models, nil
+}
+
+func (p *geminiProvider) DefaultEmbeddingModel() string {
+	return "gemini-embedding-001"
+}
+
+// Embed embeds texts with batchEmbedContents. Gemini does not report token
+// counts for embeddings, so the returned usage is empty.
+func (p *geminiProvider) Embed(ctx context.Context, texts []string, modelID string, creds Credentials) ([][]float32, models.TokenUsage, error) {
+	apiKey, err := creds.apiKey()
+	if err != nil {
+		return nil, models.TokenUsage{}, err
+	}
+	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:batchEmbedContents?key=%s", modelID, apiKey)
+
+	request := GeminiEmbedRequest{}
+	for _, text := range texts {
+		var content GeminiContent
+		content.Parts = append(content.Parts, struct {
+			Text string `json:"text"`
+		}{Text: text})
+		request.Requests = append(request.Requests, GeminiEmbedContentRequest{
+			Model:   "models/" + modelID,
+			Content: content,
+		})
+	}
+
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return nil, models.TokenUsage{}, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, models.TokenUsage{}, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Add("Content-Type", "application/json")
+
+	body, err := doProviderRequest(p.client, p.Name(), req)
+	if err != nil {
+		return nil, models.TokenUsage{}, err
+	}
+
+	var embedResp GeminiEmbedResponse
+	if err := json.Unmarshal(body, &embedResp); err != nil {
+		return nil, models.TokenUsage{}, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	embeddings := make([][]float32, 0, len(embedResp.Embeddings))
+	for _, embedding := range embedResp.Embeddings {
+		embeddings = append(embeddings, embedding.Values)
+	}
+	return embeddings, models.TokenUsage{}, nil
+}
+
+func buildGeminiContents(chatContext string, messages []Message) []GeminiContent {
+	contents := []GeminiContent{}
+
+	if chatContext != "" {
+		contents = append(contents, GeminiContent{
+			Parts: []struct {
+				Text string `json:"text"`
+			}{
+				{Text: fmt.Sprintf("Context from previous conversations:\n%s", chatContext)},
+			},
+			Role: "user",
+		})
+	}
+
+	for _, message := range messages {
+		// Gemini calls the assistant side of the conversation "model".
+		role := message.Role
+		if role == "assistant" {
+			role = "model"
+		}
+
+		contents = append(contents, GeminiContent{
+			Parts: []struct {
+				Text string `json:"text"`
+			}{
+				{Text: message.Content},
+			},
+			Role: role,
+		})
+	}
+
+	return contents
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -32,7 +33,7 @@ func NewMemoryService() *MemoryService {
 	}
 }
 
-func (ms *MemoryService) AddMemory(request models.Mem0AddRequest) ([]models.Memory, error) {
+func (ms *MemoryService) AddMemory(ctx context.Context, request models.Mem0AddRequest) ([]models.Memory, error) {
 	url := fmt.Sprintf("%s/v1/memories/", ms.baseURL)
 
 	jsonData, err := json.Marshal(request)
@@ -40,7 +41,7 @@ func (ms *MemoryService) AddMemory(request models.Mem0AddRequest) ([]models.Memo
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -71,7 +72,7 @@ func (ms *MemoryService) AddMemory(request models.Mem0AddRequest) ([]models.Memo
 	return memories, nil
 }
 
-func (ms *MemoryService) SearchMemories(request models.Mem0SearchRequest) ([]models.Memory, error) {
+func (ms *MemoryService) SearchMemories(ctx context.Context, request models.Mem0SearchRequest) ([]models.Memory, error) {
 	url := fmt.Sprintf("%s/v2/memories/search/", ms.baseURL)
 
 	jsonData, err := json.Marshal(request)
@@ -79,7 +80,7 @@ func (ms *MemoryService) SearchMemories(request models.Mem0SearchRequest) ([]mod
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -110,7 +111,7 @@ func (ms *MemoryService) SearchMemories(request models.Mem0SearchRequest) ([]mod
 	return memories, nil
 }
 
-func (ms *MemoryService) GetMemories(request models.Mem0GetRequest) ([]models.Memory, error) {
+func (ms *MemoryService) GetMemories(ctx context.Context, request models.Mem0GetRequest) ([]models.Memory, error) {
 	url := fmt.Sprintf("%s/v2/memories/", ms.baseURL)
 
 	jsonData, err := json.Marshal(request)
@@ -118,7 +119,7 @@ func (ms *MemoryService) GetMemories(request models.Mem0GetRequest) ([]models.Me
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -149,10 +150,10 @@ func (ms *MemoryService) GetMemories(request models.Mem0GetRequest) ([]models.Me
 	return memories, nil
 }
 
-func (ms *MemoryService) GetMemory(memoryID string) (*models.Memory, error) {
+func (ms *MemoryService) GetMemory(ctx context.Context, memoryID string) (*models.Memory, error) {
 	url := fmt.Sprintf("%s/v1/memories/%s/", ms.baseURL, memoryID)
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -182,10 +183,10 @@ func (ms *MemoryService) GetMemory(memoryID string) (*models.Memory, error) {
 	return &memory, nil
 }
 
-func (ms *MemoryService) DeleteMemory(memoryID string) error {
+func (ms *MemoryService) DeleteMemory(ctx context.Context, memoryID string) error {
 	url := fmt.Sprintf("%s/v1/memories/%s/", ms.baseURL, memoryID)
 
-	req, err := http.NewRequest("DELETE", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
@@ -206,7 +207,7 @@ func (ms *MemoryService) DeleteMemory(memoryID string) error {
 	return nil
 }
 
-func (ms *MemoryService) BatchDeleteMemories(memoryIDs []string) error {
+func (ms *MemoryService) BatchDeleteMemories(ctx context.Context, memoryIDs []string) error {
 	url := fmt.Sprintf("%s/v1/batch/", ms.baseURL)
 
 	request := models.Mem0BatchDeleteRequest{
@@ -218,7 +219,7 @@ func (ms *MemoryService) BatchDeleteMemories(memoryIDs []string) error {
 		return fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequest("DELETE", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "DELETE", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
@@ -240,16 +241,16 @@ func (ms *MemoryService) BatchDeleteMemories(memoryIDs []string) error {
 	return nil
 }
 
-func (ms *MemoryService) GetUserMemories(userID string) ([]models.Memory, error) {
+func (ms *MemoryService) GetUserMemories(ctx context.Context, userID string) ([]models.Memory, error) {
 	request := models.Mem0GetRequest{
 		Filters: map[string]interface{}{
 			"user_id": userID,
 		},
 	}
-	return ms.GetMemories(request)
+	return ms.GetMemories(ctx, request)
 }
 
-func (ms *MemoryService) SearchUserMemories(userID, query string, topK int) ([]models.Memory, error) {
+func (ms *MemoryService) SearchUserMemories(ctx context.Context, userID, query string, topK int) ([]models.Memory, error) {
 	request := models.Mem0SearchRequest{
 		Query: query,
 		Filters: map[string]interface{}{
@@ -258,10 +259,10 @@ func (ms *MemoryService) SearchUserMemories(userID, query string, topK int) ([]m
 		TopK:   topK,
 		Rerank: true,
 	}
-	return ms.SearchMemories(request)
+	return ms.SearchMemories(ctx, request)
 }
 
-func (ms *MemoryService) AddChatMemory(userID, sessionID, content, role string) ([]models.Memory, error) {
+func (ms *MemoryService) AddChatMemory(ctx context.Context, userID, sessionID, content, role string) ([]models.Memory, error) {
 	request := models.Mem0AddRequest{
 		Messages: []map[string]string{
 			{
@@ -278,5 +279,5 @@ func (ms *MemoryService) AddChatMemory(userID, sessionID, content, role string)
 		Infer:   true,
 		Version: "v2",
 	}
-	return ms.AddMemory(request)
+	return ms.AddMemory(ctx, request)
 }
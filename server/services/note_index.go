@@ -0,0 +1,233 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"log"
+	"server/database"
+	"server/models"
+	"server/utils"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// noteIndexTimeout bounds indexing one note in the background.
+	noteIndexTimeout = 2 * time.Minute
+
+	embeddingUsageSource = "embedding"
+
+	// askNotesExcerpts is how many note excerpts an "ask my notes" answer
+	// is given.
+	askNotesExcerpts = 5
+)
+
+// noteIndexLocks serialize indexing of the same note, so that the run that
+// reads a note last also writes its chunks last. Notes share locks by hash.
+var noteIndexLocks [64]sync.Mutex
+
+func noteIndexLock(noteID primitive.ObjectID) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write(noteID[:])
+	return &noteIndexLocks[h.Sum32()%uint32(len(noteIndexLocks))]
+}
+
+// IndexNote brings the search chunks of the user's note up to date with the
+// note as it is stored now. Notes whose chunks already match their content
+// and the user's embedding model are left alone, and chunks of a note that
+// no longer exists are removed.
+func IndexNote(ctx context.Context, db *mongo.Database, user models.User, noteID primitive.ObjectID) error {
+	target, err := EmbeddingTargetFor(user)
+	if err != nil {
+		return err
+	}
+
+	lock := noteIndexLock(noteID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	var note models.Note
+	err = db.Collection("notes").FindOne(ctx, bson.M{"_id": noteID, "userId": user.ID}).Decode(&note)
+	if err == mongo.ErrNoDocuments {
+		return utils.DeleteNoteChunks(ctx, db, noteID)
+	}
+	if err != nil {
+		return err
+	}
+
+	hash := utils.NoteContentHash(note)
+	current, err := utils.NoteChunksCurrent(ctx, db, note.ID, hash, target.ModelID)
+	if err != nil || current {
+		return err
+	}
+
+	texts := utils.ChunkNoteContent(note.Content)
+	if len(texts) == 0 {
+		return utils.ReplaceNoteChunks(ctx, db, note, target.Provider, target.ModelID, hash, nil, nil)
+	}
+
+	if _, err := utils.CheckBudgets(ctx, db, user, target.Provider, time.Now()); err != nil {
+		return err
+	}
+
+	// The title gives every chunk the context of the whole note.
+	inputs := make([]string, len(texts))
+	for i, text := range texts {
+		inputs[i] = note.Title + "\n\n" + text
+	}
+
+	embeddings, usage, err := EmbedTexts(ctx, target, inputs)
+	recordEmbeddingUsage(ctx, db, user, target, usage, err)
+	if err != nil {
+		return err
+	}
+
+	return utils.ReplaceNoteChunks(ctx, db, note, target.Provider, target.ModelID, hash, texts, embeddings)
+}
+
+// IndexNoteInBackground runs IndexNote after the request that changed the
+// note has returned. Failures are logged. Users without an embedding
+// provider are skipped.
+func IndexNoteInBackground(ctx context.Context, user models.User, noteID primitive.ObjectID) {
+	if _, err := EmbeddingTargetFor(user); err != nil {
+		return
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, noteIndexTimeout)
+		defer cancel()
+
+		db, err := database.Connect()
+		if err != nil {
+			log.Printf("Database connection error: %v", err)
+			return
+		}
+
+		if err := IndexNote(ctx, db, user, noteID); err != nil {
+			log.Printf("Failed to index note %s: %v", noteID.Hex(), err)
+		}
+	}()
+}
+
+// IndexUserNotesInBackground indexes all of the user's notes one after the
+// other, for notes written before semantic search or embedded with another
+// model. It returns how many notes will be checked.
+func IndexUserNotesInBackground(ctx context.Context, db *mongo.Database, user models.User) (int, error) {
+	if _, err := EmbeddingTargetFor(user); err != nil {
+		return 0, err
+	}
+
+	cursor, err := db.Collection("notes").Find(ctx,
+		bson.M{"userId": user.ID, "deletedAt": nil},
+		options.Find().SetProjection(bson.M{"_id": 1}),
+	)
+	if err != nil {
+		return 0, err
+	}
+	var notes []models.Note
+	if err := cursor.All(ctx, &notes); err != nil {
+		return 0, err
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		for _, note := range notes {
+			noteCtx, cancel := context.WithTimeout(ctx, noteIndexTimeout)
+			err := IndexNote(noteCtx, db, user, note.ID)
+			cancel()
+			if err == nil {
+				continue
+			}
+
+			log.Printf("Failed to index note %s: %v", note.ID.Hex(), err)
+			var budgetErr *utils.BudgetExceededError
+			if errors.As(err, &budgetErr) {
+				return
+			}
+		}
+	}()
+	return len(notes), nil
+}
+
+// SemanticSearch embeds query with the user's embedding provider and returns
+// the notes closest to it in meaning, together with the target that embedded
+// it. Only notes indexed with the same model are compared.
+func SemanticSearch(ctx context.Context, db *mongo.Database, user models.User, query string, limit int) ([]models.SemanticSearchResult, ChatTarget, error) {
+	target, err := EmbeddingTargetFor(user)
+	if err != nil {
+		return nil, target, err
+	}
+
+	if _, err := utils.CheckBudgets(ctx, db, user, target.Provider, time.Now()); err != nil {
+		return nil, target, err
+	}
+
+	embeddings, usage, err := EmbedTexts(ctx, target, []string{query})
+	recordEmbeddingUsage(ctx, db, user, target, usage, err)
+	if err != nil {
+		return nil, target, err
+	}
+
+	results, err := utils.RankNoteChunks(ctx, db, user.ID, target.ModelID, embeddings[0], limit)
+	return results, target, err
+}
+
+// RetrieveNoteCitations finds the excerpts of the user's notes most relevant
+// to question for a models.ChatModeNotes chat: by meaning when the user has
+// an embedding provider and indexed notes, otherwise by keywords. The
+// result is never nil, so that "no notes matched" can be told apart from an
+// ordinary chat.
+func RetrieveNoteCitations(ctx context.Context, db *mongo.Database, user models.User, question string) ([]models.Citation, error) {
+	results, _, err := SemanticSearch(ctx, db, user, question, askNotesExcerpts)
+	if err != nil && !errors.Is(err, ErrNoEmbeddingProvider) {
+		log.Printf("Semantic note retrieval failed, using keywords: %v", err)
+	}
+	if err != nil || len(results) == 0 {
+		results, err = utils.KeywordNoteChunks(ctx, db, user.ID, question, askNotesExcerpts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	citations := make([]models.Citation, 0, len(results))
+	for i, result := range results {
+		citations = append(citations, models.Citation{
+			Number:  i + 1,
+			NoteID:  result.NoteID,
+			Title:   result.Title,
+			Excerpt: result.Excerpt,
+			Score:   result.Score,
+		})
+	}
+	return citations, nil
+}
+
+// recordEmbeddingUsage stores the usage of an embedding call. Failed calls
+// are only recorded if the provider billed tokens for them.
+func recordEmbeddingUsage(ctx context.Context, db *mongo.Database, user models.User, target ChatTarget, usage models.TokenUsage, callErr error) {
+	if callErr != nil && usage.TotalTokens == 0 {
+		return
+	}
+
+	err := utils.RecordUsage(context.WithoutCancel(ctx), db, models.UsageEvent{
+		UserID:       user.ID,
+		ClerkID:      user.ClerkID,
+		Source:       embeddingUsageSource,
+		Provider:     target.Provider,
+		Model:        target.ModelID,
+		PromptTokens: usage.PromptTokens,
+		TotalTokens:  usage.TotalTokens,
+		Cost:         usage.Cost,
+		CreatedAt:    time.Now(),
+	})
+	if err != nil {
+		log.Printf("Failed to record usage: %v", err)
+	}
+}
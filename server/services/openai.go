@@ -0,0 +1,379 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"server/models"
+	"strings"
+)
+
+type OpenAIMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type OpenAIRequest struct {
+	Model       string          `json:"model"`
+	Messages    []OpenAIMessage `json:"messages"`
+	MaxTokens   int             `json:"max_tokens,omitempty"`
+	Temperature float64         `json:"temperature,omitempty"`
+}
+
+type OpenAIResponse struct {
+	Choices []struct {
+		Message      OpenAIMessage `json:"message"`
+		FinishReason string        `json:"finish_reason"`
+	} `json:"choices"`
+	Usage OpenAIUsage `json:"usage"`
+}
+
+type OpenAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type OpenAIStreamRequest struct {
+	OpenAIRequest
+	Stream        bool                 `json:"stream"`
+	StreamOptions *OpenAIStreamOptions `json:"stream_options,omitempty"`
+}
+
+type OpenAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type OpenAIStreamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *OpenAIUsage `json:"usage"`
+}
+
+type OpenAIEmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type OpenAIEmbeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+	Usage OpenAIUsage `json:"usage"`
+}
+
+type OpenAIModelList struct {
+	Data []struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
+
+// CustomProviderName is the provider used for self-hosted endpoints that speak
+// the OpenAI chat completions wire format (Ollama, vLLM, LM Studio, ...).
+const CustomProviderName = "custom"
+
+// openAIProvider talks the OpenAI chat completions format. The same
+// implementation serves OpenAI itself and user-configured compatible
+// endpoints, which supply their base URL through Credentials.
+type openAIProvider struct {
+	name           string
+	baseURL        string
+	defaultModel   string
+	embeddingModel string
+	capabilities   Capabilities
+	client         *http.Client
+	streamClient   *http.Client
+}
+
+func init() {
+	RegisterProvider(&openAIProvider{
+		name:           "openai",
+		baseURL:        "https://api.openai.com/v1",
+		defaultModel:   "gpt-4o-mini",
+		embeddingModel: "text-embedding-3-small",
+		capabilities:   Capabilities{Streaming: true, Vision: true},
+		client:         newProviderClient(),
+		streamClient:   newStreamClient(),
+	})
+	RegisterProvider(&openAIProvider{
+		name:         CustomProviderName,
+		capabilities: Capabilities{Streaming: true},
+		client:       newProviderClient(),
+		streamClient: newStreamClient(),
+	})
+}
+
+func (p *openAIProvider) Name() string {
+	return p.name
+}
+
+func (p *openAIProvider) DefaultModel() string {
+	return p.defaultModel
+}
+
+func (p *openAIProvider) Capabilities() Capabilities {
+	return p.capabilities
+}
+
+func (p *openAIProvider) endpoint(creds Credentials, path string) (string, error) {
+	baseURL := p.baseURL
+	if creds.BaseURL != "" {
+		baseURL = creds.BaseURL
+	}
+	if baseURL == "" {
+		return "", fmt.Errorf("no base URL configured for provider %s", p.name)
+	}
+	return strings.TrimSuffix(baseURL, "/") + path, nil
+}
+
+func (p *openAIProvider) authorize(req *http.Request, creds Credentials) error {
+	// Self-hosted servers frequently run without authentication.
+	if creds.APIKey == "" {
+		return nil
+	}
+
+	apiKey, err := creds.apiKey()
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", apiKey))
+	return nil
+}
+
+func (p *openAIProvider) Chat(ctx context.Context, chatContext string, messages []Message, modelID string, creds Credentials) (Completion, error) {
+	url, err := p.endpoint(creds, "/chat/completions")
+	if err != nil {
+		return Completion{}, err
+	}
+
+	request := OpenAIRequest{
+		Model:       modelID,
+		Messages:    buildOpenAIMessages(chatContext, messages),
+		MaxTokens:   maxResponseTokens,
+		Temperature: 0.7,
+	}
+
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return Completion{}, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return Completion{}, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if err := p.authorize(req, creds); err != nil {
+		return Completion{}, err
+	}
+	req.Header.Add("Content-Type", "application/json")
+
+	body, err := doProviderRequest(p.client, p.Name(), req)
+	if err != nil {
+		return Completion{}, err
+	}
+
+	var openAIResp OpenAIResponse
+	if err := json.Unmarshal(body, &openAIResp); err != nil {
+		return Completion{}, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if len(openAIResp.Choices) == 0 {
+		return Completion{}, fmt.Errorf("no response from OpenAI")
+	}
+
+	if openAIResp.Choices[0].FinishReason == "content_filter" && openAIResp.Choices[0].Message.Content == "" {
+		return Completion{}, &ProviderError{Provider: p.name, Kind: ErrorKindContentFilter}
+	}
+
+	return Completion{
+		Content: openAIResp.Choices[0].Message.Content,
+		Usage: models.TokenUsage{
+			PromptTokens:     openAIResp.Usage.PromptTokens,
+			CompletionTokens: openAIResp.Usage.CompletionTokens,
+			TotalTokens:      openAIResp.Usage.TotalTokens,
+		},
+	}, nil
+}
+
+func (p *openAIProvider) StreamChat(ctx context.Context, chatContext string, messages []Message, modelID string, creds Credentials, onDelta StreamHandler) (models.TokenUsage, error) {
+	var usage models.TokenUsage
+
+	url, err := p.endpoint(creds, "/chat/completions")
+	if err != nil {
+		return usage, err
+	}
+
+	request := OpenAIStreamRequest{
+		OpenAIRequest: OpenAIRequest{
+			Model:       modelID,
+			Messages:    buildOpenAIMessages(chatContext, messages),
+			MaxTokens:   maxResponseTokens,
+			Temperature: 0.7,
+		},
+		Stream:        true,
+		StreamOptions: &OpenAIStreamOptions{IncludeUsage: true},
+	}
+
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return usage, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return usage, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if err := p.authorize(req, creds); err != nil {
+		return usage, err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Accept", "text/event-stream")
+
+	resp, err := openProviderStream(p.streamClient, p.Name(), req)
+	if err != nil {
+		return usage, err
+	}
+	defer resp.Body.Close()
+
+	err = readSSEData(resp.Body, func(data string) error {
+		if data == "[DONE]" {
+			return errStreamDone
+		}
+
+		var chunk OpenAIStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("failed to unmarshal stream chunk: %w", err)
+		}
+
+		// With include_usage the final chunk carries the totals and no choices.
+		if chunk.Usage != nil {
+			usage = models.TokenUsage{
+				PromptTokens:     chunk.Usage.PromptTokens,
+				CompletionTokens: chunk.Usage.CompletionTokens,
+				TotalTokens:      chunk.Usage.TotalTokens,
+			}
+		}
+
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			return nil
+		}
+
+		return onDelta(chunk.Choices[0].Delta.Content)
+	})
+	return usage, err
+}
+
+func (p *openAIProvider) ValidateKey(ctx context.Context, creds Credentials) error {
+	_, err := p.ListModels(ctx, creds)
+	return err
+}
+
+func (p *openAIProvider) ListModels(ctx context.Context, creds Credentials) ([]ModelInfo, error) {
+	url, err := p.endpoint(creds, "/models")
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if err := p.authorize(req, creds); err != nil {
+		return nil, err
+	}
+
+	body, err := doProviderRequest(p.client, p.Name(), req)
+	if err != nil {
+		return nil, err
+	}
+
+	var list OpenAIModelList
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	models := make([]ModelInfo, 0, len(list.Data))
+	for _, model := range list.Data {
+		models = append(models, ModelInfo{ID: model.ID})
+	}
+	return models, nil
+}
+
+func (p *openAIProvider) DefaultEmbeddingModel() string {
+	return p.embeddingModel
+}
+
+func (p *openAIProvider) Embed(ctx context.Context, texts []string, modelID string, creds Credentials) ([][]float32, models.TokenUsage, error) {
+	url, err := p.endpoint(creds, "/embeddings")
+	if err != nil {
+		return nil, models.TokenUsage{}, err
+	}
+
+	jsonData, err := json.Marshal(OpenAIEmbeddingRequest{Model: modelID, Input: texts})
+	if err != nil {
+		return nil, models.TokenUsage{}, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, models.TokenUsage{}, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if err := p.authorize(req, creds); err != nil {
+		return nil, models.TokenUsage{}, err
+	}
+	req.Header.Add("Content-Type", "application/json")
+
+	body, err := doProviderRequest(p.client, p.Name(), req)
+	if err != nil {
+		return nil, models.TokenUsage{}, err
+	}
+
+	var embeddingResp OpenAIEmbeddingResponse
+	if err := json.Unmarshal(body, &embeddingResp); err != nil {
+		return nil, models.TokenUsage{}, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	embeddings := make([][]float32, len(texts))
+	for _, data := range embeddingResp.Data {
+		if data.Index < 0 || data.Index >= len(texts) {
+			return nil, models.TokenUsage{}, fmt.Errorf("embedding index %d out of range", data.Index)
+		}
+		embeddings[data.Index] = data.Embedding
+	}
+
+	return embeddings, models.TokenUsage{
+		PromptTokens: embeddingResp.Usage.PromptTokens,
+		TotalTokens:  embeddingResp.Usage.TotalTokens,
+	}, nil
+}
+
+func buildOpenAIMessages(chatContext string, messages []Message) []OpenAIMessage {
+	openAIMessages := []OpenAIMessage{}
+
+	if chatContext != "" {
+		openAIMessages = append(openAIMessages, OpenAIMessage{
+			Role:    "system",
+			Content: fmt.Sprintf("Context from previous conversations:\n%s", chatContext),
+		})
+	}
+
+	for _, message := range messages {
+		openAIMessages = append(openAIMessages, OpenAIMessage{
+			Role:    message.Role,
+			Content: message.Content,
+		})
+	}
+
+	return openAIMessages
+}
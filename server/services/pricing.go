@@ -0,0 +1,77 @@
+package services
+
+import (
+	"server/models"
+	"strings"
+)
+
+// modelPrices lists USD prices per million tokens by model ID prefix. Longer
+// prefixes are listed before shorter ones that they extend. Models that are
+// not listed, including self-hosted ones, are treated as free.
+var modelPrices = []struct {
+	prefix string
+	input  float64
+	output float64
+}{
+	{prefix: "gpt-4o-mini", input: 0.15, output: 0.60},
+	{prefix: "gpt-4o", input: 2.50, output: 10.00},
+	{prefix: "gpt-4.1-nano", input: 0.10, output: 0.40},
+	{prefix: "gpt-4.1-mini", input: 0.40, output: 1.60},
+	{prefix: "gpt-4.1", input: 2.00, output: 8.00},
+	{prefix: "gpt-4-turbo", input: 10.00, output: 30.00},
+	{prefix: "gpt-4", input: 30.00, output: 60.00},
+	{prefix: "gpt-3.5-turbo", input: 0.50, output: 1.50},
+	{prefix: "o1-mini", input: 1.10, output: 4.40},
+	{prefix: "o1", input: 15.00, output: 60.00},
+	{prefix: "o3-mini", input: 1.10, output: 4.40},
+	{prefix: "o3", input: 2.00, output: 8.00},
+	{prefix: "o4-mini", input: 1.10, output: 4.40},
+	{prefix: "gemini-1.5-flash", input: 0.075, output: 0.30},
+	{prefix: "gemini-1.5-pro", input: 1.25, output: 5.00},
+	{prefix: "gemini-2.0-flash", input: 0.10, output: 0.40},
+	{prefix: "gemini-2.5-flash", input: 0.30, output: 2.50},
+	{prefix: "gemini-2.5-pro", input: 1.25, output: 10.00},
+	{prefix: "claude-3-5-haiku", input: 0.80, output: 4.00},
+	{prefix: "claude-3-haiku", input: 0.25, output: 1.25},
+	{prefix: "claude-3-5-sonnet", input: 3.00, output: 15.00},
+	{prefix: "claude-3-7-sonnet", input: 3.00, output: 15.00},
+	{prefix: "claude-sonnet-4", input: 3.00, output: 15.00},
+	{prefix: "claude-3-opus", input: 15.00, output: 75.00},
+	{prefix: "claude-opus-4", input: 15.00, output: 75.00},
+	{prefix: "text-embedding-3-small", input: 0.02},
+	{prefix: "text-embedding-3-large", input: 0.13},
+}
+
+// ModelPricing is the USD price of a model per million tokens.
+type ModelPricing struct {
+	InputPerMillion  float64 `json:"inputPerMillion"`
+	OutputPerMillion float64 `json:"outputPerMillion"`
+}
+
+// PriceOf returns the price of modelID, or nil if it is not in the table.
+func PriceOf(modelID string) *ModelPricing {
+	for _, price := range modelPrices {
+		if strings.HasPrefix(modelID, price.prefix) {
+			return &ModelPricing{InputPerMillion: price.input, OutputPerMillion: price.output}
+		}
+	}
+	return nil
+}
+
+// EstimateCost returns the estimated USD cost of usage on modelID.
+func EstimateCost(modelID string, usage models.TokenUsage) float64 {
+	price := PriceOf(modelID)
+	if price == nil {
+		return 0
+	}
+	return (float64(usage.PromptTokens)*price.InputPerMillion + float64(usage.CompletionTokens)*price.OutputPerMillion) / 1_000_000
+}
+
+// finalizeUsage fills in the derived fields of usage for modelID.
+func finalizeUsage(modelID string, usage models.TokenUsage) models.TokenUsage {
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	usage.Cost = EstimateCost(modelID, usage)
+	return usage
+}
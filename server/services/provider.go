@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"server/models"
+	"server/utils"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Capabilities describes what a provider's API supports.
+type Capabilities struct {
+	Streaming bool `json:"streaming"`
+	Vision    bool `json:"vision"`
+}
+
+// Credentials carries what is needed to authenticate against a provider.
+// BaseURL is only used by providers that talk to user-configured endpoints.
+// APIKey is normally sealed with utils.SealSecret and is only opened, through
+// apiKey, while a provider request is being built.
+type Credentials struct {
+	APIKey  string
+	BaseURL string
+}
+
+func (c Credentials) apiKey() (string, error) {
+	apiKey, err := utils.OpenSecret(c.APIKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt API key: %w", err)
+	}
+	return apiKey, nil
+}
+
+// Completion is a finished (non-streamed) provider answer.
+type Completion struct {
+	Content string
+	Usage   models.TokenUsage
+}
+
+// ModelInfo is a model as reported by a provider's list-models API.
+type ModelInfo struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+}
+
+// Provider is an LLM backend that AIService and the handlers can talk to by
+// name. Adding a provider means implementing this interface and registering
+// it with RegisterProvider.
+type Provider interface {
+	Name() string
+	DefaultModel() string
+	Capabilities() Capabilities
+	Chat(ctx context.Context, chatContext string, messages []Message, modelID string, creds Credentials) (Completion, error)
+	StreamChat(ctx context.Context, chatContext string, messages []Message, modelID string, creds Credentials, onDelta StreamHandler) (models.TokenUsage, error)
+	ValidateKey(ctx context.Context, creds Credentials) error
+	ListModels(ctx context.Context, creds Credentials) ([]ModelInfo, error)
+}
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]Provider{}
+)
+
+func RegisterProvider(provider Provider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	name := provider.Name()
+	if _, exists := providers[name]; exists {
+		panic(fmt.Sprintf("provider %q registered twice", name))
+	}
+	providers[name] = provider
+}
+
+func GetProvider(name string) (Provider, error) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	provider, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported provider: %s", name)
+	}
+	return provider, nil
+}
+
+func IsSupportedProvider(name string) bool {
+	_, err := GetProvider(name)
+	return err == nil
+}
+
+// ProviderNames returns the registered provider names in sorted order.
+func ProviderNames() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SupportedProvidersMessage lists the registered providers for use in
+// validation errors, e.g. "'claude', 'gemini' or 'openai'".
+func SupportedProvidersMessage() string {
+	names := ProviderNames()
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = "'" + name + "'"
+	}
+
+	if len(quoted) <= 1 {
+		return strings.Join(quoted, "")
+	}
+	return strings.Join(quoted[:len(quoted)-1], ", ") + " or " + quoted[len(quoted)-1]
+}
+
+// doProviderRequest sends req and returns the body of a 200 response. Any
+// other outcome is returned as a *ProviderError.
+func doProviderRequest(client *http.Client, provider string, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, newTransportError(provider, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, newTransportError(provider, fmt.Errorf("failed to read response: %w", err))
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newHTTPError(provider, resp, body)
+	}
+	return body, nil
+}
+
+// openProviderStream sends req and returns the response of a 200 for the
+// caller to read and close. Any other outcome is returned as a
+// *ProviderError.
+func openProviderStream(client *http.Client, provider string, req *http.Request) (*http.Response, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, newTransportError(provider, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, newHTTPError(provider, resp, body)
+	}
+	return resp, nil
+}
+
+func newProviderClient() *http.Client {
+	return &http.Client{
+		Timeout: 60 * time.Second,
+	}
+}
+
+// newStreamClient returns a client for streaming responses. Streams can
+// legitimately outlive the regular request timeout, so only the wait for
+// response headers is bounded.
+func newStreamClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			ResponseHeaderTimeout: 60 * time.Second,
+		},
+	}
+}
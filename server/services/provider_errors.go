@@ -0,0 +1,283 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrorKind classifies why a provider call failed.
+type ErrorKind string
+
+const (
+	ErrorKindAuth           ErrorKind = "auth"
+	ErrorKindRateLimit      ErrorKind = "rate_limit"
+	ErrorKindQuota          ErrorKind = "quota"
+	ErrorKindContextLength  ErrorKind = "context_length"
+	ErrorKindContentFilter  ErrorKind = "content_filter"
+	ErrorKindTransient      ErrorKind = "transient"
+	ErrorKindInvalidRequest ErrorKind = "invalid_request"
+
+	// ErrorKindUnavailable is reported without calling the provider while its
+	// circuit breaker is open.
+	ErrorKindUnavailable ErrorKind = "unavailable"
+)
+
+// ProviderError is a classified failure of a provider call. Message is the
+// provider's own explanation, never its raw response body.
+type ProviderError struct {
+	Provider   string
+	Kind       ErrorKind
+	StatusCode int
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *ProviderError) Error() string {
+	var summary string
+	switch e.Kind {
+	case ErrorKindAuth:
+		summary = fmt.Sprintf("%s rejected the API key", e.Provider)
+	case ErrorKindRateLimit:
+		summary = fmt.Sprintf("%s rate limit reached", e.Provider)
+	case ErrorKindQuota:
+		summary = fmt.Sprintf("%s quota or credit exhausted", e.Provider)
+	case ErrorKindContextLength:
+		summary = fmt.Sprintf("conversation is too long for the %s model", e.Provider)
+	case ErrorKindContentFilter:
+		summary = fmt.Sprintf("%s blocked the content", e.Provider)
+	case ErrorKindTransient:
+		summary = fmt.Sprintf("%s is temporarily unavailable", e.Provider)
+	case ErrorKindUnavailable:
+		summary = fmt.Sprintf("%s is unavailable after repeated failures", e.Provider)
+	default:
+		summary = fmt.Sprintf("%s rejected the request", e.Provider)
+	}
+
+	if e.Message == "" {
+		return summary
+	}
+	return summary + ": " + e.Message
+}
+
+// Retryable reports whether the same call may succeed if made again later.
+func (e *ProviderError) Retryable() bool {
+	return e.Kind == ErrorKindTransient || e.Kind == ErrorKindRateLimit
+}
+
+// Fallbackable reports whether a different provider or model may succeed
+// where this one failed.
+func (e *ProviderError) Fallbackable() bool {
+	switch e.Kind {
+	case ErrorKindTransient, ErrorKindUnavailable, ErrorKindRateLimit, ErrorKindQuota:
+		return true
+	}
+	return false
+}
+
+// Code is the machine-readable error code sent to clients.
+func (e *ProviderError) Code() string {
+	return "provider_" + string(e.Kind)
+}
+
+// HTTPStatus is the status the API answers with when this error ends a
+// request. Authentication failures use 422 rather than 401 so clients do not
+// mistake a bad provider key for an expired session.
+func (e *ProviderError) HTTPStatus() int {
+	switch e.Kind {
+	case ErrorKindAuth, ErrorKindContentFilter:
+		return http.StatusUnprocessableEntity
+	case ErrorKindRateLimit:
+		return http.StatusTooManyRequests
+	case ErrorKindQuota:
+		return http.StatusPaymentRequired
+	case ErrorKindContextLength:
+		return http.StatusRequestEntityTooLarge
+	case ErrorKindTransient:
+		return http.StatusBadGateway
+	case ErrorKindUnavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// AsProviderError unwraps err into a *ProviderError if it carries one.
+func AsProviderError(err error) (*ProviderError, bool) {
+	var providerErr *ProviderError
+	ok := errors.As(err, &providerErr)
+	return providerErr, ok
+}
+
+// providerErrorBody covers the error envelopes of OpenAI, Anthropic, Gemini
+// and most OpenAI-compatible servers.
+type providerErrorBody struct {
+	Error json.RawMessage `json:"error"`
+}
+
+type providerErrorDetail struct {
+	Message string      `json:"message"`
+	Type    string      `json:"type"`
+	Code    interface{} `json:"code"`
+	Status  string      `json:"status"`
+}
+
+var geminiRetryDelay = regexp.MustCompile(`"retryDelay"\s*:\s*"(\d+(?:\.\d+)?)s"`)
+
+// newHTTPError classifies a non-200 provider response.
+func newHTTPError(provider string, resp *http.Response, body []byte) *ProviderError {
+	message, detail := parseErrorBody(body)
+	if message == "" {
+		message = http.StatusText(resp.StatusCode)
+	}
+
+	providerErr := &ProviderError{
+		Provider:   provider,
+		Kind:       classifyError(resp.StatusCode, strings.ToLower(message+" "+detail)),
+		StatusCode: resp.StatusCode,
+		Message:    message,
+		RetryAfter: parseRetryAfter(resp.Header),
+	}
+
+	if providerErr.RetryAfter == 0 {
+		if match := geminiRetryDelay.FindSubmatch(body); match != nil {
+			seconds, _ := strconv.ParseFloat(string(match[1]), 64)
+			providerErr.RetryAfter = time.Duration(seconds * float64(time.Second))
+		}
+	}
+
+	return providerErr
+}
+
+// newStreamError classifies an error event received in the middle of a
+// stream, where there is no HTTP status to go by.
+func newStreamError(provider string, data string) *ProviderError {
+	message, detail := parseErrorBody([]byte(data))
+	text := strings.ToLower(message + " " + detail)
+
+	status := http.StatusBadRequest
+	switch {
+	case strings.Contains(text, "overloaded"), strings.Contains(text, "api_error"):
+		status = http.StatusServiceUnavailable
+	case strings.Contains(text, "rate_limit"):
+		status = http.StatusTooManyRequests
+	}
+
+	return &ProviderError{
+		Provider: provider,
+		Kind:     classifyError(status, text),
+		Message:  message,
+	}
+}
+
+// newTransportError wraps a failure to reach the provider at all. Only the
+// underlying cause is kept: the request URL may carry the API key.
+func newTransportError(provider string, err error) *ProviderError {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	return &ProviderError{
+		Provider: provider,
+		Kind:     ErrorKindTransient,
+		Message:  err.Error(),
+	}
+}
+
+func parseErrorBody(body []byte) (string, string) {
+	var envelope providerErrorBody
+	if err := json.Unmarshal(body, &envelope); err != nil || len(envelope.Error) == 0 {
+		return "", ""
+	}
+
+	// Some OpenAI-compatible servers send {"error": "message"}.
+	var message string
+	if err := json.Unmarshal(envelope.Error, &message); err == nil {
+		return message, ""
+	}
+
+	var detail providerErrorDetail
+	if err := json.Unmarshal(envelope.Error, &detail); err != nil {
+		return "", ""
+	}
+
+	code := ""
+	if detail.Code != nil {
+		code = fmt.Sprint(detail.Code)
+	}
+	return detail.Message, strings.Join([]string{detail.Type, code, detail.Status}, " ")
+}
+
+func classifyError(status int, text string) ErrorKind {
+	switch {
+	case containsAny(text, "context_length_exceeded", "maximum context length", "prompt is too long",
+		"too many tokens", "input token count", "context window"):
+		return ErrorKindContextLength
+	case containsAny(text, "content_filter", "content_policy", "content management policy", "safety"):
+		return ErrorKindContentFilter
+	case containsAny(text, "insufficient_quota", "credit balance", "billing_hard_limit"):
+		return ErrorKindQuota
+	}
+
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrorKindAuth
+	case http.StatusPaymentRequired:
+		return ErrorKindQuota
+	case http.StatusTooManyRequests:
+		return ErrorKindRateLimit
+	case http.StatusRequestEntityTooLarge:
+		return ErrorKindContextLength
+	case http.StatusRequestTimeout, http.StatusConflict, http.StatusTooEarly:
+		return ErrorKindTransient
+	case http.StatusBadRequest:
+		// Gemini reports bad keys as 400 INVALID_ARGUMENT.
+		if containsAny(text, "api key not valid", "api_key_invalid", "invalid api key", "invalid x-api-key") {
+			return ErrorKindAuth
+		}
+	}
+
+	if status >= 500 {
+		return ErrorKindTransient
+	}
+	return ErrorKindInvalidRequest
+}
+
+// parseRetryAfter reads Retry-After as seconds or an HTTP date, preferring
+// OpenAI's millisecond-precision variant when present.
+func parseRetryAfter(header http.Header) time.Duration {
+	if value := header.Get("retry-after-ms"); value != "" {
+		if ms, err := strconv.ParseFloat(value, 64); err == nil && ms > 0 {
+			return time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(at); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+func containsAny(text string, needles ...string) bool {
+	for _, needle := range needles {
+		if strings.Contains(text, needle) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	maxProviderAttempts = 3
+	retryBaseDelay      = 500 * time.Millisecond
+	retryMaxDelay       = 8 * time.Second
+
+	// maxRetryAfter is the longest Retry-After we are willing to sleep
+	// through inside a request; longer waits are handed back to the client.
+	maxRetryAfter = 10 * time.Second
+
+	breakerThreshold = 5
+	breakerCooldown  = 30 * time.Second
+)
+
+// circuitBreaker stops calls to a provider after breakerThreshold
+// consecutive transient failures. Once breakerCooldown has passed a single
+// probe call is let through; its outcome closes or re-opens the circuit.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+var (
+	breakersMu sync.Mutex
+	breakers   = map[string]*circuitBreaker{}
+)
+
+// breakerFor returns the breaker for a provider. Self-hosted endpoints get
+// one per base URL so that one user's server going down does not block
+// everybody else's.
+func breakerFor(providerName string, creds Credentials) *circuitBreaker {
+	key := providerName
+	if creds.BaseURL != "" {
+		key += "|" + creds.BaseURL
+	}
+
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+
+	breaker, ok := breakers[key]
+	if !ok {
+		breaker = &circuitBreaker{}
+		breakers[key] = breaker
+	}
+	return breaker
+}
+
+// allow reports whether a call may be made and, if not, how long until the
+// next probe.
+func (b *circuitBreaker) allow() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < breakerThreshold {
+		return true, 0
+	}
+	if wait := time.Until(b.openUntil); wait > 0 {
+		return false, wait
+	}
+	if b.probing {
+		return false, breakerCooldown
+	}
+	b.probing = true
+	return true, 0
+}
+
+// record updates the breaker with the outcome of a call. Only transient
+// failures count against the provider; rejected keys or prompts show that
+// it is up.
+func (b *circuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+
+	providerErr, ok := AsProviderError(err)
+	if !ok || providerErr.Kind != ErrorKindTransient {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.failures >= breakerThreshold {
+		b.openUntil = time.Now().Add(breakerCooldown)
+	}
+}
+
+// release ends a call whose outcome says nothing about the provider, such
+// as one the caller cancelled. A probe in flight is given up so that the
+// next call can probe again; the failure count is left as it was.
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// callProvider runs call, retrying transient and rate-limit failures with
+// jittered exponential backoff or the provider's Retry-After. canRetry is
+// consulted before each retry and may be nil; streams use it to stop
+// retrying once output has reached the client.
+func callProvider(ctx context.Context, providerName string, creds Credentials, call func() error, canRetry func() bool) error {
+	breaker := breakerFor(providerName, creds)
+
+	for attempt := 1; ; attempt++ {
+		if ok, wait := breaker.allow(); !ok {
+			return &ProviderError{
+				Provider:   providerName,
+				Kind:       ErrorKindUnavailable,
+				RetryAfter: wait,
+			}
+		}
+
+		err := call()
+		if ctx.Err() != nil {
+			// The caller gave up; that says nothing about the provider.
+			breaker.release()
+			return ctx.Err()
+		}
+		breaker.record(err)
+		if err == nil {
+			return nil
+		}
+
+		providerErr, ok := AsProviderError(err)
+		if !ok || !providerErr.Retryable() || attempt >= maxProviderAttempts {
+			return err
+		}
+		if canRetry != nil && !canRetry() {
+			return err
+		}
+
+		delay := backoff(attempt)
+		if providerErr.RetryAfter > 0 {
+			if providerErr.RetryAfter > maxRetryAfter {
+				return err
+			}
+			delay = providerErr.RetryAfter
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns a delay for the given attempt with "equal jitter": half of
+// the exponential delay is fixed and the other half random.
+func backoff(attempt int) time.Duration {
+	delay := retryBaseDelay << (attempt - 1)
+	if delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
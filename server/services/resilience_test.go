@@ -0,0 +1,45 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCallProviderCancelledProbeReleasesBreaker(t *testing.T) {
+	creds := Credentials{BaseURL: "http://probe.test"}
+	breaker := breakerFor("test-cancelled-probe", creds)
+	breaker.failures = breakerThreshold
+	breaker.openUntil = time.Now().Add(-time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err := callProvider(ctx, "test-cancelled-probe", creds, func() error {
+		cancel()
+		return ctx.Err()
+	}, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("callProvider() error = %v, want context.Canceled", err)
+	}
+
+	if ok, wait := breaker.allow(); !ok {
+		t.Fatalf("allow() after a cancelled probe = false (wait %s), want a new probe", wait)
+	}
+	if breaker.failures != breakerThreshold {
+		t.Errorf("failures = %d, want %d left unchanged", breaker.failures, breakerThreshold)
+	}
+}
+
+func TestCallProviderProbeOutcomeClosesBreaker(t *testing.T) {
+	creds := Credentials{BaseURL: "http://probe-ok.test"}
+	breaker := breakerFor("test-probe-ok", creds)
+	breaker.failures = breakerThreshold
+	breaker.openUntil = time.Now().Add(-time.Second)
+
+	if err := callProvider(context.Background(), "test-probe-ok", creds, func() error { return nil }, nil); err != nil {
+		t.Fatalf("callProvider() error = %v", err)
+	}
+	if breaker.failures != 0 || breaker.probing {
+		t.Errorf("breaker after a successful probe = %d failures, probing %v; want closed", breaker.failures, breaker.probing)
+	}
+}
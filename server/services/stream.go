@@ -0,0 +1,121 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"server/models"
+	"strings"
+	"time"
+)
+
+// StreamHandler receives each piece of text as the provider produces it.
+// Returning an error stops the stream, e.g. when the client has gone away.
+type StreamHandler func(delta string) error
+
+// StreamChatWithAI is the streaming counterpart of ChatWithAI. Once text has
+// reached onDelta the answer is committed to its target: neither retries nor
+// fallbacks happen after that point.
+func (ai *AIService) StreamChatWithAI(ctx context.Context, userID, clerkID, sessionID, message string, targets []ChatTarget, history []models.ChatMessage, notes []models.Citation, onDelta StreamHandler) (*models.ChatResponse, error) {
+	memories, err := ai.memoryService.SearchUserMemories(ctx, clerkID, message, 5)
+	if err != nil {
+		fmt.Printf("Warning: Failed to search memories: %v\n", err)
+		memories = []models.Memory{}
+	}
+
+	chatContext := ai.buildChatContext(memories, notes)
+
+	var builder strings.Builder
+	collect := func(delta string) error {
+		builder.WriteString(delta)
+		return onDelta(delta)
+	}
+
+	nothingSent := func() bool {
+		return builder.Len() == 0
+	}
+
+	var usage models.TokenUsage
+	var budget models.TokenBudget
+	target, attempts, err := tryTargets(ctx, targets, func(target ChatTarget) error {
+		provider, err := GetProvider(target.Provider)
+		if err != nil {
+			return err
+		}
+
+		var messages []Message
+		messages, budget = buildConversation(chatContext, history, message, target.ModelID)
+		return callProvider(ctx, target.Provider, target.Creds, func() error {
+			usage, err = provider.StreamChat(ctx, chatContext, messages, target.ModelID, target.Creds, collect)
+			return err
+		}, nothingSent)
+	}, nothingSent)
+	usage = finalizeUsage(target.ModelID, usage)
+
+	response := builder.String()
+
+	// Whatever was generated before an abort is still part of the
+	// conversation, so it is remembered just like a completed answer.
+	if response != "" {
+		memoryCtx := context.WithoutCancel(ctx)
+		go func() {
+			ai.memoryService.AddChatMemory(memoryCtx, clerkID, sessionID, message, "user")
+			ai.memoryService.AddChatMemory(memoryCtx, clerkID, sessionID, response, "assistant")
+		}()
+	}
+
+	chatResponse := &models.ChatResponse{
+		SessionID:        sessionID,
+		Message:          response,
+		Role:             "assistant",
+		Model:            target.Provider,
+		ModelID:          target.ModelID,
+		Memories:         memories,
+		Citations:        notes,
+		TokenBudget:      &budget,
+		Usage:            &usage,
+		FallbackAttempts: attempts,
+		CreatedAt:        time.Now(),
+	}
+
+	if err != nil {
+		return chatResponse, fmt.Errorf("AI API stream failed: %w", err)
+	}
+
+	return chatResponse, nil
+}
+
+var errStreamDone = errors.New("stream done")
+
+// readSSEData calls fn with the payload of every "data:" line of a
+// Server-Sent Events body until the body ends or fn returns an error.
+func readSSEData(body io.Reader, fn func(data string) error) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "" {
+			continue
+		}
+
+		if err := fn(data); err != nil {
+			if err == errStreamDone {
+				return nil
+			}
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read stream: %w", err)
+	}
+	return nil
+}
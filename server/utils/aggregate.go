@@ -9,11 +9,21 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func GetUserWithNotes(db *mongo.Database, userID primitive.ObjectID) (*models.UserWithNotes, error) {
+// userSecretFields excludes stored provider keys from user documents that
+// leave the AI call path.
+var userSecretFields = bson.M{
+	"openaiKey":              0,
+	"geminiKey":              0,
+	"claudeKey":              0,
+	"customEndpoints.apiKey": 0,
+}
+
+func GetUserWithNotes(ctx context.Context, db *mongo.Database, userID primitive.ObjectID) (*models.UserWithNotes, error) {
 	collection := db.Collection("users")
 
 	pipeline := bson.A{
 		bson.M{"$match": bson.M{"_id": userID}},
+		bson.M{"$project": userSecretFields},
 		bson.M{
 			"$lookup": bson.M{
 				"from":         "notes",
@@ -22,16 +32,20 @@ func GetUserWithNotes(db *mongo.Database, userID primitive.ObjectID) (*models.Us
 				"as":           "notes",
 			},
 		},
+		bson.M{"$set": bson.M{"notes": bson.M{"$filter": bson.M{
+			"input": "$notes",
+			"cond":  bson.M{"$not": bson.A{"$$this.deletedAt"}},
+		}}}},
 	}
 
-	cursor, err := collection.Aggregate(context.Background(), pipeline)
+	cursor, err := collection.Aggregate(ctx, pipeline)
 	if err != nil {
 		return nil, err
 	}
-	defer cursor.Close(context.Background())
+	defer cursor.Close(ctx)
 
 	var results []models.UserWithNotes
-	if err = cursor.All(context.Background(), &results); err != nil {
+	if err = cursor.All(ctx, &results); err != nil {
 		return nil, err
 	}
 
@@ -42,39 +56,7 @@ func GetUserWithNotes(db *mongo.Database, userID primitive.ObjectID) (*models.Us
 	return &results[0], nil
 }
 
-func GetAllUserNotes(db *mongo.Database, userID primitive.ObjectID) ([]models.Note, error) {
-	collection := db.Collection("users")
-
-	pipeline := bson.A{
-		bson.M{"$match": bson.M{"_id": userID}},
-		bson.M{
-			"$lookup": bson.M{
-				"from":         "notes",
-				"localField":   "noteIds",
-				"foreignField": "_id",
-				"as":           "notes",
-			},
-		},
-		bson.M{"$unwind": "$notes"},
-		bson.M{"$replaceRoot": bson.M{"newRoot": "$notes"}},
-		bson.M{"$sort": bson.M{"createdAt": -1}},
-	}
-
-	cursor, err := collection.Aggregate(context.Background(), pipeline)
-	if err != nil {
-		return nil, err
-	}
-	defer cursor.Close(context.Background())
-
-	var notes []models.Note
-	if err = cursor.All(context.Background(), &notes); err != nil {
-		return nil, err
-	}
-
-	return notes, nil
-}
-
-func AddNoteToUser(db *mongo.Database, userID, noteID primitive.ObjectID) error {
+func AddNoteToUser(ctx context.Context, db *mongo.Database, userID, noteID primitive.ObjectID) error {
 	collection := db.Collection("users")
 
 	filter := bson.M{"_id": userID}
@@ -83,11 +65,11 @@ func AddNoteToUser(db *mongo.Database, userID, noteID primitive.ObjectID) error
 		"$set":      bson.M{"updatedAt": primitive.NewDateTimeFromTime(primitive.DateTime(0).Time())},
 	}
 
-	_, err := collection.UpdateOne(context.Background(), filter, update)
+	_, err := collection.UpdateOne(ctx, filter, update)
 	return err
 }
 
-func RemoveNoteFromUser(db *mongo.Database, userID, noteID primitive.ObjectID) error {
+func RemoveNoteFromUser(ctx context.Context, db *mongo.Database, userID, noteID primitive.ObjectID) error {
 	collection := db.Collection("users")
 
 	filter := bson.M{"_id": userID}
@@ -96,6 +78,33 @@ func RemoveNoteFromUser(db *mongo.Database, userID, noteID primitive.ObjectID) e
 		"$set":  bson.M{"updatedAt": primitive.NewDateTimeFromTime(primitive.DateTime(0).Time())},
 	}
 
-	_, err := collection.UpdateOne(context.Background(), filter, update)
+	_, err := collection.UpdateOne(ctx, filter, update)
 	return err
 }
+
+// DeleteUserNotes deletes the given notes of a user together with their
+// revisions, their search chunks and their entries in users.noteIds, and
+// returns how many notes were deleted.
+func DeleteUserNotes(ctx context.Context, db *mongo.Database, userID primitive.ObjectID, noteIDs []primitive.ObjectID) (int64, error) {
+	if len(noteIDs) == 0 {
+		return 0, nil
+	}
+
+	result, err := db.Collection("notes").DeleteMany(ctx, bson.M{"_id": bson.M{"$in": noteIDs}, "userId": userID})
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := db.Collection("note_revisions").DeleteMany(ctx, bson.M{"noteId": bson.M{"$in": noteIDs}}); err != nil {
+		return result.DeletedCount, err
+	}
+	if err := DeleteNoteChunks(ctx, db, noteIDs...); err != nil {
+		return result.DeletedCount, err
+	}
+
+	_, err = db.Collection("users").UpdateOne(ctx,
+		bson.M{"_id": userID},
+		bson.M{"$pull": bson.M{"noteIds": bson.M{"$in": noteIDs}}},
+	)
+	return result.DeletedCount, err
+}
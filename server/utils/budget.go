@@ -0,0 +1,159 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"server/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// defaultBudgetWarnAt is the share of a limit after which a budget is
+// reported as close to running out when the user has not chosen one.
+const defaultBudgetWarnAt = 0.8
+
+// BudgetExceededError is returned when a user has used up a budget that
+// covers the provider they are calling. The app error handler renders it
+// together with the budget status so clients can show when it resets.
+type BudgetExceededError struct {
+	Status models.BudgetStatus
+}
+
+func (e *BudgetExceededError) Error() string {
+	provider := e.Status.Budget.Provider
+	if provider == models.BudgetAllProviders {
+		provider = "AI"
+	}
+	return fmt.Sprintf("Your %s %s spending budget has been used up. It resets at %s.",
+		e.Status.Budget.Period, provider, e.Status.ResetsAt.Format(time.RFC3339))
+}
+
+// StatusCode is 402 when the cost limit ran out and 429 when only the token
+// limit did.
+func (e *BudgetExceededError) StatusCode() int {
+	budget := e.Status.Budget
+	if budget.CostLimit > 0 && e.Status.UsedCost >= budget.CostLimit {
+		return fiber.StatusPaymentRequired
+	}
+	return fiber.StatusTooManyRequests
+}
+
+// BudgetPeriodBounds returns the UTC start of the period containing now and
+// the moment the next one starts.
+func BudgetPeriodBounds(period string, now time.Time) (time.Time, time.Time) {
+	now = now.UTC()
+	if period == models.BudgetPeriodMonthly {
+		start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 1, 0)
+	}
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 0, 1)
+}
+
+// GetBudgetStatuses meters each budget against the user's usage events in its
+// current period.
+func GetBudgetStatuses(ctx context.Context, db *mongo.Database, clerkID string, budgets []models.SpendingBudget, now time.Time) ([]models.BudgetStatus, error) {
+	statuses := make([]models.BudgetStatus, 0, len(budgets))
+	for _, budget := range budgets {
+		start, end := BudgetPeriodBounds(budget.Period, now)
+		tokens, cost, err := getPeriodUsage(ctx, db, clerkID, budget.Provider, start)
+		if err != nil {
+			return nil, err
+		}
+
+		status := models.BudgetStatus{
+			Budget:      budget,
+			UsedTokens:  tokens,
+			UsedCost:    cost,
+			PeriodStart: start,
+			ResetsAt:    end,
+		}
+
+		if budget.TokenLimit > 0 {
+			status.FractionUse = float64(tokens) / float64(budget.TokenLimit)
+			status.Exceeded = tokens >= budget.TokenLimit
+		}
+		if budget.CostLimit > 0 {
+			status.FractionUse = max(status.FractionUse, cost/budget.CostLimit)
+			status.Exceeded = status.Exceeded || cost >= budget.CostLimit
+		}
+
+		warnAt := budget.WarnAt
+		if warnAt <= 0 {
+			warnAt = defaultBudgetWarnAt
+		}
+		status.Warning = !status.Exceeded && status.FractionUse >= warnAt
+
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// CheckBudgets meters the budgets that cover provider. It returns a
+// *BudgetExceededError for the first one that is used up, and otherwise the
+// budgets that are close to their limit.
+func CheckBudgets(ctx context.Context, db *mongo.Database, user models.User, provider string, now time.Time) ([]models.BudgetStatus, error) {
+	var applicable []models.SpendingBudget
+	for _, budget := range user.Budgets {
+		if budget.Provider == provider || budget.Provider == models.BudgetAllProviders {
+			applicable = append(applicable, budget)
+		}
+	}
+
+	warnings := []models.BudgetStatus{}
+	if len(applicable) == 0 {
+		return warnings, nil
+	}
+
+	statuses, err := GetBudgetStatuses(ctx, db, user.ClerkID, applicable, now)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, status := range statuses {
+		if status.Exceeded {
+			return nil, &BudgetExceededError{Status: status}
+		}
+		if status.Warning {
+			warnings = append(warnings, status)
+		}
+	}
+	return warnings, nil
+}
+
+func getPeriodUsage(ctx context.Context, db *mongo.Database, clerkID, provider string, since time.Time) (int, float64, error) {
+	match := bson.M{"clerkId": clerkID, "createdAt": bson.M{"$gte": since}}
+	if provider != models.BudgetAllProviders {
+		match["provider"] = provider
+	}
+
+	pipeline := bson.A{
+		bson.M{"$match": match},
+		bson.M{"$group": bson.M{
+			"_id":         nil,
+			"totalTokens": bson.M{"$sum": "$totalTokens"},
+			"cost":        bson.M{"$sum": "$cost"},
+		}},
+	}
+
+	cursor, err := db.Collection("usage_events").Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		TotalTokens int     `bson:"totalTokens"`
+		Cost        float64 `bson:"cost"`
+	}
+	if err = cursor.All(ctx, &results); err != nil {
+		return 0, 0, err
+	}
+	if len(results) == 0 {
+		return 0, 0, nil
+	}
+	return results[0].TotalTokens, results[0].Cost, nil
+}
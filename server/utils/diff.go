@@ -0,0 +1,201 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	DiffEqual  = "equal"
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+)
+
+// maxDiffCells bounds the LCS table; larger inputs fall back to replacing
+// every line, which is still a correct (if unhelpful) diff.
+const maxDiffCells = 4_000_000
+
+// DiffLine is one line of a line-based diff.
+type DiffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// DiffStats counts the lines a diff adds and removes.
+type DiffStats struct {
+	Added   int `json:"added"`
+	Removed int `json:"removed"`
+}
+
+// DiffLines returns a minimal line diff turning before into after.
+func DiffLines(before, after string) []DiffLine {
+	a := splitLines(before)
+	b := splitLines(after)
+
+	// Common prefix and suffix are cheap to strip and keep the table small
+	// for the usual case of a localised edit.
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var diff []DiffLine
+	for _, line := range a[:prefix] {
+		diff = append(diff, DiffLine{Op: DiffEqual, Text: line})
+	}
+	diff = append(diff, diffMiddle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		diff = append(diff, DiffLine{Op: DiffEqual, Text: line})
+	}
+	return diff
+}
+
+func diffMiddle(a, b []string) []DiffLine {
+	var diff []DiffLine
+	if (len(a)+1)*(len(b)+1) > maxDiffCells {
+		for _, line := range a {
+			diff = append(diff, DiffLine{Op: DiffDelete, Text: line})
+		}
+		for _, line := range b {
+			diff = append(diff, DiffLine{Op: DiffInsert, Text: line})
+		}
+		return diff
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			diff = append(diff, DiffLine{Op: DiffEqual, Text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, DiffLine{Op: DiffDelete, Text: a[i]})
+			i++
+		default:
+			diff = append(diff, DiffLine{Op: DiffInsert, Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		diff = append(diff, DiffLine{Op: DiffDelete, Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		diff = append(diff, DiffLine{Op: DiffInsert, Text: b[j]})
+	}
+	return diff
+}
+
+// CountDiff returns how many lines diff adds and removes.
+func CountDiff(diff []DiffLine) DiffStats {
+	var stats DiffStats
+	for _, line := range diff {
+		switch line.Op {
+		case DiffInsert:
+			stats.Added++
+		case DiffDelete:
+			stats.Removed++
+		}
+	}
+	return stats
+}
+
+// UnifiedDiff renders the changes between before and after in unified diff
+// format with the given number of context lines, or "" if they are equal.
+func UnifiedDiff(before, after string, context int) string {
+	diff := DiffLines(before, after)
+
+	var out strings.Builder
+	for start := 0; start < len(diff); {
+		if diff[start].Op == DiffEqual {
+			start++
+			continue
+		}
+
+		// Grow the hunk until the gap to the next change is wider than
+		// twice the context.
+		end := start
+		for next := start; next < len(diff); next++ {
+			if diff[next].Op != DiffEqual {
+				end = next + 1
+			} else if next-end >= 2*context {
+				break
+			}
+		}
+
+		from := max(start-context, 0)
+		to := min(end+context, len(diff))
+
+		oldStart, newStart := 1, 1
+		for _, line := range diff[:from] {
+			if line.Op != DiffInsert {
+				oldStart++
+			}
+			if line.Op != DiffDelete {
+				newStart++
+			}
+		}
+		oldCount, newCount := 0, 0
+		for _, line := range diff[from:to] {
+			if line.Op != DiffInsert {
+				oldCount++
+			}
+			if line.Op != DiffDelete {
+				newCount++
+			}
+		}
+
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount))
+		for _, line := range diff[from:to] {
+			switch line.Op {
+			case DiffEqual:
+				out.WriteString(" ")
+			case DiffInsert:
+				out.WriteString("+")
+			case DiffDelete:
+				out.WriteString("-")
+			}
+			out.WriteString(line.Text)
+			out.WriteString("\n")
+		}
+		start = to
+	}
+	return out.String()
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
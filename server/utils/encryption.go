@@ -0,0 +1,265 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"server/config"
+	"strings"
+	"sync"
+)
+
+// Secrets such as provider API keys are stored with envelope encryption:
+// each value is encrypted with its own random data key, and the data key is
+// wrapped with a master key from ENCRYPTION_KEYS. A sealed value looks like
+//
+//	enc:v1:<master key id>:<wrapped data key>:<ciphertext>
+//
+// Rotating the master key only re-wraps data keys, and because every master
+// key listed in ENCRYPTION_KEYS can still unwrap, values sealed under the old
+// key keep working while a rotation is in progress.
+const sealedPrefix = "enc:v1:"
+
+const dataKeySize = 32
+
+var (
+	ErrNoMasterKey      = errors.New("no master encryption key configured: set ENCRYPTION_KEYS and ENCRYPTION_KEY_ID")
+	ErrUnknownMasterKey = errors.New("secret was sealed with a master key that is not configured")
+)
+
+// Keyring holds the master keys by ID and the ID used for new seals.
+type Keyring struct {
+	ActiveID string
+	keys     map[string][]byte
+}
+
+var (
+	keyringOnce sync.Once
+	keyring     *Keyring
+	keyringErr  error
+)
+
+// LoadKeyring parses ENCRYPTION_KEYS, a comma-separated list of
+// "<id>:<base64 32-byte key>" pairs, and ENCRYPTION_KEY_ID, the ID of the
+// key new secrets are sealed with.
+func LoadKeyring() (*Keyring, error) {
+	return ParseKeyring(config.Config("ENCRYPTION_KEYS"), config.Config("ENCRYPTION_KEY_ID"))
+}
+
+// ParseKeyring builds a Keyring from the ENCRYPTION_KEYS and
+// ENCRYPTION_KEY_ID formats.
+func ParseKeyring(keys, activeID string) (*Keyring, error) {
+	ring := &Keyring{ActiveID: strings.TrimSpace(activeID), keys: map[string][]byte{}}
+
+	for _, entry := range strings.Split(keys, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid ENCRYPTION_KEYS entry %q: expected <id>:<base64 key>", entry)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("invalid master key %q: must be 32 bytes of base64", id)
+		}
+		if _, exists := ring.keys[id]; exists {
+			return nil, fmt.Errorf("master key %q listed twice", id)
+		}
+		ring.keys[id] = key
+	}
+
+	if len(ring.keys) == 0 || ring.ActiveID == "" {
+		return nil, ErrNoMasterKey
+	}
+	if _, ok := ring.keys[ring.ActiveID]; !ok {
+		return nil, fmt.Errorf("ENCRYPTION_KEY_ID %q is not listed in ENCRYPTION_KEYS", ring.ActiveID)
+	}
+	return ring, nil
+}
+
+// InitEncryption loads the process-wide keyring used by SealSecret and
+// OpenSecret. It is called once at startup so a missing master key stops the
+// server instead of failing the first request that touches a key.
+func InitEncryption() error {
+	keyringOnce.Do(func() {
+		keyring, keyringErr = LoadKeyring()
+	})
+	return keyringErr
+}
+
+func defaultKeyring() (*Keyring, error) {
+	if err := InitEncryption(); err != nil {
+		return nil, err
+	}
+	return keyring, nil
+}
+
+// IsSealed reports whether value was produced by SealSecret.
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, sealedPrefix)
+}
+
+// SealedKeyID returns the master key ID a sealed value is wrapped with.
+func SealedKeyID(value string) (string, bool) {
+	if !IsSealed(value) {
+		return "", false
+	}
+	id, _, ok := strings.Cut(strings.TrimPrefix(value, sealedPrefix), ":")
+	return id, ok
+}
+
+// SealSecret encrypts plaintext under the active master key. Empty values are
+// returned unchanged so that "no key" stays recognisable.
+func SealSecret(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	ring, err := defaultKeyring()
+	if err != nil {
+		return "", err
+	}
+	return ring.Seal(plaintext)
+}
+
+// OpenSecret decrypts a value produced by SealSecret. Values stored before
+// encryption was introduced are returned as they are until a rotation seals
+// them.
+func OpenSecret(value string) (string, error) {
+	if !IsSealed(value) {
+		return value, nil
+	}
+	ring, err := defaultKeyring()
+	if err != nil {
+		return "", err
+	}
+	return ring.Open(value)
+}
+
+// Seal encrypts plaintext with a fresh data key wrapped by the active key.
+func (k *Keyring) Seal(plaintext string) (string, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	ciphertext, err := encryptGCM(dataKey, []byte(plaintext), nil)
+	if err != nil {
+		return "", err
+	}
+	return k.wrap(dataKey, ciphertext)
+}
+
+// Open decrypts a sealed value with whichever configured master key it names.
+func (k *Keyring) Open(value string) (string, error) {
+	dataKey, ciphertext, err := k.unwrap(value)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := decryptGCM(dataKey, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// Reseal moves value under the active master key. Sealed values only have
+// their data key re-wrapped; plaintext values are sealed for the first time.
+// The second result is false when value needed no change.
+func (k *Keyring) Reseal(value string) (string, bool, error) {
+	if value == "" {
+		return value, false, nil
+	}
+	if !IsSealed(value) {
+		sealed, err := k.Seal(value)
+		return sealed, err == nil, err
+	}
+	if id, _ := SealedKeyID(value); id == k.ActiveID {
+		return value, false, nil
+	}
+
+	dataKey, ciphertext, err := k.unwrap(value)
+	if err != nil {
+		return "", false, err
+	}
+	resealed, err := k.wrap(dataKey, ciphertext)
+	return resealed, err == nil, err
+}
+
+func (k *Keyring) wrap(dataKey, ciphertext []byte) (string, error) {
+	wrappedKey, err := encryptGCM(k.keys[k.ActiveID], dataKey, []byte(k.ActiveID))
+	if err != nil {
+		return "", err
+	}
+	return sealedPrefix + k.ActiveID + ":" +
+		base64.RawStdEncoding.EncodeToString(wrappedKey) + ":" +
+		base64.RawStdEncoding.EncodeToString(ciphertext), nil
+}
+
+func (k *Keyring) unwrap(value string) ([]byte, []byte, error) {
+	parts := strings.Split(strings.TrimPrefix(value, sealedPrefix), ":")
+	if len(parts) != 3 {
+		return nil, nil, errors.New("malformed sealed secret")
+	}
+
+	masterKey, ok := k.keys[parts[0]]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %q", ErrUnknownMasterKey, parts[0])
+	}
+
+	wrappedKey, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, nil, errors.New("malformed sealed secret")
+	}
+	ciphertext, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, nil, errors.New("malformed sealed secret")
+	}
+
+	dataKey, err := decryptGCM(masterKey, wrappedKey, []byte(parts[0]))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	return dataKey, ciphertext, nil
+}
+
+// encryptGCM returns nonce || AES-GCM(key, plaintext).
+func encryptGCM(key, plaintext, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func decryptGCM(key, sealed, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, additionalData)
+}
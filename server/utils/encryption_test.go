@@ -0,0 +1,199 @@
+package utils
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testMasterKey(fill byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(rune(fill)), 32)))
+}
+
+func testKeyring(t *testing.T, keys, activeID string) *Keyring {
+	t.Helper()
+	ring, err := ParseKeyring(keys, activeID)
+	if err != nil {
+		t.Fatalf("ParseKeyring() error = %v", err)
+	}
+	return ring
+}
+
+// tamper flips a bit in part 1 (wrapped key) or 2 (ciphertext) of a sealed
+// value.
+func tamper(t *testing.T, sealed string, part int) string {
+	t.Helper()
+	parts := strings.Split(strings.TrimPrefix(sealed, sealedPrefix), ":")
+	raw, err := base64.RawStdEncoding.DecodeString(parts[part])
+	if err != nil {
+		t.Fatalf("decoding part %d: %v", part, err)
+	}
+	raw[len(raw)-1] ^= 1
+	parts[part] = base64.RawStdEncoding.EncodeToString(raw)
+	return sealedPrefix + strings.Join(parts, ":")
+}
+
+var (
+	oldKeys  = "old:" + testMasterKey('a')
+	bothKeys = "old:" + testMasterKey('a') + ", new:" + testMasterKey('b')
+)
+
+func TestKeyringSealOpenRoundTrip(t *testing.T) {
+	ring := testKeyring(t, oldKeys, "old")
+
+	sealed, err := ring.Seal("sk-secret")
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+	if !IsSealed(sealed) || strings.Contains(sealed, "sk-secret") {
+		t.Fatalf("Seal() = %q, want a sealed value hiding the plaintext", sealed)
+	}
+	if id, _ := SealedKeyID(sealed); id != "old" {
+		t.Errorf("SealedKeyID() = %q, want %q", id, "old")
+	}
+
+	opened, err := ring.Open(sealed)
+	if err != nil || opened != "sk-secret" {
+		t.Errorf("Open() = %q, %v; want %q", opened, err, "sk-secret")
+	}
+
+	again, _ := ring.Seal("sk-secret")
+	if again == sealed {
+		t.Error("sealing the same value twice gave the same result")
+	}
+}
+
+func TestKeyringOpensValuesSealedUnderEveryListedKey(t *testing.T) {
+	sealedOld, err := testKeyring(t, oldKeys, "old").Seal("under old")
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+
+	rotated := testKeyring(t, bothKeys, "new")
+	sealedNew, err := rotated.Seal("under new")
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+	if id, _ := SealedKeyID(sealedNew); id != "new" {
+		t.Errorf("new seal uses key %q, want %q", id, "new")
+	}
+
+	for sealed, want := range map[string]string{sealedOld: "under old", sealedNew: "under new"} {
+		if opened, err := rotated.Open(sealed); err != nil || opened != want {
+			t.Errorf("Open() = %q, %v; want %q", opened, err, want)
+		}
+	}
+}
+
+func TestKeyringReseal(t *testing.T) {
+	sealedOld, err := testKeyring(t, oldKeys, "old").Seal("sk-old")
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+	rotated := testKeyring(t, bothKeys, "new")
+	sealedNew, err := rotated.Seal("sk-new")
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+
+	if got, changed, err := rotated.Reseal(sealedNew); err != nil || changed || got != sealedNew {
+		t.Errorf("Reseal(active) = %q, %v, %v; want it unchanged", got, changed, err)
+	}
+	if got, changed, err := rotated.Reseal(""); err != nil || changed || got != "" {
+		t.Errorf("Reseal(\"\") = %q, %v, %v; want it unchanged", got, changed, err)
+	}
+
+	resealed, changed, err := rotated.Reseal(sealedOld)
+	if err != nil || !changed {
+		t.Fatalf("Reseal(old) = %v, %v; want a changed value", changed, err)
+	}
+	if id, _ := SealedKeyID(resealed); id != "new" {
+		t.Errorf("resealed value uses key %q, want %q", id, "new")
+	}
+	// Only the data key is re-wrapped; the ciphertext stays as it was.
+	oldParts := strings.Split(sealedOld, ":")
+	newParts := strings.Split(resealed, ":")
+	if oldParts[len(oldParts)-1] != newParts[len(newParts)-1] {
+		t.Error("Reseal re-encrypted the value instead of re-wrapping its data key")
+	}
+	if opened, err := testKeyring(t, "new:"+testMasterKey('b'), "new").Open(resealed); err != nil || opened != "sk-old" {
+		t.Errorf("opening the resealed value without the old key = %q, %v; want %q", opened, err, "sk-old")
+	}
+
+	sealedPlain, changed, err := rotated.Reseal("sk-legacy")
+	if err != nil || !changed || !IsSealed(sealedPlain) {
+		t.Fatalf("Reseal(plaintext) = %q, %v, %v; want it sealed", sealedPlain, changed, err)
+	}
+	if opened, _ := rotated.Open(sealedPlain); opened != "sk-legacy" {
+		t.Errorf("Open(Reseal(plaintext)) = %q, want %q", opened, "sk-legacy")
+	}
+}
+
+func TestKeyringOpenRejectsTampering(t *testing.T) {
+	ring := testKeyring(t, bothKeys, "old")
+	sealed, err := ring.Seal("sk-secret")
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+
+	tests := map[string]string{
+		"wrapped key":       tamper(t, sealed, 1),
+		"ciphertext":        tamper(t, sealed, 2),
+		"key ID swapped":    strings.Replace(sealed, sealedPrefix+"old:", sealedPrefix+"new:", 1),
+		"missing part":      sealed[:strings.LastIndex(sealed, ":")],
+		"not base64":        sealed + "!",
+		"truncated wrapped": sealedPrefix + "old:AAAA:" + strings.Split(sealed, ":")[4],
+	}
+	for name, value := range tests {
+		t.Run(name, func(t *testing.T) {
+			if opened, err := ring.Open(value); err == nil {
+				t.Errorf("Open() = %q, want an error", opened)
+			}
+		})
+	}
+}
+
+func TestKeyringUnknownMasterKey(t *testing.T) {
+	sealed, err := testKeyring(t, "retired:"+testMasterKey('c'), "retired").Seal("sk-secret")
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+
+	ring := testKeyring(t, bothKeys, "new")
+	if _, err := ring.Open(sealed); !errors.Is(err, ErrUnknownMasterKey) {
+		t.Errorf("Open() error = %v, want %v", err, ErrUnknownMasterKey)
+	}
+	if _, _, err := ring.Reseal(sealed); !errors.Is(err, ErrUnknownMasterKey) {
+		t.Errorf("Reseal() error = %v, want %v", err, ErrUnknownMasterKey)
+	}
+}
+
+func TestParseKeyringRejectsMalformedKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     string
+		activeID string
+	}{
+		{"no keys", "", "k1"},
+		{"no active ID", "k1:" + testMasterKey('a'), ""},
+		{"active ID not listed", "k1:" + testMasterKey('a'), "k2"},
+		{"missing separator", testMasterKey('a'), "k1"},
+		{"empty ID", ":" + testMasterKey('a'), "k1"},
+		{"not base64", "k1:not base64!", "k1"},
+		{"short key", "k1:" + base64.StdEncoding.EncodeToString([]byte("too short")), "k1"},
+		{"duplicate ID", "k1:" + testMasterKey('a') + ",k1:" + testMasterKey('b'), "k1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseKeyring(tt.keys, tt.activeID); err == nil {
+				t.Error("ParseKeyring() succeeded, want an error")
+			}
+		})
+	}
+
+	if _, err := ParseKeyring(" k1:"+testMasterKey('a')+" , ,k2:"+testMasterKey('b'), " k2 "); err != nil {
+		t.Errorf("ParseKeyring() with spaces and empty entries error = %v", err)
+	}
+}
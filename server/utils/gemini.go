@@ -7,8 +7,7 @@ import (
 	"server/config"
 )
 
-func GetGeminiResponse(prompt string, model string) (string, error) {
-	ctx := context.Background()
+func GetGeminiResponse(ctx context.Context, prompt string, model string) (string, error) {
 	client, err := genai.NewClient(ctx, &genai.ClientConfig{
 		APIKey:  config.Config("GEMINI_API_KEY"),
 		Backend: genai.BackendGeminiAPI,
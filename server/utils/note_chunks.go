@@ -0,0 +1,237 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"server/models"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// Chunks are at most chunkSize characters long and repeat about the last
+	// chunkOverlap characters of the chunk before them, so that a passage cut
+	// in two is still found whole in one of them.
+	chunkSize    = 1000
+	chunkOverlap = 200
+	// maxNoteChunks bounds how much of a very long note is embedded.
+	maxNoteChunks = 100
+
+	DefaultSemanticSearchLimit = 10
+	MaxSemanticSearchLimit     = 50
+)
+
+// ChunkNoteContent splits content into overlapping chunks for embedding.
+// Chunks end at a paragraph break, sentence end or space where possible.
+func ChunkNoteContent(content string) []string {
+	runes := []rune(strings.TrimSpace(content))
+	var chunks []string
+
+	for start := 0; start < len(runes) && len(chunks) < maxNoteChunks; {
+		end := len(runes)
+		if start+chunkSize < end {
+			end = chunkEnd(runes, start+chunkSize/2, start+chunkSize)
+		}
+		if chunk := strings.TrimSpace(string(runes[start:end])); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		if end == len(runes) {
+			break
+		}
+
+		// Start the next chunk at a word, chunkOverlap characters back.
+		next := end - chunkOverlap
+		for next < end && !unicode.IsSpace(runes[next-1]) {
+			next++
+		}
+		if next == end {
+			next = end - chunkOverlap
+		}
+		start = next
+	}
+	return chunks
+}
+
+// chunkEnd returns where a chunk should end, between from and to: after the
+// last paragraph break if there is one, else after the last sentence, else at
+// the last space, else at to.
+func chunkEnd(runes []rune, from, to int) int {
+	breaks := []func(i int) bool{
+		func(i int) bool { return runes[i-1] == '\n' && runes[i-2] == '\n' },
+		func(i int) bool { return strings.ContainsRune(".!?\n", runes[i-1]) && unicode.IsSpace(runes[i]) },
+		func(i int) bool { return unicode.IsSpace(runes[i]) },
+	}
+	for _, isBreak := range breaks {
+		for i := to; i > from; i-- {
+			if isBreak(i) {
+				return i
+			}
+		}
+	}
+	return to
+}
+
+// NoteContentHash identifies the title and content of note as embedded.
+func NoteContentHash(note models.Note) string {
+	sum := sha256.Sum256([]byte(note.Title + "\x00" + note.Content))
+	return hex.EncodeToString(sum[:])
+}
+
+// NoteChunksCurrent reports whether the note's stored chunks were embedded
+// from content with hash by model.
+func NoteChunksCurrent(ctx context.Context, db *mongo.Database, noteID primitive.ObjectID, hash, model string) (bool, error) {
+	count, err := db.Collection("note_chunks").CountDocuments(ctx,
+		bson.M{"noteId": noteID, "contentHash": hash, "model": model},
+		options.Count().SetLimit(1),
+	)
+	return count > 0, err
+}
+
+// ReplaceNoteChunks stores texts and their embeddings as the chunks of note,
+// replacing any it had.
+func ReplaceNoteChunks(ctx context.Context, db *mongo.Database, note models.Note, provider, model, hash string, texts []string, embeddings [][]float32) error {
+	if err := DeleteNoteChunks(ctx, db, note.ID); err != nil {
+		return err
+	}
+	if len(texts) == 0 {
+		return nil
+	}
+
+	chunks := make([]interface{}, len(texts))
+	for i, text := range texts {
+		chunks[i] = models.NoteChunk{
+			NoteID:      note.ID,
+			UserID:      note.UserID,
+			Index:       i,
+			Text:        text,
+			Embedding:   embeddings[i],
+			Provider:    provider,
+			Model:       model,
+			ContentHash: hash,
+			CreatedAt:   time.Now(),
+		}
+	}
+	_, err := db.Collection("note_chunks").InsertMany(ctx, chunks)
+	return err
+}
+
+// DeleteNoteChunks removes the chunks of the given notes.
+func DeleteNoteChunks(ctx context.Context, db *mongo.Database, noteIDs ...primitive.ObjectID) error {
+	_, err := db.Collection("note_chunks").DeleteMany(ctx, bson.M{"noteId": bson.M{"$in": noteIDs}})
+	return err
+}
+
+// CosineSimilarity returns the cosine of the angle between a and b, or 0 if
+// they differ in length or either is zero.
+func CosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// RankNoteChunks compares query with every chunk of the user's notes that
+// model embedded, and returns the notes whose best chunk is closest to it,
+// best first. The comparison runs here rather than in a vector index, which
+// is fine for the few thousand chunks a user's notes make up.
+func RankNoteChunks(ctx context.Context, db *mongo.Database, userID primitive.ObjectID, model string, query []float32, limit int) ([]models.SemanticSearchResult, error) {
+	cursor, err := db.Collection("note_chunks").Find(ctx, bson.M{"userId": userID, "model": model})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	best := map[primitive.ObjectID]models.SemanticSearchResult{}
+	for cursor.Next(ctx) {
+		var chunk models.NoteChunk
+		if err := cursor.Decode(&chunk); err != nil {
+			return nil, err
+		}
+
+		score := CosineSimilarity(query, chunk.Embedding)
+		if current, ok := best[chunk.NoteID]; ok && current.Score >= score {
+			continue
+		}
+		best[chunk.NoteID] = models.SemanticSearchResult{
+			NoteID:     chunk.NoteID,
+			Excerpt:    chunk.Text,
+			ChunkIndex: chunk.Index,
+			Score:      score,
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	results := make([]models.SemanticSearchResult, 0, len(best))
+	for _, result := range best {
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	return withNoteTitles(ctx, db, userID, results)
+}
+
+// withNoteTitles fills in the titles of results, dropping notes that no
+// longer exist or are in the trash.
+func withNoteTitles(ctx context.Context, db *mongo.Database, userID primitive.ObjectID, results []models.SemanticSearchResult) ([]models.SemanticSearchResult, error) {
+	if len(results) == 0 {
+		return results, nil
+	}
+
+	noteIDs := make([]primitive.ObjectID, len(results))
+	for i, result := range results {
+		noteIDs[i] = result.NoteID
+	}
+
+	cursor, err := db.Collection("notes").Find(ctx,
+		bson.M{"_id": bson.M{"$in": noteIDs}, "userId": userID, "deletedAt": nil},
+		options.Find().SetProjection(bson.M{"title": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var notes []models.Note
+	if err := cursor.All(ctx, &notes); err != nil {
+		return nil, err
+	}
+	titles := make(map[primitive.ObjectID]string, len(notes))
+	for _, note := range notes {
+		titles[note.ID] = note.Title
+	}
+
+	found := results[:0]
+	for _, result := range results {
+		if title, ok := titles[result.NoteID]; ok {
+			result.Title = title
+			found = append(found, result)
+		}
+	}
+	return found, nil
+}
@@ -0,0 +1,273 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"server/models"
+	"strconv"
+	"strings"
+)
+
+// MaxNoteEdits caps how many operations one suggestion may carry.
+const MaxNoteEdits = 50
+
+// NoteEditError reports the edit that could not be applied. Edits are
+// applied all or nothing, so none of them took effect.
+type NoteEditError struct {
+	Index  int    `json:"index"`
+	Op     string `json:"op"`
+	Reason string `json:"reason"`
+}
+
+func (e *NoteEditError) Error() string {
+	return fmt.Sprintf("edit %d (%s): %s", e.Index, e.Op, e.Reason)
+}
+
+var listItemPattern = regexp.MustCompile(`^(\s*)([-*+]|\d+[.)])\s+(\[[ xX]\]\s+)?`)
+
+// ApplyNoteEdits applies edits to content in order and returns the result.
+// Notes are treated as Markdown: headings start with '#', paragraphs are
+// runs of non-blank lines and list items start with a bullet or number.
+func ApplyNoteEdits(content string, edits []models.NoteEdit) (string, error) {
+	if len(edits) > MaxNoteEdits {
+		return "", &NoteEditError{Index: MaxNoteEdits, Reason: fmt.Sprintf("at most %d edits can be applied at once", MaxNoteEdits)}
+	}
+
+	trailingNewline := strings.HasSuffix(content, "\n")
+	lines := splitLines(content)
+
+	for i, edit := range edits {
+		var err error
+		lines, err = applyNoteEdit(lines, edit)
+		if err != nil {
+			return "", &NoteEditError{Index: i, Op: edit.Op, Reason: err.Error()}
+		}
+	}
+
+	result := strings.Join(lines, "\n")
+	if trailingNewline && result != "" {
+		result += "\n"
+	}
+	return result, nil
+}
+
+func applyNoteEdit(lines []string, edit models.NoteEdit) ([]string, error) {
+	switch edit.Op {
+	case models.NoteEditInsertAfterHeading:
+		if edit.Heading == "" || strings.TrimSpace(edit.Content) == "" {
+			return nil, fmt.Errorf("heading and content are required")
+		}
+		heading, ok := findHeading(lines, edit.Heading)
+		if !ok {
+			return nil, fmt.Errorf("heading %q not found", edit.Heading)
+		}
+		return insertBlock(lines, heading+1, editLines(edit.Content)), nil
+
+	case models.NoteEditReplaceParagraph:
+		if edit.Target == "" || strings.TrimSpace(edit.Content) == "" {
+			return nil, fmt.Errorf("target and content are required; use delete_paragraph to remove text")
+		}
+		start, end, err := findParagraph(lines, edit.Target)
+		if err != nil {
+			return nil, err
+		}
+		return splice(lines, start, end, editLines(edit.Content)), nil
+
+	case models.NoteEditDeleteParagraph:
+		if edit.Target == "" {
+			return nil, fmt.Errorf("target is required")
+		}
+		start, end, err := findParagraph(lines, edit.Target)
+		if err != nil {
+			return nil, err
+		}
+		// Take one separating blank line with it so no gap is left behind.
+		if end < len(lines) && isBlank(lines[end]) {
+			end++
+		} else if start > 0 && isBlank(lines[start-1]) {
+			start--
+		}
+		return splice(lines, start, end, nil), nil
+
+	case models.NoteEditAppendListItems:
+		if len(edit.Items) == 0 {
+			return nil, fmt.Errorf("items are required")
+		}
+		return appendListItems(lines, edit.Heading, edit.Items)
+
+	case models.NoteEditAppend:
+		if strings.TrimSpace(edit.Content) == "" {
+			return nil, fmt.Errorf("content is required")
+		}
+		return insertBlock(lines, len(lines), editLines(edit.Content)), nil
+
+	default:
+		return nil, fmt.Errorf("unknown operation %q", edit.Op)
+	}
+}
+
+func appendListItems(lines []string, heading string, items []string) ([]string, error) {
+	from, to := 0, len(lines)
+	if heading != "" {
+		index, ok := findHeading(lines, heading)
+		if !ok {
+			return nil, fmt.Errorf("heading %q not found", heading)
+		}
+		from, to = index+1, sectionEnd(lines, index)
+	}
+
+	last := -1
+	for i := to - 1; i >= from; i-- {
+		if listItemPattern.MatchString(lines[i]) {
+			last = i
+			break
+		}
+	}
+
+	// Without a list to extend, start a new one where the section ends.
+	if last < 0 {
+		newItems := make([]string, len(items))
+		for i, item := range items {
+			newItems[i] = "- " + strings.TrimSpace(item)
+		}
+		return insertBlock(lines, to, newItems), nil
+	}
+
+	match := listItemPattern.FindStringSubmatch(lines[last])
+	indent, marker, checkbox := match[1], match[2], match[3]
+
+	// Items can wrap onto indented continuation lines.
+	insertAt := last + 1
+	for insertAt < to && !isBlank(lines[insertAt]) && !listItemPattern.MatchString(lines[insertAt]) &&
+		len(lines[insertAt])-len(strings.TrimLeft(lines[insertAt], " \t")) > len(indent) {
+		insertAt++
+	}
+
+	newItems := make([]string, len(items))
+	for i, item := range items {
+		itemMarker := marker
+		if number, err := strconv.Atoi(strings.TrimRight(marker, ".)")); err == nil {
+			itemMarker = strconv.Itoa(number+i+1) + marker[len(marker)-1:]
+		}
+		prefix := indent + itemMarker + " "
+		if checkbox != "" {
+			prefix += "[ ] "
+		}
+		newItems[i] = prefix + strings.TrimSpace(item)
+	}
+	return splice(lines, insertAt, insertAt, newItems), nil
+}
+
+// findHeading returns the line of the first heading whose text matches
+// heading, ignoring case, '#' markers and surrounding whitespace.
+func findHeading(lines []string, heading string) (int, bool) {
+	want := normalizeText(strings.Trim(strings.TrimSpace(heading), "# "))
+	for i, line := range lines {
+		if text, ok := headingText(line); ok && strings.EqualFold(normalizeText(text), want) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func headingText(line string) (string, bool) {
+	trimmed := strings.TrimSpace(line)
+	if !strings.HasPrefix(trimmed, "#") {
+		return "", false
+	}
+	text := strings.TrimLeft(trimmed, "#")
+	if text != "" && text[0] != ' ' && text[0] != '\t' {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimRight(text, "# ")), true
+}
+
+func headingLevel(line string) int {
+	trimmed := strings.TrimSpace(line)
+	return len(trimmed) - len(strings.TrimLeft(trimmed, "#"))
+}
+
+// sectionEnd returns the line where the section started by the heading at
+// index ends: the next heading of the same or a higher level.
+func sectionEnd(lines []string, index int) int {
+	level := headingLevel(lines[index])
+	for i := index + 1; i < len(lines); i++ {
+		if _, ok := headingText(lines[i]); ok && headingLevel(lines[i]) <= level {
+			return i
+		}
+	}
+	return len(lines)
+}
+
+// findParagraph locates target as a whole paragraph or, failing that, as a
+// single line, comparing with whitespace normalised. Ambiguous targets are
+// rejected rather than guessed.
+func findParagraph(lines []string, target string) (int, int, error) {
+	want := normalizeText(target)
+
+	var matches [][2]int
+	for start := 0; start < len(lines); {
+		if isBlank(lines[start]) {
+			start++
+			continue
+		}
+		end := start
+		for end < len(lines) && !isBlank(lines[end]) {
+			end++
+		}
+		if normalizeText(strings.Join(lines[start:end], "\n")) == want {
+			matches = append(matches, [2]int{start, end})
+		}
+		start = end
+	}
+
+	if len(matches) == 0 {
+		for i, line := range lines {
+			if normalizeText(line) == want {
+				matches = append(matches, [2]int{i, i + 1})
+			}
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return 0, 0, fmt.Errorf("target text not found in the note")
+	case 1:
+		return matches[0][0], matches[0][1], nil
+	default:
+		return 0, 0, fmt.Errorf("target text appears %d times in the note", len(matches))
+	}
+}
+
+// insertBlock inserts block at index, keeping it separated from surrounding
+// paragraphs by blank lines.
+func insertBlock(lines []string, index int, block []string) []string {
+	if index > 0 && !isBlank(lines[index-1]) {
+		if _, ok := headingText(lines[index-1]); !ok {
+			block = append([]string{""}, block...)
+		}
+	}
+	if index < len(lines) && !isBlank(lines[index]) {
+		block = append(block, "")
+	}
+	return splice(lines, index, index, block)
+}
+
+func splice(lines []string, start, end int, replacement []string) []string {
+	result := make([]string, 0, len(lines)-(end-start)+len(replacement))
+	result = append(result, lines[:start]...)
+	result = append(result, replacement...)
+	return append(result, lines[end:]...)
+}
+
+func editLines(content string) []string {
+	return strings.Split(strings.Trim(content, "\n"), "\n")
+}
+
+func normalizeText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
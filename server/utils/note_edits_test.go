@@ -0,0 +1,182 @@
+package utils
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"server/models"
+)
+
+const editedNote = `# Groceries
+- milk
+- eggs
+
+# Notes
+First paragraph.
+
+Second paragraph.
+`
+
+func TestApplyNoteEdits(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		edits   []models.NoteEdit
+		want    string
+	}{
+		{
+			name:    "insert after heading",
+			content: editedNote,
+			edits:   []models.NoteEdit{{Op: models.NoteEditInsertAfterHeading, Heading: "## notes", Content: "Inserted."}},
+			want:    "# Groceries\n- milk\n- eggs\n\n# Notes\nInserted.\n\nFirst paragraph.\n\nSecond paragraph.\n",
+		},
+		{
+			name:    "replace paragraph",
+			content: editedNote,
+			edits:   []models.NoteEdit{{Op: models.NoteEditReplaceParagraph, Target: "Second   paragraph.", Content: "Replaced."}},
+			want:    "# Groceries\n- milk\n- eggs\n\n# Notes\nFirst paragraph.\n\nReplaced.\n",
+		},
+		{
+			name:    "delete paragraph",
+			content: editedNote,
+			edits:   []models.NoteEdit{{Op: models.NoteEditDeleteParagraph, Target: "First paragraph."}},
+			want:    "# Groceries\n- milk\n- eggs\n\n# Notes\nSecond paragraph.\n",
+		},
+		{
+			name:    "append list items under heading",
+			content: editedNote,
+			edits:   []models.NoteEdit{{Op: models.NoteEditAppendListItems, Heading: "Groceries", Items: []string{"bread", " butter "}}},
+			want:    "# Groceries\n- milk\n- eggs\n- bread\n- butter\n\n# Notes\nFirst paragraph.\n\nSecond paragraph.\n",
+		},
+		{
+			name:    "append list items continues numbering and checkboxes",
+			content: "1. [x] one\n2. [ ] two",
+			edits:   []models.NoteEdit{{Op: models.NoteEditAppendListItems, Items: []string{"three"}}},
+			want:    "1. [x] one\n2. [ ] two\n3. [ ] three",
+		},
+		{
+			name:    "append list items starts a list",
+			content: "# Todo\nNothing yet.",
+			edits:   []models.NoteEdit{{Op: models.NoteEditAppendListItems, Heading: "Todo", Items: []string{"write tests"}}},
+			want:    "# Todo\nNothing yet.\n\n- write tests",
+		},
+		{
+			name:    "append",
+			content: editedNote,
+			edits:   []models.NoteEdit{{Op: models.NoteEditAppend, Content: "The end."}},
+			want:    editedNote + "\nThe end.\n",
+		},
+		{
+			name:    "edits apply in order",
+			content: "Draft.",
+			edits: []models.NoteEdit{
+				{Op: models.NoteEditReplaceParagraph, Target: "Draft.", Content: "Final."},
+				{Op: models.NoteEditAppend, Content: "Signed."},
+			},
+			want: "Final.\n\nSigned.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ApplyNoteEdits(tt.content, tt.edits)
+			if err != nil {
+				t.Fatalf("ApplyNoteEdits() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ApplyNoteEdits() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyNoteEditsIsAllOrNothing(t *testing.T) {
+	valid := models.NoteEdit{Op: models.NoteEditAppend, Content: "Added."}
+	tests := []struct {
+		name  string
+		edits []models.NoteEdit
+		index int
+	}{
+		{"missing heading", []models.NoteEdit{{Op: models.NoteEditInsertAfterHeading, Heading: "Missing", Content: "x"}}, 0},
+		{"missing list heading", []models.NoteEdit{{Op: models.NoteEditAppendListItems, Heading: "Missing", Items: []string{"x"}}}, 0},
+		{"missing target", []models.NoteEdit{valid, {Op: models.NoteEditReplaceParagraph, Target: "Third paragraph.", Content: "x"}}, 1},
+		{"missing delete target", []models.NoteEdit{valid, valid, {Op: models.NoteEditDeleteParagraph, Target: "Nowhere."}}, 2},
+		{"ambiguous target", []models.NoteEdit{valid, {Op: models.NoteEditDeleteParagraph, Target: "Added."}}, 1},
+		{"empty replacement", []models.NoteEdit{{Op: models.NoteEditReplaceParagraph, Target: "First paragraph."}}, 0},
+		{"unknown op", []models.NoteEdit{valid, {Op: "rewrite"}}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The note ends in "Added.", so appending it again makes the
+			// ambiguous target case match twice.
+			got, err := ApplyNoteEdits(editedNote+"\nAdded.\n", tt.edits)
+			var editErr *NoteEditError
+			if !errors.As(err, &editErr) {
+				t.Fatalf("ApplyNoteEdits() = %q, %v; want a *NoteEditError", got, err)
+			}
+			if editErr.Index != tt.index {
+				t.Errorf("failed edit index = %d, want %d", editErr.Index, tt.index)
+			}
+			if got != "" {
+				t.Errorf("ApplyNoteEdits() returned content %q alongside an error", got)
+			}
+		})
+	}
+}
+
+func TestApplyNoteEditsRejectsTooManyEdits(t *testing.T) {
+	edits := make([]models.NoteEdit, MaxNoteEdits+1)
+	for i := range edits {
+		edits[i] = models.NoteEdit{Op: models.NoteEditAppend, Content: "x"}
+	}
+	if _, err := ApplyNoteEdits("", edits); err == nil {
+		t.Errorf("ApplyNoteEdits() with %d edits succeeded, want an error", len(edits))
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after string
+		want          []DiffLine
+	}{
+		{
+			name:   "equal",
+			before: "a\nb\n",
+			after:  "a\nb",
+			want:   []DiffLine{{DiffEqual, "a"}, {DiffEqual, "b"}},
+		},
+		{
+			name:   "changed line",
+			before: "a\nb\nc",
+			after:  "a\nB\nc",
+			want:   []DiffLine{{DiffEqual, "a"}, {DiffDelete, "b"}, {DiffInsert, "B"}, {DiffEqual, "c"}},
+		},
+		{
+			name:   "inserted and removed lines",
+			before: "a\nb\nc\nd",
+			after:  "b\nc\nx\nd",
+			want:   []DiffLine{{DiffDelete, "a"}, {DiffEqual, "b"}, {DiffEqual, "c"}, {DiffInsert, "x"}, {DiffEqual, "d"}},
+		},
+		{
+			name:   "from empty",
+			before: "",
+			after:  "a",
+			want:   []DiffLine{{DiffInsert, "a"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DiffLines(tt.before, tt.after)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffLines() = %v, want %v", got, tt.want)
+			}
+			if stats := CountDiff(got); tt.name == "changed line" && stats != (DiffStats{Added: 1, Removed: 1}) {
+				t.Errorf("CountDiff() = %+v, want 1 added and 1 removed", stats)
+			}
+		})
+	}
+}
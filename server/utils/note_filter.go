@@ -0,0 +1,293 @@
+package utils
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"server/models"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Orders of a note listing.
+const (
+	NoteSortCreated = "created"
+	NoteSortUpdated = "updated"
+	NoteSortTitle   = "title"
+)
+
+// noteSortFields maps each order to the field it sorts by.
+var noteSortFields = map[string]string{
+	NoteSortCreated: "createdAt",
+	NoteSortUpdated: "updatedAt",
+	NoteSortTitle:   "title",
+}
+
+// Which archived notes a NoteFilter keeps.
+const (
+	ArchivedExclude = ""
+	ArchivedInclude = "include"
+	ArchivedOnly    = "only"
+)
+
+// titleCollation sorts titles ignoring case. The userId_pinned_title index is
+// built with the same collation.
+var titleCollation = &options.Collation{Locale: "en", Strength: 2}
+
+// ErrInvalidNoteCursor is returned for a cursor that was not produced by a
+// listing with the same order.
+var ErrInvalidNoteCursor = errors.New("invalid cursor")
+
+// NoteFilter narrows the notes returned by ListUserNotes. Zero values do not
+// filter.
+type NoteFilter struct {
+	// Tag must already be normalized.
+	Tag        string
+	NotebookID *primitive.ObjectID
+	// Unfiled keeps only notes that are in no notebook.
+	Unfiled bool
+	// Favorites keeps only favorite notes.
+	Favorites bool
+	// Archived is one of the Archived values. Archived notes are left out
+	// by default.
+	Archived string
+}
+
+func (f NoteFilter) query(userID primitive.ObjectID) bson.M {
+	query := bson.M{"userId": userID, "deletedAt": nil}
+	if f.Tag != "" {
+		query["tags"] = f.Tag
+	}
+	if f.NotebookID != nil {
+		query["notebookId"] = *f.NotebookID
+	} else if f.Unfiled {
+		query["notebookId"] = nil
+	}
+	if f.Favorites {
+		query["favorite"] = true
+	}
+	switch f.Archived {
+	case ArchivedExclude:
+		query["archived"] = bson.M{"$ne": true}
+	case ArchivedOnly:
+		query["archived"] = true
+	}
+	return query
+}
+
+// noteSummaryProjection loads what SummarizeNotes needs: everything but the
+// content, of which only the start is loaded.
+var noteSummaryProjection = bson.M{
+	"title":      1,
+	"userId":     1,
+	"tags":       1,
+	"notebookId": 1,
+	"createdAt":  1,
+	"updatedAt":  1,
+	"version":    1,
+	"pinned":     1,
+	"archived":   1,
+	"favorite":   1,
+	"deletedAt":  1,
+	"content": bson.M{"$substrCP": bson.A{
+		bson.M{"$ifNull": bson.A{"$content", ""}}, 0, snippetLength + 1,
+	}},
+}
+
+// NoteListOptions selects one page of a note listing.
+type NoteListOptions struct {
+	Filter NoteFilter
+	// Sort is one of the NoteSort orders, NoteSortCreated if empty.
+	Sort      string
+	Ascending bool
+	Limit     int
+	// Cursor is the NextCursor of the previous page, empty for the first.
+	Cursor string
+	// Summary loads only the start of each note's content, enough for
+	// SummarizeNotes.
+	Summary bool
+}
+
+// NotePage is one page of a note listing.
+type NotePage struct {
+	Notes []models.Note
+	// Total counts the notes matching the filter on all pages.
+	Total int64
+	// NextCursor continues the listing after Notes, empty on the last page.
+	NextCursor string
+}
+
+// noteCursor is the position after the last note of a page: whether it is
+// pinned, its sort value and its ID, which breaks ties. It records the order
+// it was made for.
+type noteCursor struct {
+	Sort      string             `json:"s"`
+	Ascending bool               `json:"a,omitempty"`
+	Pinned    bool               `json:"p,omitempty"`
+	Time      int64              `json:"t,omitempty"`
+	Title     string             `json:"v,omitempty"`
+	ID        primitive.ObjectID `json:"id"`
+}
+
+// IsNoteSort reports whether sort is one of the NoteSort orders.
+func IsNoteSort(sort string) bool {
+	_, ok := noteSortFields[sort]
+	return ok
+}
+
+// ListUserNotes returns a page of the user's notes matching opts.Filter,
+// pinned notes first and each group in the order opts asks for. Pages are
+// found by keyset so that later pages cost no more than the first.
+func ListUserNotes(ctx context.Context, db *mongo.Database, userID primitive.ObjectID, opts NoteListOptions) (NotePage, error) {
+	if opts.Sort == "" {
+		opts.Sort = NoteSortCreated
+	}
+	field := noteSortFields[opts.Sort]
+	collection := db.Collection("notes")
+
+	query := opts.Filter.query(userID)
+	total, err := collection.CountDocuments(ctx, query)
+	if err != nil {
+		return NotePage{}, err
+	}
+
+	if opts.Cursor != "" {
+		after, err := decodeNoteCursor(opts.Cursor, opts.Sort, opts.Ascending)
+		if err != nil {
+			return NotePage{}, err
+		}
+		query = bson.M{"$and": bson.A{query, after.filter(field)}}
+	}
+
+	direction := -1
+	if opts.Ascending {
+		direction = 1
+	}
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "pinned", Value: -1}, {Key: field, Value: direction}, {Key: "_id", Value: direction}}).
+		SetLimit(int64(opts.Limit + 1))
+	if opts.Sort == NoteSortTitle {
+		findOptions.SetCollation(titleCollation)
+	}
+	if opts.Summary {
+		findOptions.SetProjection(noteSummaryProjection)
+	}
+
+	cursor, err := collection.Find(ctx, query, findOptions)
+	if err != nil {
+		return NotePage{}, err
+	}
+	defer cursor.Close(ctx)
+
+	page := NotePage{Notes: []models.Note{}, Total: total}
+	if err := cursor.All(ctx, &page.Notes); err != nil {
+		return NotePage{}, err
+	}
+
+	if len(page.Notes) > opts.Limit {
+		page.Notes = page.Notes[:opts.Limit]
+		page.NextCursor = encodeNoteCursor(opts.Sort, opts.Ascending, page.Notes[opts.Limit-1])
+	}
+	return page, nil
+}
+
+func encodeNoteCursor(sort string, ascending bool, last models.Note) string {
+	position := noteCursor{Sort: sort, Ascending: ascending, Pinned: last.Pinned, ID: last.ID}
+	switch sort {
+	case NoteSortCreated:
+		position.Time = last.CreatedAt.UnixMilli()
+	case NoteSortUpdated:
+		position.Time = last.UpdatedAt.UnixMilli()
+	case NoteSortTitle:
+		position.Title = last.Title
+	}
+
+	encoded, _ := json.Marshal(position)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func decodeNoteCursor(cursor, sort string, ascending bool) (noteCursor, error) {
+	var position noteCursor
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return position, ErrInvalidNoteCursor
+	}
+	if err := json.Unmarshal(decoded, &position); err != nil {
+		return position, ErrInvalidNoteCursor
+	}
+	if position.Sort != sort || position.Ascending != ascending {
+		return position, ErrInvalidNoteCursor
+	}
+	return position, nil
+}
+
+// filter matches the notes that come after the cursor position.
+func (p noteCursor) filter(field string) bson.M {
+	var value interface{} = primitive.DateTime(p.Time)
+	if p.Sort == NoteSortTitle {
+		value = p.Title
+	}
+
+	op := "$lt"
+	if p.Ascending {
+		op = "$gt"
+	}
+	after := bson.A{
+		bson.M{field: bson.M{op: value}},
+		bson.M{field: value, "_id": bson.M{op: p.ID}},
+	}
+
+	// Unpinned notes have no pinned field and all come after the pinned ones.
+	unpinned := bson.M{"pinned": bson.M{"$ne": true}}
+	if !p.Pinned {
+		unpinned["$or"] = after
+		return unpinned
+	}
+	return bson.M{"$or": bson.A{
+		bson.M{"pinned": true, "$or": after},
+		unpinned,
+	}}
+}
+
+// SummarizeNotes turns notes listed with NoteListOptions.Summary or
+// ListTrashedNotes into their lightweight form.
+func SummarizeNotes(notes []models.Note) []models.NoteSummary {
+	summaries := make([]models.NoteSummary, len(notes))
+	for i, note := range notes {
+		summaries[i] = models.NoteSummary{
+			ID:         note.ID,
+			Title:      note.Title,
+			Snippet:    noteSnippet(note.Content),
+			Tags:       note.Tags,
+			NotebookID: note.NotebookID,
+			CreatedAt:  note.CreatedAt,
+			UpdatedAt:  note.UpdatedAt,
+			Version:    note.Version,
+			Pinned:     note.Pinned,
+			Archived:   note.Archived,
+			Favorite:   note.Favorite,
+			DeletedAt:  note.DeletedAt,
+		}
+	}
+	return summaries
+}
+
+// noteSnippet returns the start of content on one line, cut at a word and
+// ending in an ellipsis if content goes on.
+func noteSnippet(content string) string {
+	runes := []rune(strings.Join(strings.Fields(content), " "))
+	if len(runes) <= snippetLength {
+		return string(runes)
+	}
+
+	snippet := string(runes[:snippetLength])
+	if space := strings.LastIndex(snippet, " "); space > 0 {
+		snippet = snippet[:space]
+	}
+	return snippet + "…"
+}
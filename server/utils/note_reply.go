@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"encoding/json"
+	"log"
+	"server/models"
+	"strings"
+)
+
+// NoteEditsFence opens the block in which the AI lists its proposed edits.
+const NoteEditsFence = "```note-edits"
+
+// NoteReply is an AI answer about a note split into the text shown to the
+// user and the edits it proposes.
+type NoteReply struct {
+	Message   string
+	Edits     []models.NoteEdit
+	Preview   string
+	EditError string
+}
+
+// ParseNoteReply separates the trailing note-edits block from the answer and
+// checks that the edits apply to the note. Edits that do not apply are
+// dropped, since the client could not apply them either.
+func ParseNoteReply(note models.Note, text string) NoteReply {
+	index := strings.LastIndex(text, NoteEditsFence)
+	if index < 0 {
+		return NoteReply{Message: strings.TrimSpace(text)}
+	}
+
+	reply := NoteReply{Message: strings.TrimSpace(text[:index])}
+	block := strings.TrimPrefix(text[index:], NoteEditsFence)
+	if end := strings.Index(block, "```"); end >= 0 {
+		block = block[:end]
+	}
+
+	var edits []models.NoteEdit
+	if err := json.Unmarshal([]byte(strings.TrimSpace(block)), &edits); err != nil {
+		log.Printf("Failed to parse note edits: %v", err)
+		reply.EditError = "The AI proposed edits in an unreadable format"
+		return reply
+	}
+	if len(edits) == 0 {
+		return reply
+	}
+
+	preview, err := ApplyNoteEdits(note.Content, edits)
+	if err != nil {
+		log.Printf("AI proposed note edits that do not apply: %v", err)
+		reply.EditError = err.Error()
+		return reply
+	}
+
+	reply.Edits = edits
+	reply.Preview = preview
+	return reply
+}
+
+// NoteEditsFilter passes a streamed answer about a note through to the client
+// but holds back the note-edits block, whose edits are sent parsed in the done
+// event instead. Text that may be the start of the fence is held until the
+// next delta shows whether it is.
+type NoteEditsFilter struct {
+	held   string
+	fenced bool
+}
+
+// Write returns the part of the answer so far that can be shown, given the
+// next delta.
+func (f *NoteEditsFilter) Write(delta string) string {
+	if f.fenced {
+		return ""
+	}
+
+	text := f.held + delta
+	if index := strings.Index(text, NoteEditsFence); index >= 0 {
+		f.held = ""
+		f.fenced = true
+		return text[:index]
+	}
+
+	// The fence is ASCII, so a held suffix never splits a UTF-8 sequence.
+	held := 0
+	for n := min(len(text), len(NoteEditsFence)-1); n > 0; n-- {
+		if strings.HasSuffix(text, NoteEditsFence[:n]) {
+			held = n
+			break
+		}
+	}
+	f.held = text[len(text)-held:]
+	return text[:len(text)-held]
+}
+
+// Flush returns the text still held once the answer is complete.
+func (f *NoteEditsFilter) Flush() string {
+	held := f.held
+	f.held = ""
+	return held
+}
@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"server/models"
+)
+
+func TestNoteEditsFilterHoldsBackEdits(t *testing.T) {
+	tests := []struct {
+		name   string
+		deltas []string
+		want   string
+	}{
+		{
+			name:   "no edits",
+			deltas: []string{"Bread is ", "already on the list."},
+			want:   "Bread is already on the list.",
+		},
+		{
+			name:   "fence in one delta",
+			deltas: []string{"Added bread.\n", "```note-edits\n[{\"op\": \"append\"}]\n```"},
+			want:   "Added bread.\n",
+		},
+		{
+			name:   "fence split across two deltas",
+			deltas: []string{"Added bread.\n```note", "-edits\n[]\n```"},
+			want:   "Added bread.\n",
+		},
+		{
+			name:   "fence split across three deltas",
+			deltas: []string{"Added bread.\n``", "`note-", "edits\n[{\"op\": ", "\"append\"}]\n```"},
+			want:   "Added bread.\n",
+		},
+		{
+			name:   "no closing fence",
+			deltas: []string{"Added bread.\n```note-edits\n[{\"op\": \"app"},
+			want:   "Added bread.\n",
+		},
+		{
+			name:   "other code block",
+			deltas: []string{"Run ``", "`go test`", "``."},
+			want:   "Run ```go test```.",
+		},
+		{
+			name:   "answer ends in a possible fence start",
+			deltas: []string{"Use `x` or ", "```note"},
+			want:   "Use `x` or ```note",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var filter NoteEditsFilter
+			var shown strings.Builder
+			for _, delta := range tt.deltas {
+				shown.WriteString(filter.Write(delta))
+			}
+			shown.WriteString(filter.Flush())
+
+			if shown.String() != tt.want {
+				t.Errorf("shown = %q, want %q", shown.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNoteReply(t *testing.T) {
+	note := models.Note{Content: "# Groceries\n- milk"}
+	tests := []struct {
+		name        string
+		text        string
+		wantMessage string
+		wantPreview string
+		wantEdits   int
+		wantError   bool
+	}{
+		{
+			name:        "no edits",
+			text:        "  Milk is on the list.\n",
+			wantMessage: "Milk is on the list.",
+		},
+		{
+			name:        "edits",
+			text:        "Added bread.\n```note-edits\n[{\"op\": \"append_list_items\", \"heading\": \"Groceries\", \"items\": [\"bread\"]}]\n```\n",
+			wantMessage: "Added bread.",
+			wantPreview: "# Groceries\n- milk\n- bread",
+			wantEdits:   1,
+		},
+		{
+			name:        "no closing fence",
+			text:        "Added bread.\n```note-edits\n[{\"op\": \"append\", \"content\": \"bread\"}]",
+			wantMessage: "Added bread.",
+			wantPreview: "# Groceries\n- milk\n\nbread",
+			wantEdits:   1,
+		},
+		{
+			name:        "empty edit list",
+			text:        "Nothing to change.\n```note-edits\n[]\n```",
+			wantMessage: "Nothing to change.",
+		},
+		{
+			name:        "unreadable edits",
+			text:        "Added bread.\n```note-edits\nappend bread\n```",
+			wantMessage: "Added bread.",
+			wantError:   true,
+		},
+		{
+			name:        "edits that do not apply",
+			text:        "Added bread.\n```note-edits\n[{\"op\": \"append_list_items\", \"heading\": \"Bakery\", \"items\": [\"bread\"]}]\n```",
+			wantMessage: "Added bread.",
+			wantError:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply := ParseNoteReply(note, tt.text)
+			if reply.Message != tt.wantMessage {
+				t.Errorf("Message = %q, want %q", reply.Message, tt.wantMessage)
+			}
+			if reply.Preview != tt.wantPreview {
+				t.Errorf("Preview = %q, want %q", reply.Preview, tt.wantPreview)
+			}
+			if len(reply.Edits) != tt.wantEdits {
+				t.Errorf("got %d edits, want %d", len(reply.Edits), tt.wantEdits)
+			}
+			if (reply.EditError != "") != tt.wantError {
+				t.Errorf("EditError = %q, want an error: %v", reply.EditError, tt.wantError)
+			}
+		})
+	}
+}
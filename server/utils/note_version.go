@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"server/models"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// NoteVersionConflictError reports a note write that was based on a version
+// other than the note's current one. Current is the note as it is now.
+type NoteVersionConflictError struct {
+	Expected int64
+	Current  models.Note
+}
+
+func (e *NoteVersionConflictError) Error() string {
+	return fmt.Sprintf("The note was changed elsewhere: it is at version %d, not %d. Reload it and try again.",
+		e.Current.Version, e.Expected)
+}
+
+// NoteETag is the entity tag of a note at version.
+func NoteETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// IfMatchAllows reports whether an If-Match header value permits writing to
+// a note at version. An empty header or "*" allows any version. Weak tags
+// are compared by their value.
+func IfMatchAllows(header string, version int64) bool {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return true
+	}
+
+	want := NoteETag(version)
+	for _, tag := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == want {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckNoteVersion returns a *NoteVersionConflictError unless note matches
+// both the If-Match header and the version the client says it edited, when
+// either is given.
+func CheckNoteVersion(note models.Note, ifMatch string, expected *int64) error {
+	if expected != nil && *expected != note.Version {
+		return &NoteVersionConflictError{Expected: *expected, Current: note}
+	}
+	if !IfMatchAllows(ifMatch, note.Version) {
+		tag := strings.Trim(strings.TrimPrefix(strings.TrimSpace(ifMatch), "W/"), `"`)
+		claimed, _ := strconv.ParseInt(tag, 10, 64)
+		return &NoteVersionConflictError{Expected: claimed, Current: note}
+	}
+	return nil
+}
+
+// noteVersionFilter narrows filter to notes still at version. Notes written
+// before versioning have no version field and count as version 0.
+func noteVersionFilter(filter bson.M, version int64) bson.M {
+	if version == 0 {
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	} else {
+		filter["version"] = version
+	}
+	return filter
+}
+
+// UpdateNoteAtVersion sets fields on note only while it is still at the
+// version it was read at, bumps the version and returns the updated note.
+// If another write got there first the result is a
+// *NoteVersionConflictError carrying the current note, and if the note is
+// gone or was moved to the trash it is mongo.ErrNoDocuments.
+//
+// A write that would leave the title and content as they are and sets
+// nothing else but updatedAt is skipped, and note is returned at its version,
+// so that a no-op edit neither makes other clients' If-Match fail nor adds to
+// the history.
+func UpdateNoteAtVersion(ctx context.Context, db *mongo.Database, note models.Note, fields bson.M) (*models.Note, error) {
+	if !changesNote(note, fields) {
+		return &note, nil
+	}
+	return updateNoteAtVersion(ctx, db, note, bson.M{"$set": fields})
+}
+
+// changesNote reports whether setting fields would change note.
+func changesNote(note models.Note, fields bson.M) bool {
+	for field, value := range fields {
+		switch field {
+		case "updatedAt":
+		case "title":
+			if value != note.Title {
+				return true
+			}
+		case "content":
+			if value != note.Content {
+				return true
+			}
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// SetNoteFlag turns one of the note's flags (pinned, archived, favorite) on
+// or off and returns the updated note. Flags are not part of the note's
+// version: changing one neither checks nor bumps it, so that toggling a flag
+// never makes a concurrent content edit fail. A flag that is off is removed
+// rather than stored as false, so that sorting by it only sees set and unset.
+func SetNoteFlag(ctx context.Context, db *mongo.Database, note models.Note, flag string, on bool) (*models.Note, error) {
+	update := bson.M{"$unset": bson.M{flag: ""}}
+	if on {
+		update = bson.M{"$set": bson.M{flag: true}}
+	}
+
+	var updated models.Note
+	err := db.Collection("notes").FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": note.ID, "userId": note.UserID, "deletedAt": nil},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func updateNoteAtVersion(ctx context.Context, db *mongo.Database, note models.Note, update bson.M) (*models.Note, error) {
+	collection := db.Collection("notes")
+	// A note trashed while the write was in progress is not written to,
+	// whatever its version.
+	owned := bson.M{"_id": note.ID, "userId": note.UserID, "deletedAt": nil}
+	update["$inc"] = bson.M{"version": 1}
+
+	var updated models.Note
+	err := collection.FindOneAndUpdate(
+		ctx,
+		noteVersionFilter(bson.M{"_id": note.ID, "userId": note.UserID, "deletedAt": nil}, note.Version),
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err == nil {
+		return &updated, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	var current models.Note
+	if err := collection.FindOne(ctx, owned).Decode(&current); err != nil {
+		return nil, err
+	}
+	return nil, &NoteVersionConflictError{Expected: note.Version, Current: current}
+}
@@ -0,0 +1,264 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"server/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	MaxNotebookDepth      = 10
+	MaxNotebookNameLength = 100
+)
+
+var (
+	ErrNotebookCycle    = errors.New("a notebook cannot be moved into itself or one of its own notebooks")
+	ErrNotebookTooDeep  = fmt.Errorf("notebooks can be nested at most %d levels deep", MaxNotebookDepth)
+	ErrNotebookNotFound = errors.New("notebook not found")
+)
+
+// NotebookDeleteResult reports what deleting a notebook did to its contents.
+type NotebookDeleteResult struct {
+	Mode             string `json:"mode"`
+	NotebooksDeleted int64  `json:"notebooksDeleted"`
+	NotebooksMoved   int64  `json:"notebooksMoved"`
+	NotesMoved       int64  `json:"notesMoved"`
+	NotesTrashed     int64  `json:"notesTrashed"`
+}
+
+// ListUserNotebooks returns all of the user's notebooks sorted by name.
+// Whole trees are small, so hierarchy checks work on this list in memory.
+func ListUserNotebooks(ctx context.Context, db *mongo.Database, userID primitive.ObjectID) ([]models.Notebook, error) {
+	cursor, err := db.Collection("notebooks").Find(
+		ctx,
+		bson.M{"userId": userID},
+		options.Find().SetSort(bson.M{"name": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	notebooks := []models.Notebook{}
+	if err := cursor.All(ctx, &notebooks); err != nil {
+		return nil, err
+	}
+	return notebooks, nil
+}
+
+// CountNotesByNotebook returns how many of the user's notes are filed
+// directly in each notebook, leaving out notes in the trash.
+func CountNotesByNotebook(ctx context.Context, db *mongo.Database, userID primitive.ObjectID) (map[primitive.ObjectID]int, error) {
+	cursor, err := db.Collection("notes").Aggregate(ctx, bson.A{
+		bson.M{"$match": bson.M{"userId": userID, "notebookId": bson.M{"$ne": nil}, "deletedAt": nil}},
+		bson.M{"$group": bson.M{"_id": "$notebookId", "count": bson.M{"$sum": 1}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		ID    primitive.ObjectID `bson:"_id"`
+		Count int                `bson:"count"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[primitive.ObjectID]int, len(rows))
+	for _, row := range rows {
+		counts[row.ID] = row.Count
+	}
+	return counts, nil
+}
+
+// NotebookTree nests notebooks under their parents. Notebooks whose parent
+// is missing are shown at the top level rather than lost.
+func NotebookTree(notebooks []models.Notebook, noteCounts map[primitive.ObjectID]int) []models.NotebookNode {
+	known := make(map[primitive.ObjectID]bool, len(notebooks))
+	children := map[primitive.ObjectID][]models.Notebook{}
+	for _, notebook := range notebooks {
+		known[notebook.ID] = true
+	}
+
+	var roots []models.Notebook
+	for _, notebook := range notebooks {
+		if notebook.ParentID == nil || !known[*notebook.ParentID] {
+			roots = append(roots, notebook)
+		} else {
+			children[*notebook.ParentID] = append(children[*notebook.ParentID], notebook)
+		}
+	}
+
+	var build func([]models.Notebook) []models.NotebookNode
+	build = func(level []models.Notebook) []models.NotebookNode {
+		nodes := make([]models.NotebookNode, 0, len(level))
+		for _, notebook := range level {
+			nodes = append(nodes, models.NotebookNode{
+				Notebook:  notebook,
+				NoteCount: noteCounts[notebook.ID],
+				Children:  build(children[notebook.ID]),
+			})
+		}
+		return nodes
+	}
+	return build(roots)
+}
+
+// NotebookSubtree returns id and the IDs of every notebook nested below it.
+func NotebookSubtree(notebooks []models.Notebook, id primitive.ObjectID) []primitive.ObjectID {
+	subtree := []primitive.ObjectID{id}
+	for i := 0; i < len(subtree); i++ {
+		for _, notebook := range notebooks {
+			if notebook.ParentID != nil && *notebook.ParentID == subtree[i] {
+				subtree = append(subtree, notebook.ID)
+			}
+		}
+	}
+	return subtree
+}
+
+// notebookDepth is 1 for a top-level notebook, 2 for one inside it and so on.
+func notebookDepth(notebooks []models.Notebook, id primitive.ObjectID) int {
+	byID := make(map[primitive.ObjectID]models.Notebook, len(notebooks))
+	for _, notebook := range notebooks {
+		byID[notebook.ID] = notebook
+	}
+
+	// The length bound only matters if the stored tree has a cycle.
+	depth := 0
+	for current, ok := byID[id]; ok; current, ok = byID[*current.ParentID] {
+		depth++
+		if current.ParentID == nil || depth > len(notebooks) {
+			break
+		}
+	}
+	return depth
+}
+
+// subtreeHeight is 1 for a notebook without children.
+func subtreeHeight(notebooks []models.Notebook, id primitive.ObjectID) int {
+	height := 1
+	for _, notebook := range notebooks {
+		if notebook.ParentID != nil && *notebook.ParentID == id && notebook.ID != id {
+			height = max(height, 1+subtreeHeight(notebooks, notebook.ID))
+		}
+	}
+	return height
+}
+
+// ValidateNotebookParent checks that the notebook id (nil for a new one) can
+// be placed under parentID (nil for the top level) without creating a cycle
+// or nesting deeper than MaxNotebookDepth.
+func ValidateNotebookParent(notebooks []models.Notebook, id, parentID *primitive.ObjectID) error {
+	if parentID == nil {
+		if id != nil && subtreeHeight(notebooks, *id) > MaxNotebookDepth {
+			return ErrNotebookTooDeep
+		}
+		return nil
+	}
+
+	found := false
+	for _, notebook := range notebooks {
+		if notebook.ID == *parentID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return ErrNotebookNotFound
+	}
+
+	height := 1
+	if id != nil {
+		for _, descendant := range NotebookSubtree(notebooks, *id) {
+			if descendant == *parentID {
+				return ErrNotebookCycle
+			}
+		}
+		height = subtreeHeight(notebooks, *id)
+	}
+
+	if notebookDepth(notebooks, *parentID)+height > MaxNotebookDepth {
+		return ErrNotebookTooDeep
+	}
+	return nil
+}
+
+// DeleteNotebook removes notebook. In NotebookDeleteMove mode its notes and
+// child notebooks move up to its parent; in NotebookDeleteCascade mode its
+// whole subtree is deleted and its notes are moved to the trash. Notes that
+// move get a new version.
+func DeleteNotebook(ctx context.Context, db *mongo.Database, notebook models.Notebook, mode string, notebooks []models.Notebook) (*NotebookDeleteResult, error) {
+	result := &NotebookDeleteResult{Mode: mode}
+
+	switch mode {
+	case models.NotebookDeleteMove:
+		moved, err := db.Collection("notebooks").UpdateMany(ctx,
+			bson.M{"userId": notebook.UserID, "parentId": notebook.ID},
+			bson.M{"$set": bson.M{"parentId": notebook.ParentID, "updatedAt": time.Now()}},
+		)
+		if err != nil {
+			return nil, err
+		}
+		result.NotebooksMoved = moved.ModifiedCount
+
+		notes, err := db.Collection("notes").UpdateMany(ctx,
+			bson.M{"userId": notebook.UserID, "notebookId": notebook.ID},
+			bson.M{"$set": bson.M{"notebookId": notebook.ParentID}, "$inc": bson.M{"version": 1}},
+		)
+		if err != nil {
+			return nil, err
+		}
+		result.NotesMoved = notes.ModifiedCount
+
+		deleted, err := db.Collection("notebooks").DeleteOne(ctx, bson.M{"_id": notebook.ID, "userId": notebook.UserID})
+		if err != nil {
+			return nil, err
+		}
+		result.NotebooksDeleted = deleted.DeletedCount
+
+	case models.NotebookDeleteCascade:
+		subtree := NotebookSubtree(notebooks, notebook.ID)
+
+		cursor, err := db.Collection("notes").Find(ctx,
+			bson.M{"userId": notebook.UserID, "notebookId": bson.M{"$in": subtree}},
+			options.Find().SetProjection(bson.M{"_id": 1}),
+		)
+		if err != nil {
+			return nil, err
+		}
+		var notes []models.Note
+		if err := cursor.All(ctx, &notes); err != nil {
+			return nil, err
+		}
+		noteIDs := make([]primitive.ObjectID, len(notes))
+		for i, note := range notes {
+			noteIDs[i] = note.ID
+		}
+
+		result.NotesTrashed, err = TrashUserNotes(ctx, db, notebook.UserID, noteIDs)
+		if err != nil {
+			return nil, err
+		}
+
+		deleted, err := db.Collection("notebooks").DeleteMany(ctx, bson.M{"_id": bson.M{"$in": subtree}, "userId": notebook.UserID})
+		if err != nil {
+			return nil, err
+		}
+		result.NotebooksDeleted = deleted.DeletedCount
+
+	default:
+		return nil, fmt.Errorf("unknown notebook delete mode %q", mode)
+	}
+
+	return result, nil
+}
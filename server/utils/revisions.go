@@ -0,0 +1,149 @@
+package utils
+
+import (
+	"context"
+	"server/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// revisionAttempts is how many times RecordNoteRevision tries to number a
+// revision before giving up on concurrent writers to the same note.
+const revisionAttempts = 5
+
+// RecordNoteRevision stores after as the note's newest revision. revision
+// supplies the source and author; the rest is filled in from after. When the
+// note has no history yet and before is given, before is stored first as its
+// original state so that the change can be undone. A change that leaves
+// before's title and content as they were records nothing and returns nil,
+// since revisions only hold those.
+//
+// Revisions are numbered one past the latest. The unique noteId_number index
+// rejects a number that a concurrent write took first, and the revision is
+// then numbered again.
+func RecordNoteRevision(ctx context.Context, db *mongo.Database, before *models.Note, after models.Note, revision models.NoteRevision) (*models.NoteRevision, error) {
+	if before != nil && before.Title == after.Title && before.Content == after.Content {
+		return nil, nil
+	}
+
+	for attempt := 1; ; attempt++ {
+		recorded, err := insertNoteRevision(ctx, db, before, after, revision)
+		if err == nil || !mongo.IsDuplicateKeyError(err) || attempt == revisionAttempts {
+			return recorded, err
+		}
+	}
+}
+
+func insertNoteRevision(ctx context.Context, db *mongo.Database, before *models.Note, after models.Note, revision models.NoteRevision) (*models.NoteRevision, error) {
+	collection := db.Collection("note_revisions")
+
+	number, err := latestRevisionNumber(ctx, db, after.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if number == 0 && before != nil {
+		original := models.NoteRevision{
+			NoteID:      before.ID,
+			UserID:      before.UserID,
+			Number:      1,
+			Title:       before.Title,
+			Content:     before.Content,
+			Source:      models.RevisionSourceOriginal,
+			NoteVersion: before.Version,
+			CreatedAt:   before.UpdatedAt,
+		}
+		if _, err := collection.InsertOne(ctx, original); err != nil {
+			return nil, err
+		}
+		number = 1
+	}
+
+	revision.NoteID = after.ID
+	revision.UserID = after.UserID
+	revision.Number = number + 1
+	revision.Title = after.Title
+	revision.Content = after.Content
+	revision.NoteVersion = after.Version
+	if revision.CreatedAt.IsZero() {
+		revision.CreatedAt = time.Now()
+	}
+
+	result, err := collection.InsertOne(ctx, revision)
+	if err != nil {
+		return nil, err
+	}
+	revision.ID = result.InsertedID.(primitive.ObjectID)
+	return &revision, nil
+}
+
+func latestRevisionNumber(ctx context.Context, db *mongo.Database, noteID primitive.ObjectID) (int, error) {
+	var latest models.NoteRevision
+	err := db.Collection("note_revisions").FindOne(
+		ctx,
+		bson.M{"noteId": noteID},
+		options.FindOne().SetSort(bson.M{"number": -1}).SetProjection(bson.M{"number": 1}),
+	).Decode(&latest)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return latest.Number, nil
+}
+
+// GetNoteRevision returns one revision of a note, or mongo.ErrNoDocuments.
+// A number of 0 selects the latest revision.
+func GetNoteRevision(ctx context.Context, db *mongo.Database, noteID primitive.ObjectID, number int) (*models.NoteRevision, error) {
+	filter := bson.M{"noteId": noteID}
+	findOptions := options.FindOne()
+	if number > 0 {
+		filter["number"] = number
+	} else {
+		findOptions.SetSort(bson.M{"number": -1})
+	}
+
+	var revision models.NoteRevision
+	if err := db.Collection("note_revisions").FindOne(ctx, filter, findOptions).Decode(&revision); err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
+
+// ListNoteRevisions returns up to limit revisions of a note, newest first,
+// without their content. before, when positive, only returns revisions with
+// a lower number, for paging.
+func ListNoteRevisions(ctx context.Context, db *mongo.Database, noteID primitive.ObjectID, before, limit int) ([]models.NoteRevision, error) {
+	filter := bson.M{"noteId": noteID}
+	if before > 0 {
+		filter["number"] = bson.M{"$lt": before}
+	}
+
+	findOptions := options.Find().
+		SetSort(bson.M{"number": -1}).
+		SetLimit(int64(limit)).
+		SetProjection(bson.M{"content": 0})
+
+	cursor, err := db.Collection("note_revisions").Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	revisions := []models.NoteRevision{}
+	if err := cursor.All(ctx, &revisions); err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+// DeleteNoteRevisions removes the whole history of a note.
+func DeleteNoteRevisions(ctx context.Context, db *mongo.Database, noteID primitive.ObjectID) error {
+	_, err := db.Collection("note_revisions").DeleteMany(ctx, bson.M{"noteId": noteID})
+	return err
+}
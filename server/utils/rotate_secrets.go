@@ -0,0 +1,110 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// userKeyFields are the user document fields holding sealed provider keys.
+var userKeyFields = []string{"openaiKey", "geminiKey", "claudeKey"}
+
+// RotationStats summarises a RotateUserSecrets run.
+type RotationStats struct {
+	Users    int
+	Resealed int
+	Current  int
+	Conflict int
+	Failed   int
+}
+
+// RotateUserSecrets moves every stored provider and endpoint key under the
+// keyring's active master key, sealing any value that is still plaintext.
+// Each value is swapped with a compare-and-set on its old value, so a key the
+// user changes mid-run is left alone (it was sealed under the active key by
+// the server anyway) and the run can be repeated safely.
+func RotateUserSecrets(ctx context.Context, db *mongo.Database, ring *Keyring, dryRun bool) (RotationStats, error) {
+	var stats RotationStats
+	collection := db.Collection("users")
+
+	projection := bson.M{"customEndpoints.id": 1, "customEndpoints.apiKey": 1}
+	for _, field := range userKeyFields {
+		projection[field] = 1
+	}
+
+	cursor, err := collection.Find(ctx, bson.M{}, options.Find().SetProjection(projection))
+	if err != nil {
+		return stats, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID              primitive.ObjectID `bson:"_id"`
+			Keys            bson.M             `bson:",inline"`
+			CustomEndpoints []struct {
+				ID     string `bson:"id"`
+				APIKey string `bson:"apiKey"`
+			} `bson:"customEndpoints"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return stats, err
+		}
+		stats.Users++
+
+		for _, field := range userKeyFields {
+			value, _ := doc.Keys[field].(string)
+			filter := bson.M{"_id": doc.ID, field: value}
+			rotateSecret(ctx, collection, ring, &stats, dryRun, value, filter, field,
+				fmt.Sprintf("user %s %s", doc.ID.Hex(), field))
+		}
+
+		for _, endpoint := range doc.CustomEndpoints {
+			filter := bson.M{
+				"_id":             doc.ID,
+				"customEndpoints": bson.M{"$elemMatch": bson.M{"id": endpoint.ID, "apiKey": endpoint.APIKey}},
+			}
+			rotateSecret(ctx, collection, ring, &stats, dryRun, endpoint.APIKey, filter, "customEndpoints.$.apiKey",
+				fmt.Sprintf("user %s endpoint %s", doc.ID.Hex(), endpoint.ID))
+		}
+	}
+	return stats, cursor.Err()
+}
+
+func rotateSecret(ctx context.Context, collection *mongo.Collection, ring *Keyring, stats *RotationStats, dryRun bool, value string, filter bson.M, field, label string) {
+	if value == "" {
+		return
+	}
+
+	resealed, changed, err := ring.Reseal(value)
+	if err != nil {
+		log.Printf("Failed to reseal %s: %v", label, err)
+		stats.Failed++
+		return
+	}
+	if !changed {
+		stats.Current++
+		return
+	}
+	if dryRun {
+		stats.Resealed++
+		return
+	}
+
+	result, err := collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{field: resealed}})
+	if err != nil {
+		log.Printf("Failed to store resealed %s: %v", label, err)
+		stats.Failed++
+		return
+	}
+	if result.MatchedCount == 0 {
+		stats.Conflict++
+		return
+	}
+	stats.Resealed++
+}
@@ -0,0 +1,514 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"regexp"
+	"server/models"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	DefaultSearchLimit   = 20
+	MaxSearchLimit       = 50
+	MaxSearchQueryLength = 200
+
+	// searchCandidates bounds how many of the newest matches a search
+	// without whole words ranks in memory, since only text searches are
+	// ranked by MongoDB.
+	searchCandidates = 200
+	// Snippets are about snippetLength characters long and start up to
+	// snippetLead characters before the first match.
+	snippetLength = 160
+	snippetLead   = 40
+
+	// wordStart matches the start of the text or a character that cannot be
+	// part of a word, so that prefixes only match at the start of words.
+	wordStart = `(?:^|[^\p{L}\p{N}_])`
+)
+
+var ErrEmptySearchQuery = errors.New("search query must contain at least one word")
+
+// SearchQuery is a parsed search string. It holds plain words, "quoted
+// phrases", prefix* words and -excluded words.
+type SearchQuery struct {
+	Terms    []string
+	Phrases  []string
+	Prefixes []string
+	Excluded []string
+}
+
+// SearchOptions selects what Search looks through.
+type SearchOptions struct {
+	Query SearchQuery
+	Notes bool
+	Chats bool
+	// From and To bound the creation time; To is exclusive.
+	From *time.Time
+	To   *time.Time
+	// Tag limits notes to those carrying it and must already be normalized.
+	Tag   string
+	Limit int
+}
+
+// ParseSearchQuery splits q into words, phrases, prefixes and excluded
+// words. An unterminated quote runs to the end of q.
+func ParseSearchQuery(q string) (SearchQuery, error) {
+	var query SearchQuery
+	if utf8.RuneCountInString(q) > MaxSearchQueryLength {
+		return query, fmt.Errorf("search query is longer than %d characters", MaxSearchQueryLength)
+	}
+
+	for {
+		q = strings.TrimLeftFunc(q, unicode.IsSpace)
+		if q == "" {
+			break
+		}
+
+		if q[0] == '"' {
+			var phrase string
+			if end := strings.IndexByte(q[1:], '"'); end >= 0 {
+				phrase, q = q[1:end+1], q[end+2:]
+			} else {
+				phrase, q = q[1:], ""
+			}
+			if phrase = strings.Join(strings.Fields(phrase), " "); phrase != "" {
+				query.Phrases = append(query.Phrases, phrase)
+			}
+			continue
+		}
+
+		end := strings.IndexFunc(q, unicode.IsSpace)
+		if end < 0 {
+			end = len(q)
+		}
+		token := strings.ReplaceAll(q[:end], `"`, "")
+		q = q[end:]
+
+		switch {
+		case strings.HasPrefix(token, "-"):
+			if word := strings.TrimLeft(token, "-"); word != "" {
+				query.Excluded = append(query.Excluded, word)
+			}
+		case strings.HasSuffix(token, "*"):
+			if prefix := strings.TrimRight(token, "*"); prefix != "" {
+				query.Prefixes = append(query.Prefixes, prefix)
+			}
+		case token != "":
+			query.Terms = append(query.Terms, token)
+		}
+	}
+
+	if len(query.Terms)+len(query.Phrases)+len(query.Prefixes) == 0 {
+		return query, ErrEmptySearchQuery
+	}
+	return query, nil
+}
+
+// textSearch is the $search string for the query's words and phrases, or ""
+// if it has none.
+func (q SearchQuery) textSearch() string {
+	if len(q.Terms)+len(q.Phrases) == 0 {
+		return ""
+	}
+	parts := append([]string{}, q.Terms...)
+	for _, phrase := range q.Phrases {
+		parts = append(parts, `"`+phrase+`"`)
+	}
+	for _, word := range q.Excluded {
+		parts = append(parts, "-"+word)
+	}
+	return strings.Join(parts, " ")
+}
+
+// filter matches the query against fields. Words and phrases use the text
+// index; every prefix must also start a word in one of the fields.
+func (q SearchQuery) filter(fields ...string) bson.M {
+	filter := bson.M{}
+	if search := q.textSearch(); search != "" {
+		filter["$text"] = bson.M{"$search": search}
+	} else if len(q.Excluded) > 0 {
+		var excluded bson.A
+		for _, word := range q.Excluded {
+			excluded = append(excluded, matchAnyField(wordStart+regexp.QuoteMeta(word)+`(?:$|[^\p{L}\p{N}_])`, fields)...)
+		}
+		filter["$nor"] = excluded
+	}
+
+	var prefixes bson.A
+	for _, prefix := range q.Prefixes {
+		prefixes = append(prefixes, bson.M{"$or": matchAnyField(wordStart+regexp.QuoteMeta(prefix), fields)})
+	}
+	if len(prefixes) > 0 {
+		filter["$and"] = prefixes
+	}
+	return filter
+}
+
+func matchAnyField(pattern string, fields []string) bson.A {
+	conditions := bson.A{}
+	for _, field := range fields {
+		conditions = append(conditions, bson.M{field: primitive.Regex{Pattern: pattern, Options: "i"}})
+	}
+	return conditions
+}
+
+// highlighter matches what the query searched for in result text. Words
+// also match longer words they start, which covers most of what the text
+// index's stemming matches.
+func (q SearchQuery) highlighter() *regexp.Regexp {
+	var alternatives []string
+	for _, phrase := range q.Phrases {
+		words := strings.Fields(phrase)
+		for i, word := range words {
+			words[i] = regexp.QuoteMeta(word)
+		}
+		alternatives = append(alternatives, strings.Join(words, `\s+`))
+	}
+	for _, word := range append(append([]string{}, q.Terms...), q.Prefixes...) {
+		alternatives = append(alternatives, regexp.QuoteMeta(word)+`[\p{L}\p{N}_]*`)
+	}
+	// Prefer the longest alternative where several match.
+	sort.SliceStable(alternatives, func(i, j int) bool {
+		return len(alternatives[i]) > len(alternatives[j])
+	})
+	return regexp.MustCompile(`(?i)` + wordStart + `(` + strings.Join(alternatives, "|") + `)`)
+}
+
+// highlightMatches returns the byte ranges of the highlighter's matches.
+func highlightMatches(highlighter *regexp.Regexp, text string) [][2]int {
+	var matches [][2]int
+	for _, match := range highlighter.FindAllStringSubmatchIndex(text, -1) {
+		matches = append(matches, [2]int{match[2], match[3]})
+	}
+	return matches
+}
+
+// HighlightSnippet returns an excerpt of text around the first match with
+// every match wrapped in <mark></mark>. The rest of the excerpt is HTML
+// escaped, and whitespace is collapsed.
+func HighlightSnippet(text string, highlighter *regexp.Regexp) string {
+	text = strings.Join(strings.Fields(text), " ")
+	matches := highlightMatches(highlighter, text)
+
+	start, firstMatchEnd := 0, 0
+	if len(matches) > 0 {
+		start, firstMatchEnd = matches[0][0], matches[0][1]
+		for n := 0; n < snippetLead && start > 0; n++ {
+			_, size := utf8.DecodeLastRuneInString(text[:start])
+			start -= size
+		}
+		// Start at a whole word.
+		if start > 0 {
+			if i := strings.IndexByte(text[start:matches[0][0]], ' '); i >= 0 {
+				start += i + 1
+			}
+		}
+	}
+
+	end := start
+	for n := 0; n < snippetLength && end < len(text); n++ {
+		_, size := utf8.DecodeRuneInString(text[end:])
+		end += size
+	}
+	end = max(end, firstMatchEnd)
+	// End at a whole word.
+	if end < len(text) {
+		if i := strings.LastIndexByte(text[start:end], ' '); i > 0 && start+i >= firstMatchEnd {
+			end = start + i
+		}
+	}
+
+	var snippet strings.Builder
+	if start > 0 {
+		snippet.WriteString("…")
+	}
+	pos := start
+	for _, match := range matches {
+		if match[0] >= end {
+			break
+		}
+		matchEnd := min(match[1], end)
+		snippet.WriteString(html.EscapeString(text[pos:match[0]]))
+		snippet.WriteString("<mark>")
+		snippet.WriteString(html.EscapeString(text[match[0]:matchEnd]))
+		snippet.WriteString("</mark>")
+		pos = matchEnd
+	}
+	snippet.WriteString(html.EscapeString(text[pos:end]))
+	if end < len(text) {
+		snippet.WriteString("…")
+	}
+	return snippet.String()
+}
+
+// matchScore ranks results of searches that MongoDB did not rank: each match
+// counts once, and matches in the title three times.
+func matchScore(highlighter *regexp.Regexp, title, content string) float64 {
+	return float64(3*len(highlightMatches(highlighter, title)) + len(highlightMatches(highlighter, content)))
+}
+
+func (o SearchOptions) createdAtFilter() bson.M {
+	createdAt := bson.M{}
+	if o.From != nil {
+		createdAt["$gte"] = *o.From
+	}
+	if o.To != nil {
+		createdAt["$lt"] = *o.To
+	}
+	if len(createdAt) == 0 {
+		return nil
+	}
+	return createdAt
+}
+
+// findRanked runs filter and decodes the matches into results. Text searches
+// come back best first with their text score as "score". Other searches come
+// back newest first, for the caller to rank.
+func findRanked(ctx context.Context, collection *mongo.Collection, filter bson.M, limit int, results interface{}) error {
+	opts := options.Find()
+	if _, ok := filter["$text"]; ok {
+		opts.SetProjection(bson.M{"score": bson.M{"$meta": "textScore"}}).
+			SetSort(bson.D{{Key: "score", Value: bson.M{"$meta": "textScore"}}}).
+			SetLimit(int64(limit))
+	} else {
+		opts.SetSort(bson.M{"createdAt": -1}).SetLimit(searchCandidates)
+	}
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	return cursor.All(ctx, results)
+}
+
+// normalizeScores scales the scores of results from one source so that the
+// best is 1. Text scores depend on the indexed fields and their weights, so
+// notes and chat messages are only comparable once each is scaled.
+func normalizeScores(results []models.SearchResult) {
+	best := 0.0
+	for _, result := range results {
+		best = max(best, result.Score)
+	}
+	if best == 0 {
+		return
+	}
+	for i := range results {
+		results[i].Score /= best
+	}
+}
+
+// Search looks through the user's notes and chat messages and returns the
+// best matches first.
+func Search(ctx context.Context, db *mongo.Database, user models.User, opts SearchOptions) ([]models.SearchResult, error) {
+	results := []models.SearchResult{}
+
+	if opts.Notes {
+		notes, err := searchNotes(ctx, db, user.ID, opts)
+		if err != nil {
+			return nil, err
+		}
+		normalizeScores(notes)
+		results = append(results, notes...)
+	}
+
+	if opts.Chats {
+		messages, err := searchChatMessages(ctx, db, user.ClerkID, opts)
+		if err != nil {
+			return nil, err
+		}
+		normalizeScores(messages)
+		results = append(results, messages...)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].CreatedAt.After(results[j].CreatedAt)
+	})
+	if len(results) > opts.Limit {
+		results = results[:opts.Limit]
+	}
+	return results, nil
+}
+
+func searchNotes(ctx context.Context, db *mongo.Database, userID primitive.ObjectID, opts SearchOptions) ([]models.SearchResult, error) {
+	filter := opts.Query.filter("title", "content")
+	filter["userId"] = userID
+	filter["deletedAt"] = nil
+	if opts.Tag != "" {
+		filter["tags"] = opts.Tag
+	}
+	if createdAt := opts.createdAtFilter(); createdAt != nil {
+		filter["createdAt"] = createdAt
+	}
+
+	var notes []struct {
+		models.Note `bson:",inline"`
+		Score       float64 `bson:"score"`
+	}
+	if err := findRanked(ctx, db.Collection("notes"), filter, opts.Limit, &notes); err != nil {
+		return nil, err
+	}
+
+	highlighter := opts.Query.highlighter()
+	_, ranked := filter["$text"]
+	results := make([]models.SearchResult, 0, len(notes))
+	for _, note := range notes {
+		score := note.Score
+		if !ranked {
+			score = matchScore(highlighter, note.Title, note.Content)
+		}
+		results = append(results, models.SearchResult{
+			Type:      models.SearchResultNote,
+			ID:        note.ID,
+			Title:     note.Title,
+			Snippet:   HighlightSnippet(note.Content, highlighter),
+			Score:     score,
+			Tags:      note.Tags,
+			CreatedAt: note.CreatedAt,
+		})
+	}
+	return results, nil
+}
+
+func searchChatMessages(ctx context.Context, db *mongo.Database, clerkID string, opts SearchOptions) ([]models.SearchResult, error) {
+	filter := opts.Query.filter("content")
+	filter["clerkId"] = clerkID
+	filter["deletedAt"] = nil
+	if createdAt := opts.createdAtFilter(); createdAt != nil {
+		filter["createdAt"] = createdAt
+	}
+
+	var messages []struct {
+		models.ChatMessage `bson:",inline"`
+		Score              float64 `bson:"score"`
+	}
+	if err := findRanked(ctx, db.Collection("chat_messages"), filter, opts.Limit, &messages); err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, nil
+	}
+
+	sessionIDs := make([]string, len(messages))
+	for i, message := range messages {
+		sessionIDs[i] = message.SessionID
+	}
+	titles, err := chatSessionTitles(ctx, db, clerkID, sessionIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	highlighter := opts.Query.highlighter()
+	_, ranked := filter["$text"]
+	results := make([]models.SearchResult, 0, len(messages))
+	for _, message := range messages {
+		score := message.Score
+		if !ranked {
+			score = matchScore(highlighter, "", message.Content)
+		}
+		results = append(results, models.SearchResult{
+			Type:      models.SearchResultChat,
+			ID:        message.ID,
+			Title:     titles[message.SessionID],
+			Snippet:   HighlightSnippet(message.Content, highlighter),
+			Score:     score,
+			SessionID: message.SessionID,
+			Role:      message.Role,
+			CreatedAt: message.CreatedAt,
+		})
+	}
+	return results, nil
+}
+
+// chatSessionTitles maps each of the user's sessions in sessionIDs to its
+// title.
+func chatSessionTitles(ctx context.Context, db *mongo.Database, clerkID string, sessionIDs []string) (map[string]string, error) {
+	cursor, err := db.Collection("chat_sessions").Find(
+		ctx,
+		bson.M{"clerkId": clerkID, "sessionId": bson.M{"$in": sessionIDs}},
+		options.Find().SetProjection(bson.M{"sessionId": 1, "title": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var sessions []models.ChatSession
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+
+	titles := make(map[string]string, len(sessions))
+	for _, session := range sessions {
+		titles[session.SessionID] = session.Title
+	}
+	return titles, nil
+}
+
+// maxKeywordTerms bounds how many words of a question KeywordNoteChunks
+// searches for.
+const maxKeywordTerms = 32
+
+// KeywordNoteChunks is the full-text counterpart of RankNoteChunks, for
+// users without an embedding provider. It finds the notes best matching the
+// words of text and, for each, the chunk with the most matches.
+func KeywordNoteChunks(ctx context.Context, db *mongo.Database, userID primitive.ObjectID, text string, limit int) ([]models.SemanticSearchResult, error) {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(words) == 0 {
+		return []models.SemanticSearchResult{}, nil
+	}
+	query := SearchQuery{Terms: words[:min(len(words), maxKeywordTerms)]}
+
+	filter := query.filter("title", "content")
+	filter["userId"] = userID
+	filter["deletedAt"] = nil
+
+	var notes []struct {
+		models.Note `bson:",inline"`
+		Score       float64 `bson:"score"`
+	}
+	if err := findRanked(ctx, db.Collection("notes"), filter, limit, &notes); err != nil {
+		return nil, err
+	}
+
+	highlighter := query.highlighter()
+	results := make([]models.SemanticSearchResult, 0, len(notes))
+	for _, note := range notes {
+		chunks := ChunkNoteContent(note.Content)
+		if len(chunks) == 0 {
+			continue
+		}
+
+		best, bestMatches := 0, -1
+		for i, chunk := range chunks {
+			if matches := len(highlightMatches(highlighter, chunk)); matches > bestMatches {
+				best, bestMatches = i, matches
+			}
+		}
+		results = append(results, models.SemanticSearchResult{
+			NoteID:     note.ID,
+			Title:      note.Title,
+			Excerpt:    chunks[best],
+			ChunkIndex: best,
+			Score:      note.Score,
+		})
+	}
+	return results, nil
+}
@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"server/models"
+	"strings"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	MaxNoteTags  = 20
+	MaxTagLength = 50
+)
+
+// NormalizeTag returns tag in its stored form: lower case, without a leading
+// '#' and with runs of whitespace collapsed, so "#Work  Items" and
+// "work items" are the same tag.
+func NormalizeTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.Join(strings.Fields(strings.TrimLeft(strings.TrimSpace(tag), "#")), " "))
+	if tag == "" {
+		return "", fmt.Errorf("tags cannot be empty")
+	}
+	if utf8.RuneCountInString(tag) > MaxTagLength {
+		return "", fmt.Errorf("tag %q is longer than %d characters", tag, MaxTagLength)
+	}
+	return tag, nil
+}
+
+// NormalizeTags normalizes each tag and drops duplicates, keeping the first
+// occurrence's position.
+func NormalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag, err := NormalizeTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	if len(normalized) > MaxNoteTags {
+		return nil, fmt.Errorf("a note can have at most %d tags", MaxNoteTags)
+	}
+	return normalized, nil
+}
+
+// ListUserTags returns every tag used on the user's notes with the number of
+// notes carrying it, most used first. Notes in the trash are not counted.
+func ListUserTags(ctx context.Context, db *mongo.Database, userID primitive.ObjectID) ([]models.TagCount, error) {
+	pipeline := bson.A{
+		bson.M{"$match": bson.M{"userId": userID, "tags": bson.M{"$exists": true}, "deletedAt": nil}},
+		bson.M{"$unwind": "$tags"},
+		bson.M{"$group": bson.M{"_id": "$tags", "count": bson.M{"$sum": 1}}},
+		bson.M{"$sort": bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}},
+	}
+
+	cursor, err := db.Collection("notes").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	tags := []models.TagCount{}
+	if err := cursor.All(ctx, &tags); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// MergeUserTags replaces the tags in from with into on every note of the
+// user that carries one of them. Renaming a tag is merging it alone; if into
+// is already in use the notes simply end up sharing it. Changed notes get a
+// new version so that clients holding the old tags see a conflict rather
+// than writing them back.
+func MergeUserTags(ctx context.Context, db *mongo.Database, userID primitive.ObjectID, from []string, into string) (int64, error) {
+	update := bson.A{
+		bson.M{"$set": bson.M{
+			"tags": bson.M{"$concatArrays": bson.A{
+				bson.M{"$filter": bson.M{
+					"input": "$tags",
+					"cond": bson.M{"$and": bson.A{
+						bson.M{"$not": bson.A{bson.M{"$in": bson.A{"$$this", from}}}},
+						bson.M{"$ne": bson.A{"$$this", into}},
+					}},
+				}},
+				bson.A{into},
+			}},
+			"version": bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$version", 0}}, 1}},
+		}},
+	}
+
+	result, err := db.Collection("notes").UpdateMany(ctx, bson.M{
+		"userId": userID,
+		"tags":   bson.M{"$in": from},
+	}, update)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
@@ -0,0 +1,219 @@
+package utils
+
+import (
+	"context"
+	"log"
+	"server/config"
+	"server/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DefaultTrashRetention is how long deleted notes and chat sessions stay in
+// the trash when TRASH_RETENTION is not set.
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// inTrash matches documents whose deletedAt is set. Restoring unsets it, so
+// it is never null, and the partial deletedAt indexes can serve the match.
+var inTrash = bson.M{"$exists": true}
+
+// TrashRetention is how long deleted notes and chat sessions stay in the
+// trash before they are purged.
+func TrashRetention() time.Duration {
+	return config.Duration("TRASH_RETENTION", DefaultTrashRetention)
+}
+
+// TrashUserNotes moves the given notes of a user to the trash and returns
+// how many were moved. Notes already in the trash keep their deletion time.
+func TrashUserNotes(ctx context.Context, db *mongo.Database, userID primitive.ObjectID, noteIDs []primitive.ObjectID) (int64, error) {
+	if len(noteIDs) == 0 {
+		return 0, nil
+	}
+
+	result, err := db.Collection("notes").UpdateMany(ctx,
+		bson.M{"_id": bson.M{"$in": noteIDs}, "userId": userID, "deletedAt": nil},
+		bson.M{"$set": bson.M{"deletedAt": time.Now()}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// RestoreNote takes note out of the trash and returns it as restored. A note
+// whose notebook was deleted in the meantime comes back unfiled.
+func RestoreNote(ctx context.Context, db *mongo.Database, note models.Note) (models.Note, error) {
+	unset := bson.M{"deletedAt": ""}
+	if note.NotebookID != nil {
+		count, err := db.Collection("notebooks").CountDocuments(ctx,
+			bson.M{"_id": *note.NotebookID, "userId": note.UserID},
+			options.Count().SetLimit(1),
+		)
+		if err != nil {
+			return note, err
+		}
+		if count == 0 {
+			unset["notebookId"] = ""
+			note.NotebookID = nil
+		}
+	}
+
+	_, err := db.Collection("notes").UpdateOne(ctx,
+		bson.M{"_id": note.ID, "userId": note.UserID, "deletedAt": inTrash},
+		bson.M{"$unset": unset},
+	)
+	note.DeletedAt = nil
+	return note, err
+}
+
+// ListTrashedNotes returns the user's notes in the trash, most recently
+// deleted first, loaded as for NoteListOptions.Summary.
+func ListTrashedNotes(ctx context.Context, db *mongo.Database, userID primitive.ObjectID) ([]models.Note, error) {
+	cursor, err := db.Collection("notes").Find(ctx,
+		bson.M{"userId": userID, "deletedAt": inTrash},
+		options.Find().
+			SetSort(bson.M{"deletedAt": -1}).
+			SetProjection(noteSummaryProjection),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	notes := []models.Note{}
+	if err := cursor.All(ctx, &notes); err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
+
+// TrashChatSession moves a chat session and its messages to the trash.
+func TrashChatSession(ctx context.Context, db *mongo.Database, session models.ChatSession) error {
+	filter := bson.M{"sessionId": session.SessionID, "clerkId": session.ClerkID, "deletedAt": nil}
+	update := bson.M{"$set": bson.M{"deletedAt": time.Now()}}
+
+	if _, err := db.Collection("chat_messages").UpdateMany(ctx, filter, update); err != nil {
+		return err
+	}
+	_, err := db.Collection("chat_sessions").UpdateOne(ctx, filter, update)
+	return err
+}
+
+// RestoreChatSession takes a chat session and its messages out of the trash.
+func RestoreChatSession(ctx context.Context, db *mongo.Database, session models.ChatSession) error {
+	filter := bson.M{"sessionId": session.SessionID, "clerkId": session.ClerkID, "deletedAt": inTrash}
+	update := bson.M{"$unset": bson.M{"deletedAt": ""}}
+
+	if _, err := db.Collection("chat_messages").UpdateMany(ctx, filter, update); err != nil {
+		return err
+	}
+	_, err := db.Collection("chat_sessions").UpdateOne(ctx, filter, update)
+	return err
+}
+
+// ListTrashedChatSessions returns the user's chat sessions in the trash,
+// most recently deleted first.
+func ListTrashedChatSessions(ctx context.Context, db *mongo.Database, clerkID string) ([]models.ChatSession, error) {
+	cursor, err := db.Collection("chat_sessions").Find(ctx,
+		bson.M{"clerkId": clerkID, "deletedAt": inTrash},
+		options.Find().SetSort(bson.M{"deletedAt": -1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	sessions := []models.ChatSession{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// DeleteChatSession permanently deletes a chat session and its messages.
+func DeleteChatSession(ctx context.Context, db *mongo.Database, session models.ChatSession) error {
+	filter := bson.M{"sessionId": session.SessionID, "clerkId": session.ClerkID}
+
+	if _, err := db.Collection("chat_messages").DeleteMany(ctx, filter); err != nil {
+		return err
+	}
+	_, err := db.Collection("chat_sessions").DeleteOne(ctx, filter)
+	return err
+}
+
+// PurgeTrash permanently deletes the notes and chat sessions that were moved
+// to the trash before cutoff, and returns how many of each it deleted. Notes
+// go through DeleteUserNotes, so their revisions, search chunks and entries
+// in users.noteIds go with them.
+func PurgeTrash(ctx context.Context, db *mongo.Database, cutoff time.Time) (notes, sessions int64, err error) {
+	expired := bson.M{"deletedAt": bson.M{"$lt": cutoff}}
+
+	noteCursor, err := db.Collection("notes").Find(ctx, expired,
+		options.Find().SetProjection(bson.M{"_id": 1, "userId": 1}),
+	)
+	if err != nil {
+		return 0, 0, err
+	}
+	var expiredNotes []models.Note
+	if err := noteCursor.All(ctx, &expiredNotes); err != nil {
+		return 0, 0, err
+	}
+
+	byUser := map[primitive.ObjectID][]primitive.ObjectID{}
+	for _, note := range expiredNotes {
+		byUser[note.UserID] = append(byUser[note.UserID], note.ID)
+	}
+	for userID, noteIDs := range byUser {
+		deleted, err := DeleteUserNotes(ctx, db, userID, noteIDs)
+		notes += deleted
+		if err != nil {
+			return notes, sessions, err
+		}
+	}
+
+	sessionCursor, err := db.Collection("chat_sessions").Find(ctx, expired,
+		options.Find().SetProjection(bson.M{"sessionId": 1, "clerkId": 1}),
+	)
+	if err != nil {
+		return notes, sessions, err
+	}
+	var expiredSessions []models.ChatSession
+	if err := sessionCursor.All(ctx, &expiredSessions); err != nil {
+		return notes, sessions, err
+	}
+
+	for _, session := range expiredSessions {
+		if err := DeleteChatSession(ctx, db, session); err != nil {
+			return notes, sessions, err
+		}
+		sessions++
+	}
+	return notes, sessions, nil
+}
+
+// RunTrashPurge purges the trash of everything older than TrashRetention
+// now and then every interval, until ctx is done. Failures are logged and
+// retried on the next run.
+func RunTrashPurge(ctx context.Context, db *mongo.Database, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		notes, sessions, err := PurgeTrash(ctx, db, time.Now().Add(-TrashRetention()))
+		if err != nil {
+			log.Printf("Failed to purge trash: %v", err)
+		} else if notes > 0 || sessions > 0 {
+			log.Printf("Purged %d notes and %d chat sessions from the trash", notes, sessions)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package utils
+
+import (
+	"context"
+	"server/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// RecordUsage stores a usage event and rolls its totals up onto the user and,
+// when the event belongs to one, the chat session.
+func RecordUsage(ctx context.Context, db *mongo.Database, event models.UsageEvent) error {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	if _, err := db.Collection("usage_events").InsertOne(ctx, event); err != nil {
+		return err
+	}
+
+	increment := bson.M{
+		"usage.promptTokens":     event.PromptTokens,
+		"usage.completionTokens": event.CompletionTokens,
+		"usage.totalTokens":      event.TotalTokens,
+		"usage.cost":             event.Cost,
+	}
+
+	_, err := db.Collection("users").UpdateOne(
+		ctx,
+		bson.M{"_id": event.UserID},
+		bson.M{"$inc": increment},
+	)
+	if err != nil {
+		return err
+	}
+
+	if event.SessionID == "" {
+		return nil
+	}
+
+	_, err = db.Collection("chat_sessions").UpdateOne(
+		ctx,
+		bson.M{"sessionId": event.SessionID, "clerkId": event.ClerkID},
+		bson.M{"$inc": increment},
+	)
+	return err
+}
+
+// GetUsageSummary aggregates a user's usage events since the given time into
+// totals, a per-day breakdown (UTC) and a per-model breakdown.
+func GetUsageSummary(ctx context.Context, db *mongo.Database, clerkID string, since time.Time) (*models.UsageSummary, error) {
+	collection := db.Collection("usage_events")
+
+	sums := bson.M{
+		"requests":         bson.M{"$sum": 1},
+		"promptTokens":     bson.M{"$sum": "$promptTokens"},
+		"completionTokens": bson.M{"$sum": "$completionTokens"},
+		"totalTokens":      bson.M{"$sum": "$totalTokens"},
+		"cost":             bson.M{"$sum": "$cost"},
+	}
+
+	group := func(id interface{}) bson.M {
+		stage := bson.M{"_id": id}
+		for key, value := range sums {
+			stage[key] = value
+		}
+		return bson.M{"$group": stage}
+	}
+
+	pipeline := bson.A{
+		bson.M{"$match": bson.M{"clerkId": clerkID, "createdAt": bson.M{"$gte": since}}},
+		bson.M{"$facet": bson.M{
+			"totals": bson.A{
+				group(nil),
+			},
+			"daily": bson.A{
+				group(bson.M{"$dateToString": bson.M{"format": "%Y-%m-%d", "date": "$createdAt"}}),
+				bson.M{"$addFields": bson.M{"date": "$_id"}},
+				bson.M{"$sort": bson.M{"date": 1}},
+			},
+			"byModel": bson.A{
+				group(bson.M{"provider": "$provider", "model": "$model"}),
+				bson.M{"$addFields": bson.M{"provider": "$_id.provider", "model": "$_id.model"}},
+				bson.M{"$sort": bson.M{"cost": -1, "totalTokens": -1}},
+			},
+		}},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		Totals  []models.UsageBreakdown `bson:"totals"`
+		Daily   []models.UsageBreakdown `bson:"daily"`
+		ByModel []models.UsageBreakdown `bson:"byModel"`
+	}
+	if err = cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	summary := &models.UsageSummary{
+		Since:   since,
+		Daily:   []models.UsageBreakdown{},
+		ByModel: []models.UsageBreakdown{},
+	}
+
+	if len(results) > 0 {
+		if len(results[0].Totals) > 0 {
+			summary.Totals = results[0].Totals[0]
+		}
+		if results[0].Daily != nil {
+			summary.Daily = results[0].Daily
+		}
+		if results[0].ByModel != nil {
+			summary.ByModel = results[0].ByModel
+		}
+	}
+
+	return summary, nil
+}